@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"os"
+
 	"github.com/NorskHelsenett/ror-agent/internal/config"
 	"github.com/NorskHelsenett/ror-agent/internal/handlers/dynamichandler"
+	"github.com/NorskHelsenett/ror-agent/internal/models/rorResources"
 	"github.com/NorskHelsenett/ror-agent/internal/scheduler"
 	"github.com/NorskHelsenett/ror-agent/internal/services"
 	"github.com/NorskHelsenett/ror-agent/internal/services/resourceupdate"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/dynamicclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/eventfeed"
 	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/leaderelectionservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/lifecycleservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
 	"github.com/NorskHelsenett/ror-agent/common/pkg/services/pprofservice"
 
 	"github.com/NorskHelsenett/ror/pkg/config/rorversion"
@@ -19,23 +28,50 @@ import (
 
 func main() {
 	config.Init()
+	lifecycle := lifecycleservice.NewLifecycleFromConfig()
 
 	pprofservice.MayStartPprof()
+	metricsservice.MayStartMetricsServer()
 
 	rlog.Info("Agent is starting", rlog.String("version", rorversion.GetRorVersion().GetVersion()))
 
 	services.GetEgressIp()
 
 	rorClientInterface := clusteragentclient.MustInitNewRorAgentClient(clusteragentclient.GetDefaultRorAgentClientConfig())
+	rorClientInterface.WatchApiKeySecret(lifecycle.Context())
 
-	resourceupdate.ResourceCache.MustInit(rorClientInterface)
+	rorResources.MustInitResourceHasher()
+	rorResources.MustInitResourceRedactor()
 
-	dynamicclient.MustStart(rorClientInterface, dynamichandler.NewDynamicClientHandler())
+	// started before the leader election so standby replicas answer the probes
+	healthservice.MustStart()
 
-	scheduler.MustStart(rorClientInterface)
+	leaderelectionservice.MustRun(lifecycle, rorClientInterface, func(ctx context.Context, shard sharding.Shard) {
+		resourceCache := resourceupdate.MustInitNewResourceCache(ctx, rorClientInterface, shard)
 
-	healthservice.MustStart()
+		watchers := dynamicclient.MustStartShard(ctx, rorClientInterface, dynamichandler.NewDynamicClientHandler(ctx, resourceCache), shard)
+		resourceCache.StartCleanup(watchers)
+
+		// stop the watchers first so nothing new is queued while the resource cache drains
+		lifecycle.OnShutdown("watchers", func(context.Context) error {
+			watchers.Stop()
+			return nil
+		})
+		lifecycle.OnShutdown("resourcecache", resourceCache.Shutdown)
+
+		// the heartbeat and the events report the whole cluster, they are only sent by the first shard
+		if !shard.Primary() {
+			return
+		}
+		// registering the agent again writes the api key secret, so the api key is only checked by the first shard
+		rorClientInterface.StartApiKeyCheck(ctx)
+		eventfeed.MayStart(ctx, rorClientInterface)
+		agentScheduler := scheduler.MustStart(ctx, rorClientInterface)
+		lifecycle.OnShutdown("scheduler", func(context.Context) error {
+			agentScheduler.Stop()
+			return nil
+		})
+	})
 
-	<-rorClientInterface.GetStopChan()
-	rlog.Info("Shutting down...")
+	os.Exit(lifecycle.Wait(rorClientInterface.GetSigs()))
 }
@@ -0,0 +1,179 @@
+package clusteragentclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apikeystypes/v2"
+	"github.com/NorskHelsenett/ror/pkg/config/configconsts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// unauthorizedTracker counts the consecutive checks of the api key rejected by ror-api.
+type unauthorizedTracker struct {
+	// threshold is the number of rejected checks in a row before the agent registers again, 0 never registers again
+	threshold int
+	rejected  int
+}
+
+// observe records the result of a check and reports whether the agent should register again.
+// Only 401 counts as rejected, errors like an unreachable ror-api do not tell whether the key is valid.
+func (t *unauthorizedTracker) observe(err error) bool {
+	switch {
+	case err == nil:
+		t.rejected = 0
+	case statuscode.FromError(err) == http.StatusUnauthorized:
+		t.rejected++
+	}
+	if t.threshold <= 0 || t.rejected < t.threshold {
+		return false
+	}
+	t.rejected = 0
+	return true
+}
+
+// WatchApiKeySecret keeps the api key up to date without restarting the agent. A new key written to the api key
+// secret, like a key rotated in ror or registered by another replica, is used by the next request to ror-api.
+func (r *rorAgentClient) WatchApiKeySecret(ctx context.Context) {
+	if err := r.watchApiKeySecret(ctx); err != nil {
+		rlog.Error("could not watch api key secret, a rotated api key is only used after a restart", err)
+	}
+}
+
+// StartApiKeyCheck registers the agent again and writes the new key to the api key secret if ror-api keeps rejecting the key.
+func (r *rorAgentClient) StartApiKeyCheck(ctx context.Context) {
+	go r.checkApiKey(ctx)
+}
+
+// watchApiKeySecret uses the api key in the api key secret when it is changed.
+func (r *rorAgentClient) watchApiKeySecret(ctx context.Context) error {
+	clientset, err := r.k8sClientSet.GetKubernetesClientset()
+	if err != nil {
+		return err
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(r.config.namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", r.config.apiKeySecret).String()
+		}))
+	informer := factory.Core().V1().Secrets().Informer()
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    r.apiKeySecretChanged,
+		UpdateFunc: func(_, obj any) { r.apiKeySecretChanged(obj) },
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	return nil
+}
+
+func (r *rorAgentClient) apiKeySecretChanged(obj any) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+	apiKey := string(secret.Data["APIKEY"])
+	if apiKey == "" {
+		return
+	}
+	r.authMu.Lock()
+	defer r.authMu.Unlock()
+	if apiKey == r.config.apiKey {
+		return
+	}
+	rlog.Info("api key secret changed, using the new api key", rlog.String("secret", r.config.apiKeySecret))
+	r.setApiKey(apiKey)
+}
+
+// checkApiKey checks the api key against ror-api every ROR_API_KEY_CHECK_INTERVAL_SECONDS until ctx is canceled,
+// and registers the agent again after ROR_API_KEY_REREGISTER_AFTER checks in a row are rejected.
+func (r *rorAgentClient) checkApiKey(ctx context.Context) {
+	interval := time.Duration(rorconfig.GetInt(agentconsts.ApiKeyCheckIntervalSecondsEnv)) * time.Second
+	if interval <= 0 {
+		return
+	}
+	tracker := &unauthorizedTracker{threshold: rorconfig.GetInt(agentconsts.ApiKeyReregisterAfterEnv)}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := timeouts.RorApi(ctx)
+		_, err := r.currentRorClient().V2().Self().Get(checkCtx)
+		cancel()
+		if statuscode.FromError(err) == http.StatusUnauthorized {
+			rlog.Warn("api key rejected by ror-api", rlog.Int("rejected", tracker.rejected+1), rlog.Int("reregister after", tracker.threshold))
+		}
+		if !tracker.observe(err) {
+			continue
+		}
+		if err := r.reregister(ctx); err != nil {
+			rlog.Error("could not register the agent again", err)
+		}
+	}
+}
+
+// reregister registers the cluster in ror-api for a new api key, used by the next request and written to the api key secret.
+func (r *rorAgentClient) reregister(ctx context.Context) error {
+	if r.dryRunSink != nil {
+		return fmt.Errorf("dry-run enabled, registering the cluster would write to ror-api")
+	}
+	r.authMu.Lock()
+	defer r.authMu.Unlock()
+
+	rlog.Info("registering the agent again for a new api key", rlog.String("cluster id", r.config.identifier))
+	ctx, cancel := timeouts.RorApi(ctx)
+	defer cancel()
+	resp, err := r.newUnauthorizedRorClient().ApiKeysV2().RegisterAgent(ctx, apikeystypes.RegisterClusterRequest{
+		ClusterId: r.config.identifier,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register cluster %w", err)
+	}
+	if resp == nil || resp.ApiKey == "" {
+		return fmt.Errorf("failed to register cluster, no api key in the response")
+	}
+	if r.config.identifier != resp.ClusterId {
+		rlog.Warn("The api changed the cluster id during registration", rlog.String("old cluster id", r.config.identifier), rlog.String("new cluster id", resp.ClusterId))
+		r.config.identifier = resp.ClusterId
+		rorconfig.Set(configconsts.CLUSTER_ID, resp.ClusterId)
+	}
+	r.setApiKey(resp.ApiKey)
+
+	err = r.kubernetesUpdateOrCreateApiKeySecret()
+	if err != nil {
+		return fmt.Errorf("failed to update api key secret with new api key %w", err)
+	}
+	rlog.Info("agent registered again, using the new api key")
+	return nil
+}
+
+// setApiKey replaces the ror client with a client using apiKey, used from the next request by every client
+// returned by GetRorClient. Requests already sent finish with the old key. authMu must be held.
+func (r *rorAgentClient) setApiKey(apiKey string) {
+	rorClient := r.newRorClient(apiKey)
+	if current := r.currentRorClient(); current != nil {
+		rorClient.SetOwnerref(current.GetOwnerref())
+	}
+	r.setRorClient(rorClient)
+	r.config.apiKey = apiKey
+	rorconfig.Set(configconsts.API_KEY, apiKey)
+}
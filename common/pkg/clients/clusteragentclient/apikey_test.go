@@ -0,0 +1,114 @@
+package clusteragentclient
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/clients/rorclient"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
+)
+
+func TestUnauthorizedTracker_observe(t *testing.T) {
+	unauthorized := statuscode.New(401, "request failed")
+	unavailable := errors.New("dial tcp: connection refused")
+
+	tests := []struct {
+		name      string
+		threshold int
+		results   []error
+		want      []bool
+	}{
+		{name: "Test registers again after threshold rejections in a row", threshold: 3, results: []error{unauthorized, unauthorized, unauthorized}, want: []bool{false, false, true}},
+		{name: "Test success resets the rejections", threshold: 2, results: []error{unauthorized, nil, unauthorized, unauthorized}, want: []bool{false, false, false, true}},
+		{name: "Test unreachable ror-api neither counts nor resets", threshold: 2, results: []error{unauthorized, unavailable, unauthorized}, want: []bool{false, false, true}},
+		{name: "Test counting starts over after registering again", threshold: 1, results: []error{unauthorized, unauthorized}, want: []bool{true, true}},
+		{name: "Test threshold 0 never registers again", threshold: 0, results: []error{unauthorized, unauthorized}, want: []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := &unauthorizedTracker{threshold: tt.threshold}
+			for i, err := range tt.results {
+				if got := tracker.observe(err); got != tt.want[i] {
+					t.Errorf("observe(%v) #%d = %t, want %t", err, i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// keyedRorClient records the resource updates sent with the api key it was created with.
+type keyedRorClient struct {
+	rorclient.RorClientInterface
+	apiKey string
+	owner  rorresourceowner.RorResourceOwnerReference
+	sent   *[]string
+}
+
+func (c *keyedRorClient) GetOwnerref() rorresourceowner.RorResourceOwnerReference {
+	return c.owner
+}
+
+func (c *keyedRorClient) SetOwnerref(owner rorresourceowner.RorResourceOwnerReference) {
+	c.owner = owner
+}
+
+func (c *keyedRorClient) V1() rorclient.V1Client {
+	return &keyedV1Client{client: c}
+}
+
+type keyedV1Client struct {
+	rorclient.V1Client
+	client *keyedRorClient
+}
+
+func (c *keyedV1Client) Resources() rorclient.V1ResourcesInterface {
+	return &keyedResourcesClient{client: c.client}
+}
+
+type keyedResourcesClient struct {
+	rorclient.V1ResourcesInterface
+	client *keyedRorClient
+}
+
+func (c *keyedResourcesClient) Update(_ context.Context, resourceUpdate *apiresourcecontracts.ResourceUpdateModel) error {
+	*c.client.sent = append(*c.client.sent, resourceUpdate.Uid+"@"+c.client.apiKey)
+	return nil
+}
+
+func TestRorAgentClient_setApiKey(t *testing.T) {
+	var sent []string
+	agent := &rorAgentClient{
+		newRorClient: func(apiKey string) rorclient.RorClientInterface {
+			return &keyedRorClient{apiKey: apiKey, sent: &sent}
+		},
+	}
+	agent.setRorClient(agent.newRorClient("old"))
+	// kept like the resource cache keeps it
+	rorClient := agent.GetRorClient()
+	owner := rorresourceowner.RorResourceOwnerReference{Scope: aclmodels.Acl2ScopeCluster, Subject: "cluster"}
+	rorClient.SetOwnerref(owner)
+
+	update := &apiresourcecontracts.ResourceUpdateModel{Uid: "1"}
+	if err := rorClient.V1().Resources().Update(context.Background(), update); err != nil {
+		t.Fatal(err)
+	}
+	agent.authMu.Lock()
+	agent.setApiKey("new")
+	agent.authMu.Unlock()
+	if err := rorClient.V1().Resources().Update(context.Background(), update); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"1@old", "1@new"}; !slices.Equal(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	if got := rorClient.GetOwnerref(); got != owner {
+		t.Errorf("owner after changing the api key = %v, want %v", got, owner)
+	}
+}
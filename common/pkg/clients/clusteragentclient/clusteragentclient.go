@@ -11,6 +11,12 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/dryrunclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apikeystypes/v2"
 	kubernetesclient "github.com/NorskHelsenett/ror/pkg/clients/kubernetes"
@@ -42,6 +48,9 @@ const (
 	UNKNOWN_API_KEY    = "___unknown_api_key___"
 )
 
+// kubernetesHealthCheckTimeout is kept below the default probe timeout of the charts.
+const kubernetesHealthCheckTimeout = 5 * time.Second
+
 type RorAgentClientInterface interface {
 	GetRorClient() rorclient.RorClientInterface
 	GetKubernetesClientset() *kubernetesclient.K8sClientsets
@@ -52,6 +61,12 @@ type RorAgentClientInterface interface {
 	GetStopChan() chan struct{}
 	PingRorAPI() error
 
+	// WatchApiKeySecret uses a new api key written to the api key secret until ctx is canceled, every replica watches it.
+	WatchApiKeySecret(ctx context.Context)
+	// StartApiKeyCheck checks the api key against ror-api and registers the agent again when it is rejected,
+	// until ctx is canceled. It writes to ror-api and the api key secret, so only a single replica should run it.
+	StartApiKeyCheck(ctx context.Context)
+
 	interregatortypes.ClusterInterregator
 }
 
@@ -66,13 +81,20 @@ type RorAgentClientConfig struct {
 }
 
 type rorAgentClient struct {
-	rorAPIClient *rorclient.RorClient
+	// rorAPIClient is replaced by a client using the new api key when the key changes, guarded by clientMu
+	rorAPIClient rorclient.RorClientInterface
+	clientMu     sync.RWMutex
+	// newRorClient returns a ror client authorized by an api key
+	newRorClient func(apiKey string) rorclient.RorClientInterface
 	k8sClientSet *kubernetesclient.K8sClientsets
 	config       RorAgentClientConfig
 	stopChan     chan struct{}
 	sigs         chan os.Signal
 	egressOnce   sync.Once
 	egressIP     string
+	dryRunSink   dryrunclient.Sink
+	// authMu guards changing the api key after start
+	authMu sync.Mutex
 }
 
 func GetDefaultRorAgentClientConfig() *RorAgentClientConfig {
@@ -113,6 +135,16 @@ func NewRorAgentClient(config *RorAgentClientConfig) (RorAgentClientInterface, e
 		sigs:         make(chan os.Signal, 1),
 		stopChan:     make(chan struct{}),
 	}
+	client.newRorClient = client.newAuthorizedRorClient
+	if dryrunclient.Enabled() {
+		sink, err := dryrunclient.NewSinkFromConfig()
+		if err != nil {
+			return nil, err
+		}
+		client.dryRunSink = sink
+		rlog.Warn("dry-run enabled, writes to ror-api are recorded instead of sent", rlog.String("output", rorconfig.GetString(agentconsts.DryRunOutputEnv)))
+	}
+
 	// Create channel to receive stop signal
 	signal.Notify(client.sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGINT) // Register the sigs channel to receieve SIGTERM
 
@@ -134,12 +166,15 @@ func NewRorAgentClient(config *RorAgentClientConfig) (RorAgentClientInterface, e
 		return nil, err
 	}
 
-	ver, err := client.rorAPIClient.Info().GetVersion(context.TODO())
+	rorClient := client.currentRorClient()
+	ctx, cancel := timeouts.RorApi(context.Background())
+	defer cancel()
+	ver, err := rorClient.Info().GetVersion(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	selfdata, err := client.rorAPIClient.V2().Self().Get(context.TODO())
+	selfdata, err := rorClient.V2().Self().Get(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -150,7 +185,7 @@ func NewRorAgentClient(config *RorAgentClientConfig) (RorAgentClientInterface, e
 	}
 
 	rlog.Info("connected to ror-api", rlog.String("version", ver), rlog.String("clusterid", selfdata.User.Name), rlog.String("uid", selfdata.User.Uid))
-	client.rorAPIClient.SetOwnerref(rorresourceowner.RorResourceOwnerReference{
+	rorClient.SetOwnerref(rorresourceowner.RorResourceOwnerReference{
 		Scope:   aclmodels.Acl2ScopeCluster,
 		Subject: aclmodels.Acl2Subject(selfdata.User.Name),
 	})
@@ -164,29 +199,62 @@ func NewRorAgentClient(config *RorAgentClientConfig) (RorAgentClientInterface, e
 		_ = client.kubernetesUpdateOrCreateApiKeySecret()
 	}
 
-	rorhealth.Register(context.TODO(), "rorAPI", client.rorAPIClient)
+	rorhealth.Register(context.TODO(), "rorAPI", &rotatingRorClient{agent: client})
+	healthservice.RegisterReadinessCheck("kubernetesAPI", client.kubernetesHealthCheck)
 
 	return client, nil
 }
 
+// GetRorClient returns a ror client using the current api key on every request, so it can be kept
+// by the caller across api key changes.
 func (r *rorAgentClient) GetRorClient() rorclient.RorClientInterface {
+	if r.dryRunSink != nil {
+		return dryrunclient.NewRorClient(&rotatingRorClient{agent: r}, r.dryRunSink)
+	}
+	return &rotatingRorClient{agent: r}
+}
+
+func (r *rorAgentClient) currentRorClient() rorclient.RorClientInterface {
+	r.clientMu.RLock()
+	defer r.clientMu.RUnlock()
 	return r.rorAPIClient
 }
 
+func (r *rorAgentClient) setRorClient(client rorclient.RorClientInterface) {
+	r.clientMu.Lock()
+	defer r.clientMu.Unlock()
+	r.rorAPIClient = client
+}
+
 func (r *rorAgentClient) GetKubernetesClientset() *kubernetesclient.K8sClientsets {
 	return r.k8sClientSet
 }
 
 func (r *rorAgentClient) PingRorAPI() error {
-	if r.rorAPIClient == nil {
+	if r.currentRorClient() == nil {
 		r.initUnathorizedRorClient()
 	}
-	if r.rorAPIClient.Ping() {
+	if r.currentRorClient().Ping() {
 		return nil
 	}
 	return fmt.Errorf("could not ping ror-api")
 }
 
+// kubernetesHealthCheck checks that the kubernetes api server answers within kubernetesHealthCheckTimeout.
+func (r *rorAgentClient) kubernetesHealthCheck() healthservice.CheckResult {
+	clientset, err := r.k8sClientSet.GetKubernetesClientset()
+	if err != nil {
+		return healthservice.CheckResult{Status: healthservice.StatusFail, Output: err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesHealthCheckTimeout)
+	defer cancel()
+	err = clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+	if err != nil {
+		return healthservice.CheckResult{Status: healthservice.StatusFail, Output: fmt.Sprintf("kubernetes api not reachable: %v", err)}
+	}
+	return healthservice.CheckResult{Status: healthservice.StatusPass}
+}
+
 // initRorAgentClientSetup initializes the kubernetes cluster setup by verifying access to the namespace, api endpoint and cluster id.
 func (r *rorAgentClient) initRorAgentClientSetup() error {
 
@@ -212,7 +280,9 @@ func (r *rorAgentClient) initRorAgentClientSetup() error {
 			rlog.Error("failed to setup RorClient", err)
 			return err
 		}
-		selfdata, err := r.rorAPIClient.V2().Self().Get(context.TODO())
+		ctx, cancel := timeouts.RorApi(context.Background())
+		selfdata, err := r.currentRorClient().V2().Self().Get(ctx)
+		cancel()
 		if err != nil {
 			return err
 		}
@@ -264,12 +334,17 @@ func (r *rorAgentClient) initRorAgentClientSetup() error {
 	}
 
 	if r.config.apiKey == UNKNOWN_API_KEY {
+		if r.dryRunSink != nil {
+			return fmt.Errorf("dry-run requires an existing api key, registering the cluster would write to ror-api")
+		}
 		rlog.Info("api key secret not found, registering new key")
 
 		r.initUnathorizedRorClient()
-		resp, err := r.rorAPIClient.ApiKeysV2().RegisterAgent(context.TODO(), apikeystypes.RegisterClusterRequest{
+		ctx, cancel := timeouts.RorApi(context.Background())
+		resp, err := r.currentRorClient().ApiKeysV2().RegisterAgent(ctx, apikeystypes.RegisterClusterRequest{
 			ClusterId: r.config.identifier,
 		})
+		cancel()
 		if err != nil {
 			return fmt.Errorf("failed to register cluster %s", err)
 		}
@@ -384,6 +459,10 @@ func (r *rorAgentClient) getClusterAuthFromSecret() error {
 }
 
 func (r *rorAgentClient) initUnathorizedRorClient() {
+	r.setRorClient(r.newUnauthorizedRorClient())
+}
+
+func (r *rorAgentClient) newUnauthorizedRorClient() *rorclient.RorClient {
 	httptransportconfig := httpclient.HttpTransportClientConfig{
 		BaseURL:      r.config.apiEndpoint,
 		AuthProvider: httpauthprovider.NewNoAuthprovider(),
@@ -391,28 +470,32 @@ func (r *rorAgentClient) initUnathorizedRorClient() {
 		Version:      rorversion.GetRorVersion(),
 	}
 	rorclienttransport := resttransport.NewRorHttpTransport(&httptransportconfig)
-	r.rorAPIClient = rorclient.NewRorClient(rorclienttransport)
+	return rorclient.NewRorClient(rorclienttransport)
 }
 func (r *rorAgentClient) initAuthorizedRorClient() error {
 
 	if r.config.apiKey == UNKNOWN_API_KEY {
 		return fmt.Errorf("API_KEY is not set in the configuration")
 	}
-	authProvider := httpauthprovider.NewAuthProvider(httpauthprovider.AuthPoviderTypeAPIKey, r.config.apiKey)
+	rorClient := r.newRorClient(r.config.apiKey)
+	r.setRorClient(rorClient)
+
+	if err := rorClient.CheckConnection(); err != nil {
+		return fmt.Errorf("failed to ping RorClient: %w", err)
+	}
+
+	return nil
+}
+
+func (r *rorAgentClient) newAuthorizedRorClient(apiKey string) rorclient.RorClientInterface {
 	clientConfig := httpclient.HttpTransportClientConfig{
 		BaseURL:      r.config.apiEndpoint,
-		AuthProvider: authProvider,
+		AuthProvider: httpauthprovider.NewAuthProvider(httpauthprovider.AuthPoviderTypeAPIKey, apiKey),
 		Version:      rorversion.GetRorVersion(),
 		Role:         r.config.role,
 	}
 	transport := resttransport.NewRorHttpTransport(&clientConfig)
-	r.rorAPIClient = rorclient.NewRorClient(transport)
-
-	if err := r.rorAPIClient.CheckConnection(); err != nil {
-		return fmt.Errorf("failed to ping RorClient: %w", err)
-	}
-
-	return nil
+	return rorclient.NewRorClient(transport)
 }
 
 func (c *rorAgentClient) initInterregator() error {
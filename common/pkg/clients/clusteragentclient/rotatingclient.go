@@ -0,0 +1,58 @@
+package clusteragentclient
+
+import (
+	"context"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/rorclient"
+	"github.com/NorskHelsenett/ror/pkg/helpers/rorhealth"
+	"github.com/NorskHelsenett/ror/pkg/models/aclmodels/rorresourceowner"
+)
+
+// rotatingRorClient passes every call to the ror client of the agent using the current api key, so clients kept
+// by long running services, like the resource cache, use a rotated api key from the next request.
+// Every method is passed on explicitly, a method added to the ror client fails to build instead of using an old key.
+type rotatingRorClient struct {
+	agent *rorAgentClient
+}
+
+var _ rorclient.RorClientInterface = (*rotatingRorClient)(nil)
+
+func (c *rotatingRorClient) V1() rorclient.V1Client {
+	return c.agent.currentRorClient().V1()
+}
+
+func (c *rotatingRorClient) V2() rorclient.V2Client {
+	return c.agent.currentRorClient().V2()
+}
+
+func (c *rotatingRorClient) Info() rorclient.InfoInterface {
+	return c.agent.currentRorClient().Info()
+}
+
+func (c *rotatingRorClient) ApiKeysV2() rorclient.ApiKeysV2Interface {
+	return c.agent.currentRorClient().ApiKeysV2()
+}
+
+func (c *rotatingRorClient) Metrics() rorclient.MetricsInterface {
+	return c.agent.currentRorClient().Metrics()
+}
+
+func (c *rotatingRorClient) GetOwnerref() rorresourceowner.RorResourceOwnerReference {
+	return c.agent.currentRorClient().GetOwnerref()
+}
+
+func (c *rotatingRorClient) SetOwnerref(owner rorresourceowner.RorResourceOwnerReference) {
+	c.agent.currentRorClient().SetOwnerref(owner)
+}
+
+func (c *rotatingRorClient) Ping() bool {
+	return c.agent.currentRorClient().Ping()
+}
+
+func (c *rotatingRorClient) CheckConnection() error {
+	return c.agent.currentRorClient().CheckConnection()
+}
+
+func (c *rotatingRorClient) CheckHealth(ctx context.Context) []rorhealth.Check {
+	return c.agent.currentRorClient().CheckHealth(ctx)
+}
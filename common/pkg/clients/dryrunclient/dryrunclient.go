@@ -0,0 +1,114 @@
+// Package dryrunclient wraps the ror client so every write to ror-api is recorded in a sink instead of sent.
+// Reads are still served by ror-api, so hashes and cleanup are computed against the real state in ror.
+package dryrunclient
+
+import (
+	"context"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/clients/rorclient"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+)
+
+type rorClient struct {
+	rorclient.RorClientInterface
+	sink Sink
+}
+
+// NewRorClient returns a ror client recording writes in the sink and passing everything else to client.
+func NewRorClient(client rorclient.RorClientInterface, sink Sink) rorclient.RorClientInterface {
+	return &rorClient{RorClientInterface: client, sink: sink}
+}
+
+func (c *rorClient) V1() rorclient.V1Client {
+	return &v1Client{V1Client: c.RorClientInterface.V1(), sink: c.sink}
+}
+
+func (c *rorClient) V2() rorclient.V2Client {
+	return &v2Client{V2Client: c.RorClientInterface.V2(), sink: c.sink}
+}
+
+func (c *rorClient) Metrics() rorclient.MetricsInterface {
+	return &metricsClient{MetricsInterface: c.RorClientInterface.Metrics(), sink: c.sink}
+}
+
+type v1Client struct {
+	rorclient.V1Client
+	sink Sink
+}
+
+func (c *v1Client) Resources() rorclient.V1ResourcesInterface {
+	return &v1ResourcesClient{V1ResourcesInterface: c.V1Client.Resources(), sink: c.sink}
+}
+
+func (c *v1Client) Clusters() rorclient.V1ClustersInterface {
+	return &v1ClustersClient{V1ClustersInterface: c.V1Client.Clusters(), sink: c.sink}
+}
+
+func (c *v1Client) Metrics() rorclient.MetricsInterface {
+	return &metricsClient{MetricsInterface: c.V1Client.Metrics(), sink: c.sink}
+}
+
+type v1ResourcesClient struct {
+	rorclient.V1ResourcesInterface
+	sink Sink
+}
+
+func (c *v1ResourcesClient) Create(_ context.Context, resourceUpdate *apiresourcecontracts.ResourceUpdateModel) error {
+	return record(c.sink, "v1.resources.create", resourceUpdate)
+}
+
+func (c *v1ResourcesClient) Update(_ context.Context, resourceUpdate *apiresourcecontracts.ResourceUpdateModel) error {
+	return record(c.sink, "v1.resources.update", resourceUpdate)
+}
+
+func (c *v1ResourcesClient) Delete(_ context.Context, uid string) error {
+	return record(c.sink, "v1.resources.delete", map[string]string{"uid": uid})
+}
+
+type v1ClustersClient struct {
+	rorclient.V1ClustersInterface
+	sink Sink
+}
+
+func (c *v1ClustersClient) SendHeartbeat(_ context.Context, cluster apicontracts.Cluster) error {
+	return record(c.sink, "v1.clusters.heartbeat", cluster)
+}
+
+type metricsClient struct {
+	rorclient.MetricsInterface
+	sink Sink
+}
+
+func (c *metricsClient) PostReport(_ context.Context, report apicontracts.MetricsReport) error {
+	return record(c.sink, "metrics.report", report)
+}
+
+type v2Client struct {
+	rorclient.V2Client
+	sink Sink
+}
+
+func (c *v2Client) Resources() rorclient.V2ResourcesInterface {
+	return &v2ResourcesClient{V2ResourcesInterface: c.V2Client.Resources(), sink: c.sink}
+}
+
+type v2ResourcesClient struct {
+	rorclient.V2ResourcesInterface
+	sink Sink
+}
+
+func (c *v2ResourcesClient) Update(_ context.Context, resourceSet *rorresources.ResourceSet) (*rorresources.ResourceUpdateResults, error) {
+	return &rorresources.ResourceUpdateResults{}, record(c.sink, "v2.resources.update", resourceSet)
+}
+
+// record writes the payload to the sink, a failing sink is logged but never fails the caller
+// as the agent would otherwise queue the update for retry.
+func record(sink Sink, operation string, payload any) error {
+	if err := sink.Record(operation, payload); err != nil {
+		rlog.Error("could not record dry-run request", err, rlog.String("operation", operation))
+	}
+	return nil
+}
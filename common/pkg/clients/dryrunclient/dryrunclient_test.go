@@ -0,0 +1,80 @@
+package dryrunclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts"
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/clients/rorclient"
+)
+
+// failingRorClient fails the test if any request reaches ror-api.
+type failingRorClient struct {
+	rorclient.RorClientInterface
+	t *testing.T
+}
+
+func (c failingRorClient) V1() rorclient.V1Client {
+	return failingV1Client{t: c.t}
+}
+
+type failingV1Client struct {
+	rorclient.V1Client
+	t *testing.T
+}
+
+func (c failingV1Client) Resources() rorclient.V1ResourcesInterface { return nil }
+func (c failingV1Client) Clusters() rorclient.V1ClustersInterface   { return nil }
+
+func TestRorClient_RecordsWrites(t *testing.T) {
+	var out bytes.Buffer
+	client := NewRorClient(failingRorClient{t: t}, NewJSONLSink(&out))
+
+	tests := []struct {
+		name      string
+		call      func() error
+		operation string
+	}{
+		{
+			name: "Test dry-run create resource",
+			call: func() error {
+				return client.V1().Resources().Create(context.TODO(), &apiresourcecontracts.ResourceUpdateModel{Uid: "3c99c410-3cdd-11ee-be56-0242ac120002", Hash: "1234"})
+			},
+			operation: "v1.resources.create",
+		}, {
+			name: "Test dry-run delete resource",
+			call: func() error {
+				return client.V1().Resources().Delete(context.TODO(), "3c99c410-3cdd-11ee-be56-0242ac120002")
+			},
+			operation: "v1.resources.delete",
+		}, {
+			name: "Test dry-run heartbeat",
+			call: func() error {
+				return client.V1().Clusters().SendHeartbeat(context.TODO(), apicontracts.Cluster{})
+			},
+			operation: "v1.clusters.heartbeat",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			if err := tt.call(); err != nil {
+				t.Fatalf("call returned error %v", err)
+			}
+			var record Record
+			if err := json.Unmarshal(bytes.TrimSpace(out.Bytes()), &record); err != nil {
+				t.Fatalf("could not unmarshal record %q: %v", out.String(), err)
+			}
+			if record.Operation != tt.operation {
+				t.Errorf("record.Operation = %s, want %s", record.Operation, tt.operation)
+			}
+			if !strings.HasSuffix(out.String(), "\n") {
+				t.Errorf("record is not newline terminated")
+			}
+		})
+	}
+}
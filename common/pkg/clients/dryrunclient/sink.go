@@ -0,0 +1,69 @@
+package dryrunclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+)
+
+// Sink records the requests the agent would have sent to ror-api.
+type Sink interface {
+	Record(operation string, payload any) error
+}
+
+// Record is a single line written by the jsonl sink.
+type Record struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Payload   any       `json:"payload"`
+}
+
+type jsonlSink struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+// NewJSONLSink returns a sink writing one json object per line to w, it is safe for concurrent use.
+func NewJSONLSink(w io.Writer) Sink {
+	return &jsonlSink{writer: w}
+}
+
+func (s *jsonlSink) Record(operation string, payload any) error {
+	data, err := json.Marshal(Record{
+		Time:      time.Now(),
+		Operation: operation,
+		Payload:   payload,
+	})
+	if err != nil {
+		return fmt.Errorf("could not marshal dry-run record for %s: %w", operation, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.writer.Write(append(data, '\n'))
+	return err
+}
+
+// Enabled reports whether ROR_DRY_RUN is set.
+func Enabled() bool {
+	return rorconfig.GetBool(agentconsts.DryRunEnv)
+}
+
+// NewSinkFromConfig returns the sink selected by ROR_DRY_RUN_OUTPUT, either "stdout" or the path of a jsonl file.
+func NewSinkFromConfig() (Sink, error) {
+	output := rorconfig.GetString(agentconsts.DryRunOutputEnv)
+	if output == "" || output == "stdout" {
+		return NewJSONLSink(os.Stdout), nil
+	}
+	file, err := os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600) // #nosec G304 - path from agent configuration
+	if err != nil {
+		return nil, fmt.Errorf("could not open dry-run output %s: %w", output, err)
+	}
+	return NewJSONLSink(file), nil
+}
@@ -1,12 +1,21 @@
 package dynamicclient
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/watchconfig"
 	"github.com/NorskHelsenett/ror-agent/common/pkg/controllers/dynamiccontroller"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
+	"github.com/NorskHelsenett/ror/pkg/config/configconsts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 	"github.com/NorskHelsenett/ror/pkg/rorresources/rordefs"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 )
@@ -15,8 +24,17 @@ type DynamicClientHandler interface {
 	GetHandlersForSchema(schema schema.GroupVersionResource) dynamiccontroller.DynamicHandler
 }
 
-func MustStart(client clusteragentclient.RorAgentClientInterface, handler DynamicClientHandler, schemas ...schema.GroupVersionResource) {
-	rlog.Info("Starting dynamic watchers")
+// MustStart starts dynamic watchers for schemas, or the resource types in the watch config if no schemas are given.
+// If ROR_WATCH_CONFIG_MAP is set the watchers follow changes to the ConfigMap without restarting the agent,
+// and every ROR_DISCOVERY_POLL_INTERVAL_SECONDS watchers are started and stopped as resource types, like CRDs, come and go.
+// The watchers stop when ctx is canceled.
+func MustStart(ctx context.Context, client clusteragentclient.RorAgentClientInterface, handler DynamicClientHandler, schemas ...schema.GroupVersionResource) *Watchers {
+	return MustStartShard(ctx, client, handler, sharding.Shard{}, schemas...)
+}
+
+// MustStartShard is MustStart only watching the resource types, or sending the objects in the namespaces, of shard.
+func MustStartShard(ctx context.Context, client clusteragentclient.RorAgentClientInterface, handler DynamicClientHandler, shard sharding.Shard, schemas ...schema.GroupVersionResource) *Watchers {
+	rlog.Info("Starting dynamic watchers", rlog.String("shard", shard.String()))
 	dynamicClient, err := client.GetKubernetesClientset().GetDynamicClient()
 	if err != nil {
 		rlog.Fatal("failed to get dynamic client", err)
@@ -26,29 +44,123 @@ func MustStart(client clusteragentclient.RorAgentClientInterface, handler Dynami
 		rlog.Fatal("failed to get discovery client", err)
 	}
 
-	if len(schemas) == 0 {
-		schemas = getSchemas()
+	watchers := newWatchers(ctx, dynamicClient, discoveryClient, handler, shard, schemas)
+	if err := watchers.Apply(mustLoadWatchConfig(ctx, client)); err != nil {
+		rlog.Fatal("Could not query resources from cluster", err)
+	}
+
+	mayWatchConfigMap(client, watchers)
+	if interval := rorconfig.GetInt(agentconsts.DiscoveryPollIntervalSecondsEnv); interval > 0 {
+		go watchers.pollDiscovery(time.Duration(interval) * time.Second)
+	}
+	return watchers
+}
+
+func mustLoadWatchConfig(ctx context.Context, client clusteragentclient.RorAgentClientInterface) *watchconfig.Config {
+	configMapName := rorconfig.GetString(agentconsts.WatchConfigMapEnv)
+	if configMapName == "" {
+		return watchconfig.MustLoadFromConfig()
+	}
+	clientset, err := client.GetKubernetesClientset().GetKubernetesClientset()
+	if err != nil {
+		rlog.Fatal("failed to get kubernetes clientset", err)
+	}
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
+	watchConfig, err := watchconfig.LoadConfigMap(ctx, clientset, rorconfig.GetString(configconsts.POD_NAMESPACE), configMapName)
+	if err != nil {
+		rlog.Fatal("could not load watch config", err, rlog.String("configmap", configMapName))
+	}
+	return watchConfig
+}
+
+func mayWatchConfigMap(client clusteragentclient.RorAgentClientInterface, watchers *Watchers) {
+	configMapName := rorconfig.GetString(agentconsts.WatchConfigMapEnv)
+	if configMapName == "" {
+		return
+	}
+	clientset, err := client.GetKubernetesClientset().GetKubernetesClientset()
+	if err != nil {
+		rlog.Fatal("failed to get kubernetes clientset", err)
+	}
+	err = watchconfig.WatchConfigMap(watchers.ctx, clientset, rorconfig.GetString(configconsts.POD_NAMESPACE), configMapName, func(watchConfig *watchconfig.Config) {
+		if err := watchers.Apply(watchConfig); err != nil {
+			rlog.Error("could not apply watch config", err)
+		}
+	})
+	if err != nil {
+		rlog.Fatal("could not watch the watch config", err, rlog.String("configmap", configMapName))
+	}
+}
+
+// watchFilters returns the filters of the controllers watching gvr, one per namespace if the watch config lists namespaces.
+// Namespace filters are ignored for cluster scoped resources.
+// A shard sending its share of the namespaces watches every namespace, or the listed namespaces it owns, and only
+// the primary shard watches cluster scoped resources. No filters means gvr is not watched.
+func watchFilters(discoveryClient discovery.DiscoveryInterface, watchConfig *watchconfig.Config, gvr schema.GroupVersionResource, shard sharding.Shard) ([]dynamiccontroller.WatchFilter, error) {
+	configFilter, ok := watchConfig.FilterFor(gvr)
+	filter := dynamiccontroller.WatchFilter{
+		LabelSelector: configFilter.LabelSelector,
+		FieldSelector: configFilter.FieldSelector,
+	}
+	shardsNamespaces := shard.Enabled() && shard.Mode == sharding.ModeNamespaces
+	if !shardsNamespaces && (!ok || (len(configFilter.Namespaces) == 0 && len(configFilter.ExcludeNamespaces) == 0)) {
+		return []dynamiccontroller.WatchFilter{filter}, nil
+	}
+
+	namespaced, err := isNamespaced(discoveryClient, gvr)
+	if err != nil {
+		return nil, err
+	}
+	if !namespaced {
+		if !shard.OwnsNamespace("") {
+			return nil, nil
+		}
+		return []dynamiccontroller.WatchFilter{filter}, nil
 	}
 
-	for _, schema := range schemas {
-		check, err := discovery.IsResourceEnabled(discoveryClient, schema)
-		if err != nil {
-			rlog.Fatal("Could not query resources from cluster", err)
+	if len(configFilter.ExcludeNamespaces) > 0 {
+		selectors := make([]fields.Selector, 0, len(configFilter.ExcludeNamespaces)+1)
+		if filter.FieldSelector != "" {
+			selector, err := fields.ParseSelector(filter.FieldSelector)
+			if err != nil {
+				return nil, err
+			}
+			selectors = append(selectors, selector)
+		}
+		for _, namespace := range configFilter.ExcludeNamespaces {
+			selectors = append(selectors, fields.OneTermNotEqualSelector("metadata.namespace", namespace))
 		}
-		if check {
-			controller := dynamiccontroller.NewDynamicController(dynamicClient, handler.GetHandlersForSchema(schema))
-
-			go func() {
-				controller.Run(client.GetStopChan())
-				sig := <-client.GetSigs()
-				fmt.Println(sig)
-				client.GetStopChan() <- struct{}{}
-			}()
-		} else {
-			errmsg := fmt.Sprintf("Could not register resource %s", schema.Resource)
-			rlog.Warn(errmsg)
+		filter.FieldSelector = fields.AndSelectors(selectors...).String()
+		return []dynamiccontroller.WatchFilter{filter}, nil
+	}
+
+	if len(configFilter.Namespaces) == 0 {
+		return []dynamiccontroller.WatchFilter{filter}, nil
+	}
+	filters := make([]dynamiccontroller.WatchFilter, 0, len(configFilter.Namespaces))
+	for _, namespace := range configFilter.Namespaces {
+		if !shard.OwnsNamespace(namespace) {
+			continue
+		}
+		namespaceFilter := filter
+		namespaceFilter.Namespace = namespace
+		filters = append(filters, namespaceFilter)
+	}
+	return filters, nil
+}
+
+func isNamespaced(discoveryClient discovery.DiscoveryInterface, gvr schema.GroupVersionResource) (bool, error) {
+	resources, err := discoveryClient.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false, err
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == gvr.Resource {
+			return resource.Namespaced, nil
 		}
 	}
+	return false, fmt.Errorf("resource %s not found in discovery", gvr.String())
 }
 
 func getSchemas() []schema.GroupVersionResource {
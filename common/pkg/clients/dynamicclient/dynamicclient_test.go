@@ -0,0 +1,516 @@
+package dynamicclient
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/watchconfig"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/controllers/dynamiccontroller"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func Test_watchFilters(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Namespaced: true},
+				{Name: "nodes", Namespaced: false},
+			},
+		},
+	}}}
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	nodes := schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	shard := sharding.Shard{Index: 1, Count: 2, Mode: sharding.ModeNamespaces}
+	var owned, other []string
+	for i := 0; len(owned) < 2 || len(other) < 1; i++ {
+		namespace := "namespace-" + strconv.Itoa(i)
+		if shard.OwnsNamespace(namespace) {
+			owned = append(owned, namespace)
+		} else {
+			other = append(other, namespace)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		config watchconfig.Config
+		gvr    schema.GroupVersionResource
+		shard  sharding.Shard
+		want   []dynamiccontroller.WatchFilter
+	}{
+		{
+			name: "Test no matching filter",
+			config: watchconfig.Config{Filters: []watchconfig.Filter{
+				{ResourceType: watchconfig.ResourceType{Resource: "deployments"}, LabelSelector: "app=test"},
+			}},
+			gvr:  pods,
+			want: []dynamiccontroller.WatchFilter{{}},
+		}, {
+			name: "Test selectors",
+			config: watchconfig.Config{Filters: []watchconfig.Filter{
+				{ResourceType: watchconfig.ResourceType{Resource: "pods"}, LabelSelector: "app=test", FieldSelector: "status.phase=Running"},
+			}},
+			gvr:  pods,
+			want: []dynamiccontroller.WatchFilter{{LabelSelector: "app=test", FieldSelector: "status.phase=Running"}},
+		}, {
+			name: "Test namespaces",
+			config: watchconfig.Config{Filters: []watchconfig.Filter{
+				{Namespaces: []string{"team-a", "team-b"}, LabelSelector: "app=test"},
+			}},
+			gvr: pods,
+			want: []dynamiccontroller.WatchFilter{
+				{Namespace: "team-a", LabelSelector: "app=test"},
+				{Namespace: "team-b", LabelSelector: "app=test"},
+			},
+		}, {
+			name: "Test exclude namespaces",
+			config: watchconfig.Config{Filters: []watchconfig.Filter{
+				{ExcludeNamespaces: []string{"kube-system", "tenant"}, FieldSelector: "status.phase=Running"},
+			}},
+			gvr:  pods,
+			want: []dynamiccontroller.WatchFilter{{FieldSelector: "status.phase=Running,metadata.namespace!=kube-system,metadata.namespace!=tenant"}},
+		}, {
+			name: "Test namespaces ignored for cluster scoped resources",
+			config: watchconfig.Config{Filters: []watchconfig.Filter{
+				{Namespaces: []string{"team-a"}},
+			}},
+			gvr:  nodes,
+			want: []dynamiccontroller.WatchFilter{{}},
+		}, {
+			name:  "Test namespace shard watches every namespace",
+			gvr:   pods,
+			shard: shard,
+			want:  []dynamiccontroller.WatchFilter{{}},
+		}, {
+			name: "Test namespace shard watches the listed namespaces it owns",
+			config: watchconfig.Config{Filters: []watchconfig.Filter{
+				{Namespaces: []string{owned[0], other[0]}, LabelSelector: "app=test"},
+			}},
+			gvr:   pods,
+			shard: shard,
+			want:  []dynamiccontroller.WatchFilter{{Namespace: owned[0], LabelSelector: "app=test"}},
+		}, {
+			name: "Test namespace shard excluding namespaces",
+			config: watchconfig.Config{Filters: []watchconfig.Filter{
+				{ExcludeNamespaces: []string{owned[0]}},
+			}},
+			gvr:   pods,
+			shard: shard,
+			want:  []dynamiccontroller.WatchFilter{{FieldSelector: "metadata.namespace!=" + owned[0]}},
+		}, {
+			name:  "Test namespace shard does not watch cluster scoped resources",
+			gvr:   nodes,
+			shard: shard,
+			want:  nil,
+		}, {
+			name:  "Test primary namespace shard watches cluster scoped resources",
+			gvr:   nodes,
+			shard: sharding.Shard{Index: 0, Count: 2, Mode: sharding.ModeNamespaces},
+			want:  []dynamiccontroller.WatchFilter{{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := watchFilters(discoveryClient, &tt.config, tt.gvr, tt.shard)
+			if err != nil {
+				t.Fatalf("watchFilters() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("watchFilters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeSchemaHandler struct {
+	schema schema.GroupVersionResource
+}
+
+func (h fakeSchemaHandler) GetSchema() schema.GroupVersionResource {
+	return h.schema
+}
+
+func (h fakeSchemaHandler) GetHandlers() dynamiccontroller.Resourcehandlers {
+	return dynamiccontroller.Resourcehandlers{}
+}
+
+type fakeHandler struct{}
+
+func (fakeHandler) GetHandlersForSchema(schema schema.GroupVersionResource) dynamiccontroller.DynamicHandler {
+	return fakeSchemaHandler{schema: schema}
+}
+
+func TestWatchers_Apply(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Namespaced: true},
+				{Name: "nodes", Namespaced: false},
+			},
+		},
+	}}}
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	nodes := schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	dynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		pods:  "PodList",
+		nodes: "NodeList",
+	})
+	watchers := newWatchers(context.Background(), dynamicClient, discoveryClient, fakeHandler{}, sharding.Shard{}, nil)
+	defer watchers.Stop()
+
+	apply := func(data string) map[schema.GroupVersionResource]*watcher {
+		t.Helper()
+		cfg, err := watchconfig.Parse([]byte(data))
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if err := watchers.Apply(cfg); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		return maps.Clone(watchers.running)
+	}
+
+	running := apply("resources:\n  - {version: v1, resource: pods}\n  - {version: v1, resource: nodes}\n  - {group: example.com, version: v1, resource: widgets}\n")
+	if len(running) != 2 || running[pods] == nil || running[nodes] == nil {
+		t.Fatalf("Apply() running = %v, want pods and nodes", running)
+	}
+
+	unchanged := apply("resources:\n  - {version: v1, resource: pods}\n  - {version: v1, resource: nodes}\n")
+	if unchanged[pods] != running[pods] || unchanged[nodes] != running[nodes] {
+		t.Errorf("Apply() restarted watchers without config changes")
+	}
+
+	if running[pods].controllers[dynamiccontroller.WatchFilter{}] == nil {
+		t.Fatalf("Apply() started no pods controller watching every namespace")
+	}
+	nodesController := running[nodes].controllers[dynamiccontroller.WatchFilter{}]
+	filtered := apply("resources:\n  - {version: v1, resource: pods}\n  - {version: v1, resource: nodes}\nfilters:\n  - {resource: pods, namespaces: [a, b]}\n")
+	if len(filtered[pods].controllers) != 2 || filtered[pods].controllers[dynamiccontroller.WatchFilter{Namespace: "a"}] == nil {
+		t.Errorf("Apply() did not start one pods controller per namespace")
+	}
+	if _, ok := filtered[pods].controllers[dynamiccontroller.WatchFilter{}]; ok {
+		t.Errorf("Apply() did not stop the pods controller watching every namespace")
+	}
+	if filtered[nodes].controllers[dynamiccontroller.WatchFilter{}] != nodesController {
+		t.Errorf("Apply() restarted the nodes controller")
+	}
+
+	namespaceA := filtered[pods].controllers[dynamiccontroller.WatchFilter{Namespace: "a"}]
+	narrowed := apply("resources:\n  - {version: v1, resource: pods}\n  - {version: v1, resource: nodes}\nfilters:\n  - {resource: pods, namespaces: [a]}\n")
+	if len(narrowed[pods].controllers) != 1 || narrowed[pods].controllers[dynamiccontroller.WatchFilter{Namespace: "a"}] != namespaceA {
+		t.Errorf("Apply() restarted the controller of an unchanged namespace")
+	}
+
+	removed := apply("resources:\n  - {version: v1, resource: pods}\n  - {version: v1, resource: nodes}\ndisabledResources:\n  - resource: nodes\n")
+	if _, ok := removed[nodes]; ok {
+		t.Errorf("Apply() did not stop the nodes watcher")
+	}
+
+	watchers.Stop()
+	if len(watchers.running) != 0 {
+		t.Errorf("Stop() left %d watchers running", len(watchers.running))
+	}
+	if err := watchers.Apply(&watchconfig.Config{}); err != nil || len(watchers.running) != 0 {
+		t.Errorf("Apply() after Stop() started watchers")
+	}
+}
+
+func TestWatchers_Refresh(t *testing.T) {
+	coreResources := &metav1.APIResourceList{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "pods", Namespaced: true}},
+	}
+	widgetResources := &metav1.APIResourceList{
+		GroupVersion: "example.com/v1",
+		APIResources: []metav1.APIResource{{Name: "widgets", Namespaced: true}},
+	}
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{coreResources}}}
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	widgets := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.com/v1")
+	widget.SetKind("Widget")
+	widget.SetNamespace("default")
+	widget.SetName("a")
+	widget.SetUID("3c99c410-3cdd-11ee-be56-0242ac120002")
+	dynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		pods:    "PodList",
+		widgets: "WidgetList",
+	}, widget)
+	handler := deletesHandler{deleted: make(chan string, 10)}
+	watchers := newWatchers(context.Background(), dynamicClient, discoveryClient, handler, sharding.Shard{}, []schema.GroupVersionResource{pods, widgets})
+	defer watchers.Stop()
+
+	if err := watchers.Apply(&watchconfig.Config{}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(watchers.running) != 1 || !watchers.unavailable[widgets] {
+		t.Fatalf("Apply() running = %v, want only pods", watchers.running)
+	}
+
+	discoveryClient.Resources = []*metav1.APIResourceList{coreResources, widgetResources}
+	if err := watchers.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if watchers.running[widgets] == nil {
+		t.Fatalf("Refresh() did not start the widgets watcher after the crd was installed")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !watchers.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the watchers to sync")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	discoveryClient.Resources = []*metav1.APIResourceList{coreResources}
+	if err := watchers.Refresh(); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if _, ok := watchers.running[widgets]; ok || watchers.running[pods] == nil {
+		t.Errorf("Refresh() running = %v, want only pods after the crd was removed", watchers.running)
+	}
+	select {
+	case uid := <-handler.deleted:
+		if uid != string(widget.GetUID()) {
+			t.Errorf("deleted %q, want %q", uid, widget.GetUID())
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("no delete sent for the widget after the crd was removed")
+	}
+}
+
+func TestWatchers_Apply_namespaceShard(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "pods", Namespaced: true}, {Name: "nodes", Namespaced: false}},
+		},
+	}}}
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	nodes := schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	shard := sharding.Shard{Index: 1, Count: 2, Mode: sharding.ModeNamespaces}
+	var owned, other string
+	for i := 0; owned == "" || other == ""; i++ {
+		if namespace := "namespace-" + strconv.Itoa(i); shard.OwnsNamespace(namespace) {
+			owned = namespace
+		} else {
+			other = namespace
+		}
+	}
+	newPod := func(namespace, name string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("Pod")
+		u.SetNamespace(namespace)
+		u.SetName(name)
+		u.SetUID(types.UID(namespace + "/" + name))
+		return u
+	}
+	dynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		pods:  "PodList",
+		nodes: "NodeList",
+	}, newPod(owned, "owned"), newPod(other, "other"))
+	var mu sync.Mutex
+	var sent []string
+	watchers := newWatchers(context.Background(), dynamicClient, discoveryClient, recordingHandler{mu: &mu, sent: &sent}, shard, []schema.GroupVersionResource{pods, nodes})
+	defer watchers.Stop()
+
+	if err := watchers.Apply(&watchconfig.Config{}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if _, ok := watchers.running[nodes]; ok {
+		t.Errorf("Apply() started a nodes watcher on a shard not sending cluster scoped objects")
+	}
+	if got := watchers.running[pods]; got == nil || len(got.controllers) != 1 || got.controllers[dynamiccontroller.WatchFilter{}] == nil {
+		t.Fatalf("Apply() running = %v, want one pods controller for every namespace", watchers.running)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !watchers.HasSynced() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the watchers to sync")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"owned"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+}
+
+// recordingHandler records the names of the objects passed to its handlers.
+type recordingHandler struct {
+	mu   *sync.Mutex
+	sent *[]string
+}
+
+func (h recordingHandler) GetHandlersForSchema(schema schema.GroupVersionResource) dynamiccontroller.DynamicHandler {
+	return recordingSchemaHandler{fakeSchemaHandler: fakeSchemaHandler{schema: schema}, mu: h.mu, sent: h.sent}
+}
+
+// recordingSchemaHandler records the names of the objects passed to its handlers.
+type recordingSchemaHandler struct {
+	fakeSchemaHandler
+	mu   *sync.Mutex
+	sent *[]string
+}
+
+func (h recordingSchemaHandler) GetHandlers() dynamiccontroller.Resourcehandlers {
+	record := func(name string) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		*h.sent = append(*h.sent, name)
+	}
+	return dynamiccontroller.Resourcehandlers{
+		AddFunc: func(obj any) {
+			u, _ := dynamiccontroller.DeletedObject(obj)
+			record(u.GetName())
+		},
+		DeleteFunc: func(obj any) {
+			u, _ := dynamiccontroller.DeletedObject(obj)
+			record("delete " + string(u.GetUID()))
+		},
+	}
+}
+
+func Test_shardHandler(t *testing.T) {
+	shard := sharding.Shard{Index: 1, Count: 2, Mode: sharding.ModeNamespaces}
+	var owned, other string
+	for i := 0; owned == "" || other == ""; i++ {
+		namespace := "namespace-" + strconv.Itoa(i)
+		if shard.OwnsNamespace(namespace) {
+			owned = namespace
+		} else {
+			other = namespace
+		}
+	}
+	object := func(namespace string, name string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetNamespace(namespace)
+		u.SetName(name)
+		return u
+	}
+	tombstone := &unstructured.Unstructured{}
+	tombstone.SetUID("3c99c410-3cdd-11ee-be56-0242ac120002")
+
+	var sent []string
+	handlers := shardHandler{DynamicHandler: recordingSchemaHandler{mu: &sync.Mutex{}, sent: &sent}, shard: shard}.GetHandlers()
+	handlers.OnAdd(object(owned, "owned"), true)
+	handlers.OnAdd(object(other, "other"), true)
+	handlers.OnAdd(object("", "clusterscoped"), true)
+	handlers.OnDelete(cache.DeletedFinalStateUnknown{Key: string(tombstone.GetUID()), Obj: tombstone})
+
+	want := []string{"owned", "delete 3c99c410-3cdd-11ee-be56-0242ac120002"}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+}
+
+// deletesHandler sends the uids of the objects passed to its delete handlers on deleted.
+type deletesHandler struct {
+	deleted chan string
+}
+
+func (h deletesHandler) GetHandlersForSchema(schema schema.GroupVersionResource) dynamiccontroller.DynamicHandler {
+	return deletesSchemaHandler{fakeSchemaHandler: fakeSchemaHandler{schema: schema}, deleted: h.deleted}
+}
+
+type deletesSchemaHandler struct {
+	fakeSchemaHandler
+	deleted chan string
+}
+
+func (h deletesSchemaHandler) GetHandlers() dynamiccontroller.Resourcehandlers {
+	return dynamiccontroller.Resourcehandlers{
+		DeleteFunc: func(obj any) {
+			u, _ := dynamiccontroller.DeletedObject(obj)
+			h.deleted <- string(u.GetUID())
+		},
+	}
+}
+
+func TestWatchers_Apply_deletesRemoved(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "pods", Namespaced: true}, {Name: "nodes", Namespaced: false}},
+		},
+	}}}
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	nodes := schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace("default")
+	pod.SetName("a")
+	pod.SetUID("3c99c410-3cdd-11ee-be56-0242ac120002")
+	dynamicClient := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		pods:  "PodList",
+		nodes: "NodeList",
+	}, pod)
+	handler := deletesHandler{deleted: make(chan string, 10)}
+	watchers := newWatchers(context.Background(), dynamicClient, discoveryClient, handler, sharding.Shard{}, nil)
+	defer watchers.Stop()
+
+	apply := func(data string) {
+		t.Helper()
+		cfg, err := watchconfig.Parse([]byte(data))
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if err := watchers.Apply(cfg); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+	}
+	waitForSync := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !watchers.HasSynced() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for the watchers to sync")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	apply("resources:\n  - {version: v1, resource: pods}\n  - {version: v1, resource: nodes}\n")
+	waitForSync()
+
+	// a changed filter restarts the watcher, the objects are still watched
+	apply("resources:\n  - {version: v1, resource: pods}\n  - {version: v1, resource: nodes}\nfilters:\n  - {resource: pods, namespaces: [default]}\n")
+	waitForSync()
+
+	apply("resources:\n  - {version: v1, resource: nodes}\n")
+	select {
+	case uid := <-handler.deleted:
+		if uid != string(pod.GetUID()) {
+			t.Errorf("deleted %q, want %q", uid, pod.GetUID())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no delete sent for the pod after pods were removed from the watch config")
+	}
+	select {
+	case uid := <-handler.deleted:
+		t.Errorf("unexpected delete of %q", uid)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,383 @@
+package dynamicclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/watchconfig"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/controllers/dynamiccontroller"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// Watchers are the dynamic controllers started by MustStart.
+// Apply starts and stops controllers when the watch config changes, Refresh when resource types are added to or removed from the cluster.
+type Watchers struct {
+	mu              sync.Mutex
+	dynamicClient   dynamic.Interface
+	discoveryClient discovery.DiscoveryInterface
+	handler         DynamicClientHandler
+	// shard selects the resource types watched, or the namespaces of the objects sent to the handler
+	shard sharding.Shard
+	// schemas are the resource types passed to MustStart, the watch config decides when empty
+	schemas []schema.GroupVersionResource
+	running map[schema.GroupVersionResource]*watcher
+	// config is the last applied watch config
+	config *watchconfig.Config
+	// unavailable are the configured resource types missing from the cluster at the last Apply
+	unavailable map[schema.GroupVersionResource]bool
+	stopped     bool
+	// ctx is canceled by Stop, or when the context passed to MustStart is canceled
+	ctx    context.Context
+	cancel context.CancelFunc
+	// maxIdle is how long a watch may go without activity before the liveness check fails, 0 disables the check
+	maxIdle time.Duration
+}
+
+// watcher holds the controllers watching one resource type by their filter, one per namespace if the watch config
+// lists namespaces.
+type watcher struct {
+	// mu guards controllers, the health checks read them while Apply updates them
+	mu          sync.Mutex
+	controllers map[dynamiccontroller.WatchFilter]*runningController
+}
+
+// runningController is a started dynamic controller, stopped by cancel.
+type runningController struct {
+	*dynamiccontroller.DynamicController
+	cancel context.CancelFunc
+}
+
+func newWatchers(ctx context.Context, dynamicClient dynamic.Interface, discoveryClient discovery.DiscoveryInterface, handler DynamicClientHandler, shard sharding.Shard, schemas []schema.GroupVersionResource) *Watchers {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Watchers{
+		dynamicClient:   dynamicClient,
+		discoveryClient: discoveryClient,
+		handler:         handler,
+		shard:           shard,
+		schemas:         schemas,
+		running:         make(map[schema.GroupVersionResource]*watcher),
+		config:          &watchconfig.Config{},
+		unavailable:     make(map[schema.GroupVersionResource]bool),
+		ctx:             ctx,
+		cancel:          cancel,
+		maxIdle:         time.Duration(rorconfig.GetInt(agentconsts.HealthWatchMaxIdleSecondsEnv)) * time.Second,
+	}
+}
+
+// HasSynced reports whether every watcher has completed its initial list, or its last resync.
+func (w *Watchers) HasSynced() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, running := range w.running {
+		for _, controller := range running.controllers {
+			if !controller.HasSynced() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Resync makes every watcher send all existing objects to its handlers again.
+func (w *Watchers) Resync() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, running := range w.running {
+		for _, controller := range running.controllers {
+			controller.Resync()
+		}
+	}
+}
+
+// Apply starts watchers for the resource types in watchConfig that are available in the cluster,
+// starts and stops the controllers of watchers whose filters changed and stops watchers for resource types no longer configured, sending deletes for their objects.
+// A watcher is left as is if discovery fails for its resource type, the errors are returned.
+func (w *Watchers) Apply(watchConfig *watchconfig.Config) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.apply(watchConfig)
+}
+
+// Refresh applies the last watch config again, starting watchers for resource types installed since the last Apply
+// and stopping watchers for resource types removed from the cluster, sending deletes for their objects.
+func (w *Watchers) Refresh() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.apply(w.config)
+}
+
+func (w *Watchers) apply(watchConfig *watchconfig.Config) error {
+	if w.stopped {
+		return nil
+	}
+	w.config = watchConfig
+
+	schemas := w.schemas
+	if len(schemas) == 0 {
+		schemas = watchConfig.Schemas(getSchemas())
+	}
+
+	var errs []error
+	changed := false
+	unavailable := make(map[schema.GroupVersionResource]bool)
+	wanted := make(map[schema.GroupVersionResource]bool, len(schemas))
+	for _, gvr := range schemas {
+		if !w.shard.OwnsResource(gvr) {
+			continue
+		}
+		check, err := discovery.IsResourceEnabled(w.discoveryClient, gvr)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", gvr.String(), err))
+			wanted[gvr] = true
+			continue
+		}
+		if !check {
+			if !w.unavailable[gvr] {
+				errmsg := fmt.Sprintf("Could not register resource %s", gvr.Resource)
+				rlog.Warn(errmsg, rlog.String("gvr", gvr.String()))
+			}
+			unavailable[gvr] = true
+			continue
+		}
+		filters, err := watchFilters(w.discoveryClient, watchConfig, gvr, w.shard)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", gvr.String(), err))
+			wanted[gvr] = true
+			continue
+		}
+		if len(filters) == 0 {
+			// none of the listed namespaces of the shard, or cluster scoped objects not sent by the shard
+			continue
+		}
+
+		wanted[gvr] = true
+		if running, ok := w.running[gvr]; ok {
+			if w.updateWatcher(gvr, running, filters) {
+				changed = true
+			}
+			continue
+		}
+		w.startWatcher(gvr, filters)
+		changed = true
+	}
+
+	for gvr := range w.running {
+		if !wanted[gvr] {
+			// objects of resource types removed from the watch config or from the cluster are deleted,
+			// they would otherwise stay in ror
+			w.stopWatcher(gvr, true)
+			changed = true
+		}
+	}
+	w.unavailable = unavailable
+
+	if changed {
+		rlog.Info("Dynamic watchers updated", rlog.Int("resources", len(w.running)), rlog.Int("unavailable", len(unavailable)))
+	}
+	return errors.Join(errs...)
+}
+
+// pollDiscovery calls Refresh every interval until the watchers are stopped.
+func (w *Watchers) pollDiscovery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.Refresh(); err != nil {
+				rlog.Error("could not refresh dynamic watchers from discovery", err)
+			}
+		}
+	}
+}
+
+// Stop stops every watcher, Apply does nothing after Stop.
+func (w *Watchers) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	w.stopped = true
+	for gvr := range w.running {
+		w.stopWatcher(gvr, false)
+	}
+	w.cancel()
+}
+
+func (w *Watchers) startWatcher(gvr schema.GroupVersionResource, filters []dynamiccontroller.WatchFilter) {
+	running := &watcher{controllers: make(map[dynamiccontroller.WatchFilter]*runningController, len(filters))}
+	w.updateWatcher(gvr, running, filters)
+	w.running[gvr] = running
+	w.registerHealthChecks(gvr, running)
+	rlog.Info("Dynamic watcher started", rlog.String("gvr", gvr.String()), rlog.Any("filters", filters))
+}
+
+// updateWatcher starts a controller for every filter not yet watched and stops the controllers of the filters
+// no longer wanted, the controllers of unchanged filters keep running. It reports whether any controller was started or stopped.
+// A stopped controller sends deletes for its objects when no other filter watches its namespace, like a namespace
+// removed from the watch config. Selector changes only restart the controller, its objects are
+// listed again by the new one.
+func (w *Watchers) updateWatcher(gvr schema.GroupVersionResource, running *watcher, filters []dynamiccontroller.WatchFilter) bool {
+	running.mu.Lock()
+	defer running.mu.Unlock()
+	changed := false
+	var removed []*runningController
+	for filter, controller := range running.controllers {
+		if slices.Contains(filters, filter) {
+			continue
+		}
+		controller.cancel()
+		delete(running.controllers, filter)
+		if !watchesNamespace(filters, filter.Namespace) {
+			removed = append(removed, controller)
+		}
+		changed = true
+	}
+	if len(removed) > 0 {
+		go deleteAll(gvr, removed)
+	}
+
+	var handler dynamiccontroller.DynamicHandler = w.handler.GetHandlersForSchema(gvr)
+	if w.shard.Enabled() && w.shard.Mode == sharding.ModeNamespaces {
+		handler = shardHandler{DynamicHandler: handler, shard: w.shard}
+	}
+	for _, filter := range filters {
+		if _, ok := running.controllers[filter]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(w.ctx)
+		controller := dynamiccontroller.NewFilteredDynamicController(w.dynamicClient, handler, filter)
+		controller.Run(ctx)
+		running.controllers[filter] = &runningController{DynamicController: controller, cancel: cancel}
+		changed = true
+	}
+	return changed
+}
+
+// watchesNamespace reports whether one of filters watches namespace, empty for every namespace.
+func watchesNamespace(filters []dynamiccontroller.WatchFilter, namespace string) bool {
+	if namespace == "" {
+		return true
+	}
+	return slices.ContainsFunc(filters, func(filter dynamiccontroller.WatchFilter) bool {
+		return filter.Namespace == "" || filter.Namespace == namespace
+	})
+}
+
+// stopWatcher stops the watcher of gvr, with deleteObjects its controllers then send a delete for every object they know.
+func (w *Watchers) stopWatcher(gvr schema.GroupVersionResource, deleteObjects bool) {
+	running, ok := w.running[gvr]
+	if !ok {
+		return
+	}
+	running.mu.Lock()
+	controllers := make([]*runningController, 0, len(running.controllers))
+	for _, controller := range running.controllers {
+		controller.cancel()
+		controllers = append(controllers, controller)
+	}
+	running.mu.Unlock()
+	delete(w.running, gvr)
+	healthservice.UnregisterCheck(watchCheckName(gvr))
+	healthservice.UnregisterCheck(initialListCheckName(gvr))
+	rlog.Info("Dynamic watcher stopped", rlog.String("gvr", gvr.String()))
+	if deleteObjects {
+		go deleteAll(gvr, controllers)
+	}
+}
+
+// deleteAll sends a delete for every object known by the stopped controllers.
+func deleteAll(gvr schema.GroupVersionResource, controllers []*runningController) {
+	deleted := 0
+	for _, controller := range controllers {
+		deleted += controller.DeleteAll()
+	}
+	rlog.Info("Deletes sent for the objects no longer watched", rlog.String("gvr", gvr.String()), rlog.Int("objects", deleted))
+}
+
+// shardHandler only passes on the events of objects in the namespaces of the shard. Deletes without the object,
+// known only by uid, are passed on by every shard.
+type shardHandler struct {
+	dynamiccontroller.DynamicHandler
+	shard sharding.Shard
+}
+
+func (h shardHandler) GetHandlers() dynamiccontroller.Resourcehandlers {
+	handlers := h.DynamicHandler.GetHandlers()
+	return dynamiccontroller.Resourcehandlers{
+		AddFunc: func(obj any) {
+			if h.owns(obj) {
+				handlers.OnAdd(obj, false)
+			}
+		},
+		UpdateFunc: func(oldObj, obj any) {
+			if h.owns(obj) {
+				handlers.OnUpdate(oldObj, obj)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if h.owns(obj) {
+				handlers.OnDelete(obj)
+			}
+		},
+	}
+}
+
+func (h shardHandler) owns(obj any) bool {
+	u, ok := dynamiccontroller.DeletedObject(obj)
+	if !ok || u.GetName() == "" {
+		return true
+	}
+	return h.shard.OwnsNamespace(u.GetNamespace())
+}
+
+func watchCheckName(gvr schema.GroupVersionResource) string {
+	return "watch:" + gvr.GroupResource().String()
+}
+
+func initialListCheckName(gvr schema.GroupVersionResource) string {
+	return "initialList:" + gvr.GroupResource().String()
+}
+
+// registerHealthChecks registers a liveness check failing when a controller of the watcher has stopped watching,
+// and a readiness check failing until every controller has completed its initial list.
+func (w *Watchers) registerHealthChecks(gvr schema.GroupVersionResource, running *watcher) {
+	if w.maxIdle > 0 {
+		healthservice.RegisterLivenessCheck(watchCheckName(gvr), func() healthservice.CheckResult {
+			running.mu.Lock()
+			defer running.mu.Unlock()
+			for _, controller := range running.controllers {
+				if !controller.WatchAlive(w.maxIdle) {
+					return healthservice.CheckResult{Status: healthservice.StatusFail, Output: fmt.Sprintf("no watch activity within %s", w.maxIdle)}
+				}
+			}
+			return healthservice.CheckResult{Status: healthservice.StatusPass}
+		})
+	}
+	healthservice.RegisterReadinessCheck(initialListCheckName(gvr), func() healthservice.CheckResult {
+		running.mu.Lock()
+		defer running.mu.Unlock()
+		for _, controller := range running.controllers {
+			if !controller.InitialListDone() {
+				return healthservice.CheckResult{Status: healthservice.StatusFail, Output: "initial list not complete"}
+			}
+		}
+		return healthservice.CheckResult{Status: healthservice.StatusPass}
+	})
+}
@@ -2,7 +2,44 @@ package agentconsts
 
 const (
 	DynamicWatchNoCacheEnv                 = "ROR_DYNAMIC_WATCH_NO_CACHE"
+	DynamicWatchListEnv                    = "ROR_DYNAMIC_WATCH_LIST"
+	DynamicWatchListTimeoutSecondsEnv      = "ROR_DYNAMIC_WATCH_LIST_TIMEOUT_SECONDS"
+	DynamicWatchWorkersEnv                 = "ROR_DYNAMIC_WATCH_WORKERS"
+	DynamicWatchQPSEnv                     = "ROR_DYNAMIC_WATCH_QPS"
+	DynamicWatchBurstEnv                   = "ROR_DYNAMIC_WATCH_BURST"
 	ForceGCAfterInitialListEnv             = "ROR_FORCE_GC_AFTER_INITIAL_LIST"
 	ForceGCAfterInitialListFreeOSMemoryEnv = "ROR_FORCE_GC_AFTER_INITIAL_LIST_FREE_OS_MEMORY"
 	PrometheusURLEnv                       = "PROMETHEUS_URL"
+	AgentHealthEndpointEnv                 = "ROR_AGENT_HEALTH_ENDPOINT"
+	MetricsEndpointEnv                     = "ROR_METRICS_ENDPOINT"
+	DryRunEnv                              = "ROR_DRY_RUN"
+	DryRunOutputEnv                        = "ROR_DRY_RUN_OUTPUT"
+	RedactDropFieldsEnv                    = "ROR_REDACT_DROP_FIELDS"
+	RedactMaskFieldsEnv                    = "ROR_REDACT_MASK_FIELDS"
+	RedactAnnotationsEnv                   = "ROR_REDACT_ANNOTATIONS"
+	WatchConfigFileEnv                     = "ROR_WATCH_CONFIG_FILE"
+	WatchConfigMapEnv                      = "ROR_WATCH_CONFIG_MAP"
+	DiscoveryPollIntervalSecondsEnv        = "ROR_DISCOVERY_POLL_INTERVAL_SECONDS"
+	ShutdownTimeoutSecondsEnv              = "ROR_SHUTDOWN_TIMEOUT_SECONDS"
+	RorApiTimeoutSecondsEnv                = "ROR_API_TIMEOUT_SECONDS"
+	KubernetesTimeoutSecondsEnv            = "ROR_KUBERNETES_TIMEOUT_SECONDS"
+	HealthWatchMaxIdleSecondsEnv           = "ROR_HEALTH_WATCH_MAX_IDLE_SECONDS"
+	HealthMaxReportAgeSecondsEnv           = "ROR_HEALTH_MAX_REPORT_AGE_SECONDS"
+	LeaderElectionEnv                      = "ROR_LEADER_ELECTION"
+	LeaderElectionLeaseNameEnv             = "ROR_LEADER_ELECTION_LEASE_NAME"
+	LeaderElectionLeaseDurationSecondsEnv  = "ROR_LEADER_ELECTION_LEASE_DURATION_SECONDS"
+	LeaderElectionRenewDeadlineSecondsEnv  = "ROR_LEADER_ELECTION_RENEW_DEADLINE_SECONDS"
+	LeaderElectionRetryPeriodSecondsEnv    = "ROR_LEADER_ELECTION_RETRY_PERIOD_SECONDS"
+	ShardCountEnv                          = "ROR_SHARD_COUNT"
+	ShardModeEnv                           = "ROR_SHARD_MODE"
+	ShardIndexEnv                          = "ROR_SHARD_INDEX"
+	EventFeedEnv                           = "ROR_EVENT_FEED"
+	EventFeedTypesEnv                      = "ROR_EVENT_FEED_TYPES"
+	EventFeedReasonsEnv                    = "ROR_EVENT_FEED_REASONS"
+	EventFeedNamespacesEnv                 = "ROR_EVENT_FEED_NAMESPACES"
+	EventFeedDedupeSecondsEnv              = "ROR_EVENT_FEED_DEDUPE_SECONDS"
+	EventFeedQPSEnv                        = "ROR_EVENT_FEED_QPS"
+	EventFeedBurstEnv                      = "ROR_EVENT_FEED_BURST"
+	ApiKeyCheckIntervalSecondsEnv          = "ROR_API_KEY_CHECK_INTERVAL_SECONDS"
+	ApiKeyReregisterAfterEnv               = "ROR_API_KEY_REREGISTER_AFTER"
 )
@@ -0,0 +1,82 @@
+package watchconfig
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ConfigMapKey is the key holding the watch config in the ConfigMap named by ROR_WATCH_CONFIG_MAP.
+const ConfigMapKey = "config.yaml"
+
+// LoadConfigMap reads the watch config from a ConfigMap, an empty config is returned if the ConfigMap does not exist.
+func LoadConfigMap(ctx context.Context, clientset kubernetes.Interface, namespace string, name string) (*Config, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromConfigMap(configMap)
+}
+
+// WatchConfigMap calls onChange with the new watch config every time the ConfigMap changes, until ctx is canceled.
+// A deleted ConfigMap gives an empty config, invalid configs are logged and ignored.
+func WatchConfigMap(ctx context.Context, clientset kubernetes.Interface, namespace string, name string, onChange func(*Config)) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+
+	changed := func(obj any) {
+		configMap, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		cfg, err := fromConfigMap(configMap)
+		if err != nil {
+			rlog.Error("invalid watch config, keeping the current config", err, rlog.String("configmap", name))
+			return
+		}
+		rlog.Info("watch config changed", rlog.String("configmap", name), rlog.String("resourceVersion", configMap.ResourceVersion))
+		onChange(cfg)
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    changed,
+		UpdateFunc: func(_ any, obj any) { changed(obj) },
+		DeleteFunc: func(any) {
+			rlog.Info("watch config deleted, using the default config", rlog.String("configmap", name))
+			onChange(&Config{})
+		},
+	})
+	if err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	return nil
+}
+
+func fromConfigMap(configMap *corev1.ConfigMap) (*Config, error) {
+	data, ok := configMap.Data[ConfigMapKey]
+	if !ok {
+		return &Config{}, nil
+	}
+	cfg, err := Parse([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("configmap %s/%s: %w", configMap.Namespace, configMap.Name, err)
+	}
+	return cfg, nil
+}
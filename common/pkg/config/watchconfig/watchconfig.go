@@ -0,0 +1,178 @@
+// Package watchconfig holds the operator facing configuration of the dynamic watchers,
+// read from the YAML file in ROR_WATCH_CONFIG_FILE, or from the key config.yaml of the ConfigMap
+// in POD_NAMESPACE named by ROR_WATCH_CONFIG_MAP. Changes to the ConfigMap are applied without a restart.
+//
+//	disabledResources:
+//	  - group: aquasecurity.github.io
+//	extraResources:
+//	  - group: example.com
+//	    version: v1
+//	    resource: widgets
+//	filters:
+//	  - resource: pods
+//	    excludeNamespaces: [kube-system]
+//	    labelSelector: app!=noisy
+//	  - group: apps
+//	    namespaces: [team-a, team-b]
+package watchconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+type Config struct {
+	// Resources replaces the default resource types watched by the agent when set.
+	Resources []ResourceType `json:"resources,omitempty"`
+	// DisabledResources are not watched, Group, Version and Resource match any value when empty.
+	DisabledResources []ResourceType `json:"disabledResources,omitempty"`
+	// ExtraResources are watched in addition to the default resource types, ror-api must support them.
+	ExtraResources []ResourceType `json:"extraResources,omitempty"`
+	// Filters limit the objects watched per resource type, the first filter matching a resource type is used.
+	Filters []Filter `json:"filters,omitempty"`
+}
+
+type ResourceType struct {
+	Group    string `json:"group,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Resource string `json:"resource,omitempty"`
+}
+
+// Filter limits the objects watched for the resource types it matches.
+// Group, Version and Resource match any value when empty.
+type Filter struct {
+	ResourceType `json:",inline"`
+
+	// Namespaces only watches these namespaces, ignored for cluster scoped resources
+	Namespaces []string `json:"namespaces,omitempty"`
+	// ExcludeNamespaces watches every namespace except these, ignored for cluster scoped resources
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	LabelSelector     string   `json:"labelSelector,omitempty"`
+	FieldSelector     string   `json:"fieldSelector,omitempty"`
+}
+
+// MustLoadFromConfig loads the file in ROR_WATCH_CONFIG_FILE, an empty config is returned if it is not set.
+func MustLoadFromConfig() *Config {
+	path := rorconfig.GetString(agentconsts.WatchConfigFileEnv)
+	cfg, err := Load(path)
+	if err != nil {
+		rlog.Fatal("could not load watch config", err, rlog.String("path", path))
+	}
+	return cfg
+}
+
+// Load reads and validates the config file at path, an empty config is returned if path is empty.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		return &Config{}, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates a YAML config.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	for i, resource := range c.Resources {
+		if resource.Version == "" || resource.Resource == "" {
+			return fmt.Errorf("resource %d: version and resource must be set", i)
+		}
+	}
+	for i, resource := range c.ExtraResources {
+		if resource.Version == "" || resource.Resource == "" {
+			return fmt.Errorf("extra resource %d: version and resource must be set", i)
+		}
+	}
+	for i, filter := range c.Filters {
+		if len(filter.Namespaces) > 0 && len(filter.ExcludeNamespaces) > 0 {
+			return fmt.Errorf("filter %d: namespaces and excludeNamespaces can not both be set", i)
+		}
+		if _, err := labels.Parse(filter.LabelSelector); err != nil {
+			return fmt.Errorf("filter %d: invalid labelSelector: %w", i, err)
+		}
+		if _, err := fields.ParseSelector(filter.FieldSelector); err != nil {
+			return fmt.Errorf("filter %d: invalid fieldSelector: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// FilterFor returns the first filter matching gvr.
+func (c *Config) FilterFor(gvr schema.GroupVersionResource) (Filter, bool) {
+	for _, filter := range c.Filters {
+		if filter.Matches(gvr) {
+			return filter, true
+		}
+	}
+	return Filter{}, false
+}
+
+// Schemas returns the resource types to watch, defaults unless Resources is set, without DisabledResources and with ExtraResources.
+func (c *Config) Schemas(defaults []schema.GroupVersionResource) []schema.GroupVersionResource {
+	candidates := slices.Clone(defaults)
+	if len(c.Resources) > 0 {
+		candidates = make([]schema.GroupVersionResource, 0, len(c.Resources))
+		for _, resource := range c.Resources {
+			candidates = append(candidates, resource.GroupVersionResource())
+		}
+	}
+	for _, resource := range c.ExtraResources {
+		candidates = append(candidates, resource.GroupVersionResource())
+	}
+
+	schemas := make([]schema.GroupVersionResource, 0, len(candidates))
+	seen := make(map[schema.GroupVersionResource]bool, len(candidates))
+	for _, gvr := range candidates {
+		if seen[gvr] || c.disabled(gvr) {
+			continue
+		}
+		seen[gvr] = true
+		schemas = append(schemas, gvr)
+	}
+	return schemas
+}
+
+func (c *Config) disabled(gvr schema.GroupVersionResource) bool {
+	for _, resource := range c.DisabledResources {
+		if resource.Matches(gvr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r ResourceType) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+}
+
+// Matches reports whether gvr matches r, empty fields match any value.
+func (r ResourceType) Matches(gvr schema.GroupVersionResource) bool {
+	return (r.Group == "" || r.Group == gvr.Group) &&
+		(r.Version == "" || r.Version == gvr.Version) &&
+		(r.Resource == "" || r.Resource == gvr.Resource)
+}
@@ -0,0 +1,151 @@
+package watchconfig
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		filters int
+		wantErr bool
+	}{
+		{
+			name: "Test empty config",
+			data: "",
+		}, {
+			name: "Test filters",
+			data: `
+filters:
+  - resource: pods
+    excludeNamespaces: [kube-system]
+    labelSelector: app!=noisy
+  - group: apps
+    namespaces: [team-a, team-b]
+    fieldSelector: metadata.name!=test
+`,
+			filters: 2,
+		}, {
+			name:    "Test unknown field",
+			data:    "filters:\n  - resources: pods\n",
+			wantErr: true,
+		}, {
+			name:    "Test namespaces and excludeNamespaces",
+			data:    "filters:\n  - namespaces: [a]\n    excludeNamespaces: [b]\n",
+			wantErr: true,
+		}, {
+			name:    "Test invalid label selector",
+			data:    "filters:\n  - labelSelector: 'app in (a'\n",
+			wantErr: true,
+		}, {
+			name:    "Test invalid field selector",
+			data:    "filters:\n  - fieldSelector: metadata.name\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(cfg.Filters) != tt.filters {
+				t.Errorf("Parse() got %d filters, want %d", len(cfg.Filters), tt.filters)
+			}
+		})
+	}
+}
+
+func TestConfig_FilterFor(t *testing.T) {
+	cfg := &Config{Filters: []Filter{
+		{ResourceType: ResourceType{Resource: "pods"}, LabelSelector: "pods"},
+		{ResourceType: ResourceType{Group: "apps"}, LabelSelector: "apps"},
+		{LabelSelector: "all"},
+	}}
+	tests := []struct {
+		gvr  schema.GroupVersionResource
+		want string
+	}{
+		{gvr: schema.GroupVersionResource{Version: "v1", Resource: "pods"}, want: "pods"},
+		{gvr: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, want: "apps"},
+		{gvr: schema.GroupVersionResource{Version: "v1", Resource: "nodes"}, want: "all"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gvr.String(), func(t *testing.T) {
+			got, ok := cfg.FilterFor(tt.gvr)
+			if !ok || got.LabelSelector != tt.want {
+				t.Errorf("FilterFor() = %v, %v, want %s", got, ok, tt.want)
+			}
+		})
+	}
+
+	if _, ok := (&Config{}).FilterFor(schema.GroupVersionResource{Version: "v1", Resource: "pods"}); ok {
+		t.Errorf("FilterFor() on empty config returned a filter")
+	}
+}
+
+func TestConfig_Schemas(t *testing.T) {
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	nodes := schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	reports := schema.GroupVersionResource{Group: "aquasecurity.github.io", Version: "v1alpha1", Resource: "vulnerabilityreports"}
+	widgets := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	defaults := []schema.GroupVersionResource{pods, nodes, reports}
+
+	tests := []struct {
+		name string
+		data string
+		want []schema.GroupVersionResource
+	}{
+		{
+			name: "Test defaults",
+			data: "",
+			want: []schema.GroupVersionResource{pods, nodes, reports},
+		}, {
+			name: "Test disabled group and extra resource",
+			data: `
+disabledResources:
+  - group: aquasecurity.github.io
+extraResources:
+  - group: example.com
+    version: v1
+    resource: widgets
+  - version: v1
+    resource: pods
+`,
+			want: []schema.GroupVersionResource{pods, nodes, widgets},
+		}, {
+			name: "Test resources replace defaults",
+			data: `
+resources:
+  - version: v1
+    resource: nodes
+  - group: example.com
+    version: v1
+    resource: widgets
+disabledResources:
+  - resource: widgets
+`,
+			want: []schema.GroupVersionResource{nodes},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got := cfg.Schemas(defaults)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Schemas() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Parse([]byte("extraResources:\n  - resource: widgets\n")); err == nil {
+		t.Errorf("Parse() accepted an extra resource without version")
+	}
+}
@@ -4,27 +4,59 @@ import (
 	"context"
 	"runtime"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
 
 	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
 )
 
 type DynamicController struct {
-	dynInformer cache.SharedIndexInformer
-	dynHandler  DynamicHandler
-	client      dynamic.Interface
-	resource    schema.GroupVersionResource
-	noCache     bool
+	dynInformer  cache.SharedIndexInformer
+	registration cache.ResourceEventHandlerRegistration
+	dynHandler   DynamicHandler
+	events       *eventQueue
+	client       dynamic.Interface
+	resource     schema.GroupVersionResource
+	filter       WatchFilter
+	noCache      bool
+	watchList    bool
+	// watchListTimeout is how long the initial events of a watch-list may take before falling back to paged lists, 0 waits forever
+	watchListTimeout time.Duration
+	// listed is set once the initial list of the no-cache watcher is complete
+	listed atomic.Bool
+	// watchListUnsupported is set when the api server rejects streaming the initial list
+	watchListUnsupported atomic.Bool
+	// resyncing is set from Resync until every existing object has been sent to the handlers again
+	resyncing atomic.Bool
+	resync    chan struct{}
+	// stopped is closed when the no-cache watcher has returned
+	stopped chan struct{}
+	// initialSynced is set once every object existing at start has been sent to the handlers
+	initialSynced atomic.Bool
+	// lastActivity is when the no-cache watcher last got a list page, a watch or an event, in unix nanoseconds
+	lastActivity atomic.Int64
+
+	// known are the uids and resource versions of the objects sent to the handlers by the no-cache watcher,
+	// only used by the watcher goroutine
+	known      map[types.UID]string
+	relisting  *relist
+	apiVersion string
+	kind       string
+	watches    int
 }
 
 type DynamicHandler interface {
@@ -32,35 +64,164 @@ type DynamicHandler interface {
 	GetHandlers() Resourcehandlers
 }
 
-func (c *DynamicController) Run(stop <-chan struct{}) {
+// WatchFilter limits the objects listed and watched by a dynamic controller, the zero value watches everything.
+type WatchFilter struct {
+	// Namespace only watches one namespace, empty watches all namespaces
+	Namespace     string
+	LabelSelector string
+	FieldSelector string
+}
+
+func (f WatchFilter) applyTo(options *metav1.ListOptions) {
+	options.LabelSelector = f.LabelSelector
+	options.FieldSelector = f.FieldSelector
+}
+
+// Run starts the controller in the background, it runs until ctx is canceled.
+func (c *DynamicController) Run(ctx context.Context) {
+	c.touch()
+	c.events.run(ctx)
+	go c.observeInitialList(ctx, time.Now())
+	if c.noCache {
+		go func() {
+			defer close(c.stopped)
+			c.runNoCacheWatcher(ctx)
+		}()
+		return
+	}
+	go c.dynInformer.RunWithContext(ctx)
+}
+
+// DeleteAll sends a delete to the handlers for every object known by the controller and returns how many,
+// for when its resource type is no longer watched. It must only be called once the context passed to Run is canceled,
+// it waits for the no-cache watcher to return and calls the handlers directly as the event queue has stopped.
+// The deletes are unobserved, a cache.DeletedFinalStateUnknown like the informers send.
+func (c *DynamicController) DeleteAll() int {
+	handlers := c.dynHandler.GetHandlers()
+	if !c.noCache {
+		objects := c.dynInformer.GetStore().List()
+		for _, obj := range objects {
+			key, _ := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			handlers.OnDelete(cache.DeletedFinalStateUnknown{Key: key, Obj: obj})
+		}
+		return len(objects)
+	}
+	<-c.stopped
+	deleted := len(c.known)
+	for uid := range c.known {
+		handlers.OnDelete(c.tombstone(uid))
+	}
+	clear(c.known)
+	return deleted
+}
+
+// HasSynced reports whether every existing object has been sent to the handlers,
+// both after the initial list and after the last call to Resync.
+func (c *DynamicController) HasSynced() bool {
+	if c.resyncing.Load() || !c.events.synced() {
+		return false
+	}
+	if c.noCache {
+		return c.listed.Load()
+	}
+	return c.registration.HasSynced()
+}
+
+// Resync sends every existing object to the add handler again, HasSynced reports false until it is done.
+// The no-cache watcher relists from the api server, the informer replays its cache.
+func (c *DynamicController) Resync() {
+	if !c.resyncing.CompareAndSwap(false, true) {
+		return
+	}
 	if c.noCache {
-		go c.runNoCacheWatcher(stop)
+		select {
+		case c.resync <- struct{}{}:
+		default:
+		}
 		return
 	}
-	go c.dynInformer.Run(stop)
+	go func() {
+		defer c.resyncing.Store(false)
+		for _, obj := range c.dynInformer.GetStore().List() {
+			c.events.OnAdd(obj, true)
+		}
+	}()
+}
+
+// observeInitialList records the time from start until the controller has synced.
+func (c *DynamicController) observeInitialList(ctx context.Context, start time.Time) {
+	if cache.WaitForCacheSync(ctx.Done(), c.HasSynced) {
+		c.initialSynced.Store(true)
+		initialListDuration.WithLabelValues(c.resource.String()).Set(time.Since(start).Seconds())
+	}
+}
+
+// InitialListDone reports whether every object existing at start has been sent to the handlers,
+// unlike HasSynced it stays true during a resync.
+func (c *DynamicController) InitialListDone() bool {
+	return c.initialSynced.Load()
+}
+
+// WatchAlive reports whether the controller is still watching. The no-cache watcher must also have received
+// a list page, a watch or an event within maxIdle, the api server sends bookmarks and ends watches regularly
+// so a healthy watch is never idle for long. The informer restarts failed watches itself.
+func (c *DynamicController) WatchAlive(maxIdle time.Duration) bool {
+	if !c.noCache {
+		return !c.dynInformer.IsStopped()
+	}
+	return time.Since(time.Unix(0, c.lastActivity.Load())) <= maxIdle
+}
+
+func (c *DynamicController) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
 }
 
 type Resourcehandlers = cache.ResourceEventHandlerFuncs
 
 // Function creates a new dynamic controller to listen for api-changes in provided GroupVersionResource
 func NewDynamicController(client dynamic.Interface, handler DynamicHandler) *DynamicController {
+	return NewFilteredDynamicController(client, handler, WatchFilter{})
+}
+
+// NewFilteredDynamicController creates a new dynamic controller only listening for api-changes to the objects matching filter
+func NewFilteredDynamicController(client dynamic.Interface, handler DynamicHandler, filter WatchFilter) *DynamicController {
 	dynWatcher := &DynamicController{}
 
 	dynWatcher.client = client
 	dynWatcher.resource = handler.GetSchema()
+	dynWatcher.filter = filter
 	dynWatcher.noCache = dynamicWatchNoCacheEnabled()
+	dynWatcher.watchList = rorconfig.GetBool(agentconsts.DynamicWatchListEnv)
+	dynWatcher.watchListTimeout = time.Duration(rorconfig.GetInt(agentconsts.DynamicWatchListTimeoutSecondsEnv)) * time.Second
 	dynWatcher.dynHandler = handler
+	dynWatcher.events = newEventQueueFromConfig(handler)
+	dynWatcher.resync = make(chan struct{}, 1)
+	dynWatcher.stopped = make(chan struct{})
+	dynWatcher.known = make(map[types.UID]string)
 
 	if dynWatcher.noCache {
-		rlog.Info("dynamic watcher enabled", rlog.Any("gvr", dynWatcher.dynHandler.GetSchema().String()), rlog.Any("noCache", dynWatcher.noCache))
+		rlog.Info("dynamic watcher enabled", rlog.Any("gvr", dynWatcher.dynHandler.GetSchema().String()), rlog.Any("noCache", dynWatcher.noCache), rlog.Any("filter", filter))
 		return dynWatcher
 	}
 
-	dynInformer := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+	dynInformer := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, filter.Namespace, filter.applyTo)
 	informer := dynInformer.ForResource(dynWatcher.dynHandler.GetSchema()).Informer()
 	dynWatcher.dynInformer = informer
+	dynWatcher.events.store = informer.GetStore()
+
+	err := informer.SetWatchErrorHandlerWithContext(func(ctx context.Context, r *cache.Reflector, err error) {
+		watchRestarts.WithLabelValues(dynWatcher.resource.String()).Inc()
+		if isExpired(err) {
+			watchRelists.WithLabelValues(dynWatcher.resource.String()).Inc()
+		}
+		cache.DefaultWatchErrorHandler(ctx, r, err)
+	})
+	if err != nil {
+		rlog.Error("Error setting watch error handler", err)
+	}
 
-	_, err := informer.AddEventHandler(dynWatcher.dynHandler.GetHandlers())
+	registration, err := informer.AddEventHandler(dynWatcher.events)
+	dynWatcher.registration = registration
 
 	if err != nil {
 		rlog.Error("Error adding event handler", err)
@@ -91,28 +252,47 @@ func maybeForceGCAfterInitialList(gvr string) {
 	}
 }
 
-func (c *DynamicController) runNoCacheWatcher(stop <-chan struct{}) {
+func (c *DynamicController) runNoCacheWatcher(ctx context.Context) {
 	// Paged LIST + WATCH loop without informer store.
 	// This keeps memory bounded compared to informers that retain full objects.
 	backoff := time.Second
 	resourceVersion := ""
 
 	for {
-		if shouldStop(stop) {
+		if ctx.Err() != nil {
 			return
 		}
 
 		if resourceVersion == "" {
-			rv, ok := c.noCacheInitialList(stop, &backoff)
+			// a full list covers any pending resync
+			select {
+			case <-c.resync:
+			default:
+			}
+			c.beginRelist()
+			if c.watchListEnabled() {
+				// the initial state and the changes after it are streamed on the same watch
+				rv, forceRelist := c.noCacheWatchList(ctx, &backoff)
+				if ctx.Err() != nil {
+					return
+				}
+				if !forceRelist {
+					resourceVersion = rv
+				}
+				continue
+			}
+			rv, ok := c.noCacheInitialList(ctx, &backoff)
 			if !ok {
 				// list failed; retry outer loop
 				continue
 			}
 			resourceVersion = rv
+			c.endRelist()
+			c.initialListDone()
 		}
 
-		rv, forceRelist := c.noCacheWatch(stop, resourceVersion, &backoff)
-		if shouldStop(stop) {
+		rv, forceRelist := c.noCacheWatch(ctx, resourceVersion, &backoff)
+		if ctx.Err() != nil {
 			return
 		}
 		if forceRelist {
@@ -123,12 +303,18 @@ func (c *DynamicController) runNoCacheWatcher(stop <-chan struct{}) {
 	}
 }
 
-func shouldStop(stop <-chan struct{}) bool {
+// isExpired reports whether err tells that the resource version to watch from is too old, so a relist is needed.
+func isExpired(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err)
+}
+
+// sleep waits for d, it returns early if ctx is canceled.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 	select {
-	case <-stop:
-		return true
-	default:
-		return false
+	case <-ctx.Done():
+	case <-timer.C:
 	}
 }
 
@@ -139,67 +325,166 @@ func increaseBackoff(backoff time.Duration) time.Duration {
 	return backoff
 }
 
-func (c *DynamicController) noCacheInitialList(stop <-chan struct{}, backoff *time.Duration) (string, bool) {
+func (c *DynamicController) noCacheInitialList(ctx context.Context, backoff *time.Duration) (string, bool) {
 	cont := ""
 	resourceVersion := ""
 
 	for {
-		if shouldStop(stop) {
+		if ctx.Err() != nil {
 			return "", false
 		}
 
-		list, err := c.client.Resource(c.resource).List(context.Background(), metav1.ListOptions{Limit: 500, Continue: cont})
+		options := metav1.ListOptions{Limit: 500, Continue: cont}
+		c.filter.applyTo(&options)
+		listCtx, cancel := timeouts.Kubernetes(ctx)
+		list, err := c.client.Resource(c.resource).Namespace(c.filter.Namespace).List(listCtx, options)
+		cancel()
 		if err != nil {
+			if ctx.Err() != nil {
+				return "", false
+			}
 			rlog.Error("dynamic no-cache list failed", err, rlog.Any("gvr", c.resource.String()))
-			time.Sleep(*backoff)
+			sleep(ctx, *backoff)
 			*backoff = increaseBackoff(*backoff)
 			return "", false
 		}
 		*backoff = time.Second
+		c.touch()
 
 		for i := range list.Items {
-			obj := &list.Items[i]
-			c.dynHandler.GetHandlers().AddFunc(obj)
+			c.relistObject(&list.Items[i])
 		}
 
 		resourceVersion = list.GetResourceVersion()
 		cont = list.GetContinue()
 		if cont == "" {
-			maybeForceGCAfterInitialList(c.resource.String())
 			return resourceVersion, true
 		}
 	}
 }
 
-func (c *DynamicController) noCacheWatch(stop <-chan struct{}, resourceVersion string, backoff *time.Duration) (string, bool) {
-	w, err := c.client.Resource(c.resource).Watch(context.Background(), metav1.ListOptions{ResourceVersion: resourceVersion, AllowWatchBookmarks: true})
+// initialListDone marks every existing object as sent to the handlers.
+func (c *DynamicController) initialListDone() {
+	c.listed.Store(true)
+	c.resyncing.Store(false)
+	maybeForceGCAfterInitialList(c.resource.String())
+}
+
+// watchStarted counts every watch after the first as a restart.
+func (c *DynamicController) watchStarted() {
+	c.watches++
+	if c.watches > 1 {
+		watchRestarts.WithLabelValues(c.resource.String()).Inc()
+	}
+}
+
+// watchListEnabled reports whether the initial state should be streamed, unless the api server has rejected it.
+func (c *DynamicController) watchListEnabled() bool {
+	return c.watchList && !c.watchListUnsupported.Load()
+}
+
+// noCacheWatchList streams the existing objects as ADDED events on a watch, followed by a bookmark annotated
+// with k8s.io/initial-events-end, and keeps watching for changes on the same connection.
+// Api servers without the WatchList feature reject the request, the controller then falls back to paged lists.
+// It also falls back if the initial-events-end bookmark does not arrive within watchListTimeout,
+// like from api servers ignoring sendInitialEvents.
+// The resource version to continue watching from is returned, or forceRelist if the initial state was not complete.
+func (c *DynamicController) noCacheWatchList(ctx context.Context, backoff *time.Duration) (string, bool) {
+	c.watchStarted()
+	sendInitialEvents := true
+	options := metav1.ListOptions{
+		SendInitialEvents:    &sendInitialEvents,
+		ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan,
+		AllowWatchBookmarks:  true,
+	}
+	c.filter.applyTo(&options)
+	w, err := c.client.Resource(c.resource).Namespace(c.filter.Namespace).Watch(ctx, options)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", true
+		}
+		if apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+			c.watchListUnsupported.Store(true)
+			rlog.Info("watch-list streaming not supported by the api server, using paged list", rlog.Any("gvr", c.resource.String()), rlog.Any("error", err))
+			return "", true
+		}
+		rlog.Error("dynamic no-cache watch-list failed", err, rlog.Any("gvr", c.resource.String()))
+		sleep(ctx, *backoff)
+		*backoff = increaseBackoff(*backoff)
+		return "", true
+	}
+	*backoff = time.Second
+	c.touch()
+	return c.handleWatchEvents(ctx, w, "", false, backoff)
+}
+
+// noCacheWatch watches from resourceVersion until ctx is canceled or the watch ends.
+// The watch itself is not bounded by the kubernetes timeout, the api server closes it after its own timeout.
+func (c *DynamicController) noCacheWatch(ctx context.Context, resourceVersion string, backoff *time.Duration) (string, bool) {
+	c.watchStarted()
+	options := metav1.ListOptions{ResourceVersion: resourceVersion, AllowWatchBookmarks: true}
+	c.filter.applyTo(&options)
+	w, err := c.client.Resource(c.resource).Namespace(c.filter.Namespace).Watch(ctx, options)
 	if err != nil {
+		if ctx.Err() != nil {
+			return resourceVersion, false
+		}
+		if isExpired(err) {
+			rlog.Info("dynamic no-cache watch resource version expired, relisting", rlog.Any("gvr", c.resource.String()), rlog.String("resourceVersion", resourceVersion))
+			return "", true
+		}
 		rlog.Error("dynamic no-cache watch failed", err, rlog.Any("gvr", c.resource.String()))
-		time.Sleep(*backoff)
+		sleep(ctx, *backoff)
 		*backoff = increaseBackoff(*backoff)
 		return resourceVersion, false
 	}
 	*backoff = time.Second
+	c.touch()
+	return c.handleWatchEvents(ctx, w, resourceVersion, true, backoff)
+}
 
+// handleWatchEvents sends the events of w to the handlers until ctx is canceled or the watch ends.
+// Until initialDone, the watch is streaming the initial state and ending it forces a relist.
+// After it, the watch is resumed from the last resource version seen unless the api server reports it as expired.
+func (c *DynamicController) handleWatchEvents(ctx context.Context, w watch.Interface, resourceVersion string, initialDone bool, backoff *time.Duration) (string, bool) {
+	defer w.Stop()
+	var initialTimeout <-chan time.Time
+	if !initialDone && c.watchListTimeout > 0 {
+		timer := time.NewTimer(c.watchListTimeout)
+		defer timer.Stop()
+		initialTimeout = timer.C
+	}
 	for {
 		select {
-		case <-stop:
-			w.Stop()
-			return resourceVersion, false
+		case <-ctx.Done():
+			return resourceVersion, !initialDone
+		case <-c.resync:
+			return "", true
+		case <-initialTimeout:
+			c.watchListUnsupported.Store(true)
+			rlog.Warn("watch-list initial events not complete within the timeout, using paged list", rlog.Any("gvr", c.resource.String()), rlog.String("timeout", c.watchListTimeout.String()))
+			return "", true
 		case evt, ok := <-w.ResultChan():
 			if !ok {
-				w.Stop()
 				// restart watch loop
+				return resourceVersion, !initialDone
+			}
+			c.touch()
+
+			if evt.Type == watch.Error {
+				err := apierrors.FromObject(evt.Object)
+				if !initialDone || isExpired(err) {
+					rlog.Info("dynamic no-cache watch expired, relisting", rlog.Any("gvr", c.resource.String()), rlog.String("resourceVersion", resourceVersion), rlog.Any("error", err))
+					return "", true
+				}
+				rlog.Warn("dynamic no-cache watch error, resuming from the last resource version", rlog.Any("gvr", c.resource.String()), rlog.String("resourceVersion", resourceVersion), rlog.Any("error", err))
+				sleep(ctx, *backoff)
+				*backoff = increaseBackoff(*backoff)
 				return resourceVersion, false
 			}
 
 			u, ok := evt.Object.(*unstructured.Unstructured)
 			if !ok || u == nil {
-				// Ignore Status/error objects here; reconnect on Error events below
-				if evt.Type == "ERROR" {
-					w.Stop()
-					return "", true
-				}
 				continue
 			}
 
@@ -208,17 +493,27 @@ func (c *DynamicController) noCacheWatch(stop <-chan struct{}, resourceVersion s
 			}
 
 			switch evt.Type {
-			case "ADDED":
-				c.dynHandler.GetHandlers().AddFunc(u)
-			case "MODIFIED":
-				c.dynHandler.GetHandlers().UpdateFunc(nil, u)
-			case "DELETED":
-				c.dynHandler.GetHandlers().DeleteFunc(u)
-			case "BOOKMARK":
-				// only updates resourceVersion
-			case "ERROR":
-				w.Stop()
-				return "", true
+			case watch.Added:
+				if !initialDone {
+					c.relistObject(u)
+					continue
+				}
+				c.remember(u)
+				c.events.OnAdd(u, false)
+			case watch.Modified:
+				c.remember(u)
+				c.events.OnUpdate(nil, u)
+			case watch.Deleted:
+				c.forget(u)
+				c.events.OnDelete(u)
+			case watch.Bookmark:
+				// only updates resourceVersion, unless it ends the initial events of a watch-list
+				if !initialDone && u.GetAnnotations()[metav1.InitialEventsAnnotationKey] == "true" {
+					initialDone = true
+					initialTimeout = nil
+					c.endRelist()
+					c.initialListDone()
+				}
 			}
 		}
 	}
@@ -0,0 +1,354 @@
+package dynamiccontroller
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/watch"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+var configMaps = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func TestMain(m *testing.M) {
+	// set once, the watcher goroutines of earlier tests may still be reading the config
+	rorconfig.Set(agentconsts.DynamicWatchNoCacheEnv, true)
+	rorconfig.Set(agentconsts.DynamicWatchListEnv, true)
+	rorconfig.Set(agentconsts.DynamicWatchWorkersEnv, 2)
+	os.Exit(m.Run())
+}
+
+type recordingHandler struct {
+	mu      sync.Mutex
+	added   []string
+	deleted []string
+}
+
+func (h *recordingHandler) GetSchema() schema.GroupVersionResource {
+	return configMaps
+}
+
+func (h *recordingHandler) GetHandlers() Resourcehandlers {
+	return Resourcehandlers{
+		AddFunc: func(obj any) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			h.added = append(h.added, obj.(*unstructured.Unstructured).GetName())
+		},
+		UpdateFunc: func(any, any) {},
+		DeleteFunc: func(obj any) {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if _, ok := obj.(cache.DeletedFinalStateUnknown); !ok {
+				h.deleted = append(h.deleted, obj.(*unstructured.Unstructured).GetName())
+				return
+			}
+			// unobserved deletes only hold the uid
+			u, _ := DeletedObject(obj)
+			h.deleted = append(h.deleted, "unobserved:"+string(u.GetUID()))
+		},
+	}
+}
+
+func (h *recordingHandler) events() ([]string, []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.added), slices.Clone(h.deleted)
+}
+
+func (h *recordingHandler) addedCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.added)
+}
+
+func newConfigMap(name string, resourceVersion string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	u.SetNamespace("default")
+	u.SetName(name)
+	u.SetUID(types.UID(name))
+	u.SetResourceVersion(resourceVersion)
+	return u
+}
+
+func newFakeClient(objects ...runtime.Object) *fakedynamic.FakeDynamicClient {
+	return fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{configMaps: "ConfigMapList"}, objects...)
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDynamicController_watchList(t *testing.T) {
+	client := newFakeClient()
+	watcher := watch.NewFakeWithChanSize(10, false)
+	var options []metav1.ListOptions
+	var mu sync.Mutex
+	client.PrependWatchReactor("configmaps", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		options = append(options, action.(clienttesting.WatchActionImpl).ListOptions)
+		return true, watcher, nil
+	})
+	client.PrependReactor("list", "configmaps", func(clienttesting.Action) (bool, runtime.Object, error) {
+		t.Errorf("paged list used although the api server supports watch-list")
+		return false, nil, nil
+	})
+
+	handler := &recordingHandler{}
+	controller := NewDynamicController(client, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	controller.Run(ctx)
+
+	watcher.Add(newConfigMap("a", "1"))
+	watcher.Add(newConfigMap("b", "2"))
+	waitFor(t, "the initial events", func() bool { return handler.addedCount() == 2 })
+	if controller.HasSynced() {
+		t.Errorf("HasSynced() = true before the initial-events-end bookmark")
+	}
+
+	bookmark := newConfigMap("", "3")
+	bookmark.SetAnnotations(map[string]string{metav1.InitialEventsAnnotationKey: "true"})
+	watcher.Action(watch.Bookmark, bookmark)
+	waitFor(t, "HasSynced", controller.HasSynced)
+
+	// events after the bookmark are changes on the same watch
+	watcher.Add(newConfigMap("c", "4"))
+	waitFor(t, "the event after the initial events", func() bool { return handler.addedCount() == 3 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(options) != 1 {
+		t.Fatalf("watch started %d times, want 1", len(options))
+	}
+	if options[0].SendInitialEvents == nil || !*options[0].SendInitialEvents || options[0].ResourceVersionMatch != metav1.ResourceVersionMatchNotOlderThan {
+		t.Errorf("watch options = %+v, want sendInitialEvents and resourceVersionMatch=NotOlderThan", options[0])
+	}
+}
+
+func TestDynamicController_watchListFallback(t *testing.T) {
+	client := newFakeClient(newConfigMap("a", "1"), newConfigMap("b", "2"))
+	client.PrependWatchReactor("configmaps", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		if action.(clienttesting.WatchActionImpl).ListOptions.SendInitialEvents != nil {
+			return true, nil, apierrors.NewInvalid(schema.GroupKind{Kind: "ListOptions"}, "", field.ErrorList{
+				field.Forbidden(field.NewPath("sendInitialEvents"), "sendInitialEvents is forbidden for watch unless the WatchList feature gate is enabled"),
+			})
+		}
+		return false, nil, nil
+	})
+
+	handler := &recordingHandler{}
+	controller := NewDynamicController(client, handler)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	controller.Run(ctx)
+
+	waitFor(t, "HasSynced", controller.HasSynced)
+	if got := handler.addedCount(); got != 2 {
+		t.Errorf("paged list sent %d objects, want 2", got)
+	}
+	if !controller.watchListUnsupported.Load() {
+		t.Errorf("watch-list not marked as unsupported after the api server rejected it")
+	}
+}
+
+func TestDynamicController_watchListTimeout(t *testing.T) {
+	client := newFakeClient(newConfigMap("a", "1"), newConfigMap("b", "2"))
+	// the api server ignores sendInitialEvents, the initial-events-end bookmark never arrives
+	client.PrependWatchReactor("configmaps", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		if action.(clienttesting.WatchActionImpl).ListOptions.SendInitialEvents != nil {
+			return true, watch.NewFake(), nil
+		}
+		return false, nil, nil
+	})
+
+	handler := &recordingHandler{}
+	controller := NewDynamicController(client, handler)
+	controller.watchListTimeout = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	controller.Run(ctx)
+
+	waitFor(t, "HasSynced", controller.HasSynced)
+	if got := handler.addedCount(); got != 2 {
+		t.Errorf("paged list sent %d objects, want 2", got)
+	}
+	if !controller.watchListUnsupported.Load() {
+		t.Errorf("watch-list not marked as unsupported after the initial events timed out")
+	}
+}
+
+// startWatches makes every watch on client return a new fake watcher, sent on the returned channel with its options.
+func startWatches(client *fakedynamic.FakeDynamicClient) <-chan startedWatch {
+	started := make(chan startedWatch, 10)
+	client.PrependWatchReactor("configmaps", func(action clienttesting.Action) (bool, watch.Interface, error) {
+		watcher := watch.NewFakeWithChanSize(10, false)
+		started <- startedWatch{watcher: watcher, options: action.(clienttesting.WatchActionImpl).ListOptions}
+		return true, watcher, nil
+	})
+	return started
+}
+
+type startedWatch struct {
+	watcher *watch.FakeWatcher
+	options metav1.ListOptions
+}
+
+func nextWatch(t *testing.T, started <-chan startedWatch) startedWatch {
+	t.Helper()
+	select {
+	case w := <-started:
+		return w
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a watch")
+		return startedWatch{}
+	}
+}
+
+func TestDynamicController_watchErrors(t *testing.T) {
+	client := newFakeClient(newConfigMap("a", "1"), newConfigMap("b", "2"))
+	var lists atomic.Int32
+	client.PrependReactor("list", "configmaps", func(clienttesting.Action) (bool, runtime.Object, error) {
+		lists.Add(1)
+		return false, nil, nil
+	})
+	started := startWatches(client)
+
+	restarts := testutil.ToFloat64(watchRestarts.WithLabelValues(configMaps.String()))
+	relists := testutil.ToFloat64(watchRelists.WithLabelValues(configMaps.String()))
+
+	handler := &recordingHandler{}
+	controller := NewDynamicController(client, handler)
+	controller.watchList = false
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	controller.Run(ctx)
+
+	first := nextWatch(t, started)
+	waitFor(t, "HasSynced", controller.HasSynced)
+
+	// a transient error resumes the watch from the last resource version seen
+	first.watcher.Modify(newConfigMap("a", "5"))
+	first.watcher.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 500, Reason: metav1.StatusReasonInternalError})
+	second := nextWatch(t, started)
+	if second.options.ResourceVersion != "5" {
+		t.Errorf("watch resumed from resource version %q, want 5", second.options.ResourceVersion)
+	}
+	if got := lists.Load(); got != 1 {
+		t.Errorf("listed %d times after a transient error, want 1", got)
+	}
+
+	// b is deleted and c created while the watch is down, the relist sends c, a delete for b and skips the unchanged a
+	tracker := client.Tracker()
+	if err := tracker.Delete(configMaps, "default", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Create(configMaps, newConfigMap("c", "6"), "default"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracker.Update(configMaps, newConfigMap("a", "5"), "default"); err != nil {
+		t.Fatal(err)
+	}
+	second.watcher.Error(&metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired})
+	nextWatch(t, started)
+	waitFor(t, "the relist", func() bool { added, deleted := handler.events(); return len(added) == 3 && len(deleted) == 1 })
+
+	added, deleted := handler.events()
+	slices.Sort(added)
+	if got := lists.Load(); got != 2 {
+		t.Errorf("listed %d times after the watch expired, want 2", got)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"unobserved:b"}; !slices.Equal(deleted, want) {
+		t.Errorf("deleted = %v, want %v", deleted, want)
+	}
+	if got := testutil.ToFloat64(watchRestarts.WithLabelValues(configMaps.String())) - restarts; got != 2 {
+		t.Errorf("counted %v watch restarts, want 2", got)
+	}
+	if got := testutil.ToFloat64(watchRelists.WithLabelValues(configMaps.String())) - relists; got != 1 {
+		t.Errorf("counted %v relists, want 1", got)
+	}
+}
+
+func TestDynamicController_DeleteAll(t *testing.T) {
+	client := newFakeClient(newConfigMap("a", "1"), newConfigMap("b", "2"))
+	handler := &recordingHandler{}
+	controller := NewDynamicController(client, handler)
+	controller.watchList = false
+	ctx, cancel := context.WithCancel(context.Background())
+	controller.Run(ctx)
+	waitFor(t, "HasSynced", controller.HasSynced)
+
+	cancel()
+	if got := controller.DeleteAll(); got != 2 {
+		t.Errorf("DeleteAll() = %d, want 2", got)
+	}
+	_, deleted := handler.events()
+	slices.Sort(deleted)
+	if want := []string{"unobserved:a", "unobserved:b"}; !slices.Equal(deleted, want) {
+		t.Errorf("deleted %v, want %v", deleted, want)
+	}
+	if got := controller.DeleteAll(); got != 0 {
+		t.Errorf("DeleteAll() sent %d deletes again", got)
+	}
+}
+
+func TestDeletedObject(t *testing.T) {
+	object := newConfigMap("a", "1")
+	tests := []struct {
+		name   string
+		obj    any
+		want   *unstructured.Unstructured
+		wantOk bool
+	}{
+		{name: "observed delete", obj: object, want: object, wantOk: true},
+		{name: "unobserved delete", obj: cache.DeletedFinalStateUnknown{Key: "a", Obj: object}, want: object, wantOk: true},
+		{name: "unobserved delete without object", obj: cache.DeletedFinalStateUnknown{Key: "a"}, wantOk: false},
+		{name: "nil", obj: nil, wantOk: false},
+		{name: "typed object", obj: &metav1.Status{}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DeletedObject(tt.obj)
+			if ok != tt.wantOk {
+				t.Fatalf("DeletedObject() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && got != tt.want {
+				t.Errorf("DeletedObject() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package dynamiccontroller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsSubsystem = "watch"
+
+var (
+	watchEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsservice.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "events_total",
+		Help:      "Events received by the dynamic watchers by gvr and event type.",
+	}, []string{"gvr", "type"})
+
+	watchRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsservice.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "restarts_total",
+		Help:      "Watches restarted after they ended or failed, by gvr.",
+	}, []string{"gvr"})
+
+	watchRelists = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsservice.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "relists_total",
+		Help:      "Full lists after the initial list, because a watch expired or on resync, by gvr.",
+	}, []string{"gvr"})
+
+	initialListDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsservice.Namespace,
+		Subsystem: metricsSubsystem,
+		Name:      "initial_list_duration_seconds",
+		Help:      "Time from start until every existing object was sent to the handlers, by gvr.",
+	}, []string{"gvr"})
+
+	queueDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsservice.Namespace, metricsSubsystem, "queue_depth"),
+		"Objects waiting in the event queue of a dynamic watcher, by gvr.",
+		[]string{"gvr"}, nil)
+
+	queueOldestDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsservice.Namespace, metricsSubsystem, "queue_oldest_item_age_seconds"),
+		"Age of the oldest event waiting in the event queue of a dynamic watcher, by gvr.",
+		[]string{"gvr"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(queueCollector{})
+}
+
+var (
+	runningQueuesLock sync.Mutex
+	runningQueues     = map[*eventQueue]struct{}{}
+)
+
+// queueCollector reports the depth and oldest item of the running event queues when scraped. A gvr may be watched
+// by several queues, like one per namespace, their depths are summed and the oldest item of any of them is reported.
+type queueCollector struct{}
+
+// queueStats are the stats of the queues of a gvr.
+type queueStats struct {
+	depth int
+	age   float64
+}
+
+func (queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- queueOldestDesc
+}
+
+func (queueCollector) Collect(ch chan<- prometheus.Metric) {
+	runningQueuesLock.Lock()
+	queues := make([]*eventQueue, 0, len(runningQueues))
+	for q := range runningQueues {
+		queues = append(queues, q)
+	}
+	runningQueuesLock.Unlock()
+
+	now := time.Now()
+	stats := make(map[string]queueStats, len(queues))
+	for _, q := range queues {
+		depth, oldest := q.stats()
+		gvrStats := stats[q.gvr]
+		gvrStats.depth += depth
+		if depth > 0 {
+			gvrStats.age = max(gvrStats.age, now.Sub(oldest).Seconds())
+		}
+		stats[q.gvr] = gvrStats
+	}
+	for gvr, gvrStats := range stats {
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(gvrStats.depth), gvr)
+		ch <- prometheus.MustNewConstMetric(queueOldestDesc, prometheus.GaugeValue, gvrStats.age, gvr)
+	}
+}
+
+func registerRunningQueue(q *eventQueue) {
+	runningQueuesLock.Lock()
+	defer runningQueuesLock.Unlock()
+	runningQueues[q] = struct{}{}
+}
+
+func unregisterRunningQueue(q *eventQueue) {
+	runningQueuesLock.Lock()
+	defer runningQueuesLock.Unlock()
+	delete(runningQueues, q)
+}
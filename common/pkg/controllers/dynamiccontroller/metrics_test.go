@@ -0,0 +1,34 @@
+package dynamiccontroller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/time/rate"
+)
+
+func TestQueueCollector_sameGvr(t *testing.T) {
+	first := newEventQueue(&eventRecorder{}, 1, rate.NewLimiter(rate.Inf, 1))
+	second := newEventQueue(&eventRecorder{}, 1, rate.NewLimiter(rate.Inf, 1))
+	registerRunningQueue(first)
+	registerRunningQueue(second)
+	defer unregisterRunningQueue(first)
+	defer unregisterRunningQueue(second)
+
+	first.OnAdd(newConfigMap("a", "1"), false)
+	second.OnAdd(newConfigMap("b", "1"), false)
+	second.OnAdd(newConfigMap("c", "1"), false)
+
+	if got := testutil.CollectAndCount(queueCollector{}); got != 2 {
+		t.Errorf("collected %d series for one gvr, want 2", got)
+	}
+	want := `
+# HELP ror_agent_watch_queue_depth Objects waiting in the event queue of a dynamic watcher, by gvr.
+# TYPE ror_agent_watch_queue_depth gauge
+ror_agent_watch_queue_depth{gvr="/v1, Resource=configmaps"} 3
+`
+	if err := testutil.CollectAndCompare(queueCollector{}, strings.NewReader(want), "ror_agent_watch_queue_depth"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,291 @@
+package dynamiccontroller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// maxEventRetries is the number of times an event is retried after a handler panicked before it is dropped
+	maxEventRetries = 5
+	// the delay before retrying an event doubles from eventRetryBaseDelay up to eventRetryMaxDelay
+	eventRetryBaseDelay = 100 * time.Millisecond
+	eventRetryMaxDelay  = time.Minute
+)
+
+type eventType int
+
+const (
+	eventAdd eventType = iota
+	eventUpdate
+	eventDelete
+)
+
+var eventTypeNames = [...]string{eventAdd: "add", eventUpdate: "update", eventDelete: "delete"}
+
+// queuedEvent is the latest event of an object waiting to be sent to the handlers.
+// Objects in the store of an informer are only referenced by key and read from the store when the event is sent,
+// obj is only held for deletes and for controllers without a store.
+type queuedEvent struct {
+	eventType eventType
+	key       string
+	obj       any
+	// initial is set when the event is part of a full list, HasSynced waits for it to be sent
+	initial bool
+	// queued is when the object started waiting
+	queued time.Time
+}
+
+// eventQueue sends the events of a controller to its handlers from a pool of workers, so slow handlers
+// don't stall the watch. The events are keyed by uid, an object changing several times before a worker
+// gets to it is only sent once with its latest state. Events are handed to the workers as soon as they arrive,
+// only events retried after a handler panicked are held back by the rate limit.
+// With no workers the events are sent by the caller.
+type eventQueue struct {
+	handler DynamicHandler
+	gvr     string
+	workers int
+	queue   workqueue.TypedRateLimitingInterface[types.UID]
+	// store is the store of the informer, nil for the no-cache watcher
+	store cache.Store
+
+	mu      sync.Mutex
+	pending map[types.UID]*queuedEvent
+	// initialPending counts the pending events from full lists
+	initialPending atomic.Int64
+}
+
+// newEventQueueFromConfig returns a queue configured by ROR_DYNAMIC_WATCH_WORKERS, ROR_DYNAMIC_WATCH_QPS
+// and ROR_DYNAMIC_WATCH_BURST, the QPS and burst limit the retries of all objects. A QPS of 0 or less does not limit the rate.
+func newEventQueueFromConfig(handler DynamicHandler) *eventQueue {
+	limit := rate.Limit(rorconfig.GetInt(agentconsts.DynamicWatchQPSEnv))
+	burst := rorconfig.GetInt(agentconsts.DynamicWatchBurstEnv)
+	if limit <= 0 {
+		limit = rate.Inf
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return newEventQueue(handler, rorconfig.GetInt(agentconsts.DynamicWatchWorkersEnv), rate.NewLimiter(limit, burst))
+}
+
+func newEventQueue(handler DynamicHandler, workers int, limiter *rate.Limiter) *eventQueue {
+	q := &eventQueue{
+		handler: handler,
+		gvr:     handler.GetSchema().String(),
+		workers: workers,
+		pending: make(map[types.UID]*queuedEvent),
+	}
+	if workers > 0 {
+		q.queue = workqueue.NewTypedRateLimitingQueueWithConfig[types.UID](
+			workqueue.NewTypedMaxOfRateLimiter(
+				workqueue.NewTypedItemExponentialFailureRateLimiter[types.UID](eventRetryBaseDelay, eventRetryMaxDelay),
+				&workqueue.TypedBucketRateLimiter[types.UID]{Limiter: limiter},
+			),
+			workqueue.TypedRateLimitingQueueConfig[types.UID]{Name: q.gvr},
+		)
+	}
+	return q
+}
+
+// run starts the workers, they stop when ctx is canceled. The events already queued are sent,
+// the retries still held back by the rate limit are dropped.
+func (q *eventQueue) run(ctx context.Context) {
+	if q.queue == nil {
+		return
+	}
+	registerRunningQueue(q)
+	for range q.workers {
+		go func() {
+			for q.processNext() {
+			}
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		unregisterRunningQueue(q)
+		q.queue.ShutDown()
+	}()
+}
+
+// synced reports whether every event from a full list has been sent to the handlers.
+func (q *eventQueue) synced() bool {
+	return q.initialPending.Load() == 0
+}
+
+// stats returns the number of objects waiting and when the oldest of them started waiting.
+func (q *eventQueue) stats() (int, time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var oldest time.Time
+	for _, evt := range q.pending {
+		if oldest.IsZero() || evt.queued.Before(oldest) {
+			oldest = evt.queued
+		}
+	}
+	return len(q.pending), oldest
+}
+
+// OnAdd, OnUpdate and OnDelete implement cache.ResourceEventHandler, so the queue can be added to an informer.
+func (q *eventQueue) OnAdd(obj any, isInInitialList bool) {
+	q.enqueue(queuedEvent{eventType: eventAdd, obj: obj, initial: isInInitialList})
+}
+
+// OnUpdate only passes the new object on, the handlers do not use the old one.
+func (q *eventQueue) OnUpdate(_, newObj any) {
+	q.enqueue(queuedEvent{eventType: eventUpdate, obj: newObj})
+}
+
+func (q *eventQueue) OnDelete(obj any) {
+	q.enqueue(queuedEvent{eventType: eventDelete, obj: obj})
+}
+
+func (q *eventQueue) enqueue(evt queuedEvent) {
+	watchEvents.WithLabelValues(q.gvr, eventTypeNames[evt.eventType]).Inc()
+	u, ok := DeletedObject(evt.obj)
+	if q.queue == nil || !ok || u.GetUID() == "" {
+		q.send(evt)
+		return
+	}
+	uid := u.GetUID()
+	if q.store != nil && evt.eventType != eventDelete {
+		// the latest state is read from the store when the event is sent
+		evt.key, _ = cache.MetaNamespaceKeyFunc(u)
+		evt.obj = nil
+	}
+
+	q.mu.Lock()
+	pending, ok := q.pending[uid]
+	if !ok {
+		if evt.initial {
+			q.initialPending.Add(1)
+		}
+		evt.queued = time.Now()
+		q.pending[uid] = &evt
+		q.mu.Unlock()
+		q.queue.Add(uid)
+		return
+	}
+	// the object is already waiting, only its latest state is sent
+	if evt.initial && !pending.initial {
+		q.initialPending.Add(1)
+	}
+	pending.initial = pending.initial || evt.initial
+	pending.key = evt.key
+	pending.obj = evt.obj
+	switch {
+	case evt.eventType == eventDelete || pending.eventType == eventDelete:
+		pending.eventType = evt.eventType
+	case evt.eventType == eventAdd:
+		// a resync sends the object as added again
+		pending.eventType = eventAdd
+	}
+	// an add followed by updates stays an add
+	q.mu.Unlock()
+}
+
+func (q *eventQueue) processNext() bool {
+	uid, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(uid)
+
+	q.mu.Lock()
+	evt, ok := q.pending[uid]
+	delete(q.pending, uid)
+	q.mu.Unlock()
+	if !ok {
+		q.queue.Forget(uid)
+		return true
+	}
+	if err := q.trySend(uid, *evt); err != nil {
+		q.retry(uid, evt, err)
+		return true
+	}
+	if evt.initial {
+		q.initialPending.Add(-1)
+	}
+	q.queue.Forget(uid)
+	return true
+}
+
+// trySend sends the event to the handlers, a panicking handler is returned as an error so the event can be retried.
+func (q *eventQueue) trySend(uid types.UID, evt queuedEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	if evt.key != "" {
+		obj, exists, err := q.store.GetByKey(evt.key)
+		if err != nil {
+			return err
+		}
+		u, ok := obj.(*unstructured.Unstructured)
+		if !exists || !ok || u.GetUID() != uid {
+			// deleted since, the delete event replaces this one
+			return nil
+		}
+		evt.obj = u
+	}
+	q.send(evt)
+	return nil
+}
+
+// retry queues the event again after the rate limit, unless a newer event of the object is already waiting.
+// The event is dropped after maxEventRetries.
+func (q *eventQueue) retry(uid types.UID, evt *queuedEvent, err error) {
+	q.mu.Lock()
+	if newer, ok := q.pending[uid]; ok {
+		// the newer event is sent instead, it is already queued
+		if evt.initial {
+			if newer.initial {
+				q.initialPending.Add(-1)
+			}
+			newer.initial = true
+		}
+		q.mu.Unlock()
+		q.queue.Forget(uid)
+		return
+	}
+	if q.queue.NumRequeues(uid) >= maxEventRetries {
+		q.mu.Unlock()
+		rlog.Error("dropping dynamic watch event after retries", err, rlog.String("gvr", q.gvr), rlog.String("uid", string(uid)), rlog.String("event", eventTypeNames[evt.eventType]))
+		if evt.initial {
+			q.initialPending.Add(-1)
+		}
+		q.queue.Forget(uid)
+		return
+	}
+	q.pending[uid] = evt
+	q.mu.Unlock()
+	rlog.Warn("dynamic watch event failed, retrying", rlog.String("gvr", q.gvr), rlog.String("uid", string(uid)), rlog.Any("error", err))
+	q.queue.AddRateLimited(uid)
+}
+
+func (q *eventQueue) send(evt queuedEvent) {
+	handlers := q.handler.GetHandlers()
+	switch evt.eventType {
+	case eventAdd:
+		handlers.OnAdd(evt.obj, evt.initial)
+	case eventUpdate:
+		handlers.OnUpdate(nil, evt.obj)
+	case eventDelete:
+		handlers.OnDelete(evt.obj)
+	}
+}
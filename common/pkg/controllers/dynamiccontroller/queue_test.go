@@ -0,0 +1,234 @@
+package dynamiccontroller
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// eventRecorder records the events sent to the handlers as "<event> <name>@<resource version>".
+// The first panics events sent make the handler panic.
+type eventRecorder struct {
+	mu     sync.Mutex
+	sent   []string
+	panics int
+}
+
+func (r *eventRecorder) GetSchema() schema.GroupVersionResource {
+	return configMaps
+}
+
+func (r *eventRecorder) GetHandlers() Resourcehandlers {
+	record := func(event string, obj any) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.panics > 0 {
+			r.panics--
+			panic("handler failed")
+		}
+		u, _ := DeletedObject(obj)
+		r.sent = append(r.sent, event+" "+u.GetName()+"@"+u.GetResourceVersion())
+	}
+	return Resourcehandlers{
+		AddFunc:    func(obj any) { record("add", obj) },
+		UpdateFunc: func(_, obj any) { record("update", obj) },
+		DeleteFunc: func(obj any) { record("delete", obj) },
+	}
+}
+
+func (r *eventRecorder) events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.sent)
+}
+
+func TestEventQueue_latestState(t *testing.T) {
+	tests := []struct {
+		name    string
+		enqueue func(q *eventQueue)
+		want    []string
+	}{
+		{
+			name: "add followed by updates is sent as add with the latest state",
+			enqueue: func(q *eventQueue) {
+				q.OnAdd(newConfigMap("a", "1"), false)
+				q.OnUpdate(newConfigMap("a", "1"), newConfigMap("a", "2"))
+				q.OnUpdate(newConfigMap("a", "2"), newConfigMap("a", "3"))
+			},
+			want: []string{"add a@3"},
+		},
+		{
+			name: "updates are sent once with the latest state",
+			enqueue: func(q *eventQueue) {
+				q.OnUpdate(newConfigMap("a", "1"), newConfigMap("a", "2"))
+				q.OnUpdate(newConfigMap("a", "2"), newConfigMap("a", "3"))
+			},
+			want: []string{"update a@3"},
+		},
+		{
+			name: "delete replaces pending changes",
+			enqueue: func(q *eventQueue) {
+				q.OnAdd(newConfigMap("a", "1"), false)
+				q.OnUpdate(newConfigMap("a", "1"), newConfigMap("a", "2"))
+				q.OnDelete(newConfigMap("a", "3"))
+			},
+			want: []string{"delete a@3"},
+		},
+		{
+			name: "objects are queued separately",
+			enqueue: func(q *eventQueue) {
+				q.OnAdd(newConfigMap("a", "1"), false)
+				q.OnAdd(newConfigMap("b", "2"), false)
+				q.OnUpdate(newConfigMap("a", "1"), newConfigMap("a", "3"))
+			},
+			want: []string{"add a@3", "add b@2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &eventRecorder{}
+			q := newEventQueue(recorder, 1, rate.NewLimiter(rate.Inf, 1))
+			tt.enqueue(q)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			q.run(ctx)
+			waitFor(t, "the queued events", func() bool { return len(recorder.events()) >= len(tt.want) })
+
+			if got := recorder.events(); !slices.Equal(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventQueue_synced(t *testing.T) {
+	recorder := &eventRecorder{}
+	q := newEventQueue(recorder, 1, rate.NewLimiter(rate.Inf, 1))
+
+	q.OnUpdate(nil, newConfigMap("a", "1"))
+	if !q.synced() {
+		t.Errorf("synced() = false with only watch events pending")
+	}
+	q.OnAdd(newConfigMap("b", "1"), true)
+	q.OnUpdate(nil, newConfigMap("a", "2"))
+	q.OnAdd(newConfigMap("a", "2"), true)
+	if q.synced() {
+		t.Errorf("synced() = true with events from a full list pending")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.run(ctx)
+	waitFor(t, "synced", q.synced)
+	if want := []string{"add a@2", "add b@1"}; !slices.Equal(recorder.events(), want) {
+		t.Errorf("sent %v, want %v", recorder.events(), want)
+	}
+}
+
+func TestEventQueue_notRateLimited(t *testing.T) {
+	recorder := &eventRecorder{}
+	q := newEventQueue(recorder, 1, rate.NewLimiter(rate.Every(time.Hour), 1))
+	for _, name := range []string{"a", "b", "c", "d"} {
+		q.OnAdd(newConfigMap(name, "1"), true)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.run(ctx)
+	waitFor(t, "synced", q.synced)
+	if want := []string{"add a@1", "add b@1", "add c@1", "add d@1"}; !slices.Equal(recorder.events(), want) {
+		t.Errorf("sent %v, want %v", recorder.events(), want)
+	}
+}
+
+func TestEventQueue_store(t *testing.T) {
+	recorder := &eventRecorder{}
+	q := newEventQueue(recorder, 1, rate.NewLimiter(rate.Inf, 1))
+	q.store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+
+	q.OnAdd(newConfigMap("a", "1"), true)
+	q.OnAdd(newConfigMap("b", "1"), true)
+	if err := q.store.Add(newConfigMap("a", "2")); err != nil {
+		t.Fatal(err)
+	}
+	for _, evt := range q.pending {
+		if evt.obj != nil {
+			t.Errorf("pending event of %s holds the object, want only its key", evt.key)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.run(ctx)
+	waitFor(t, "synced", q.synced)
+	// b is no longer in the store, its delete is sent instead
+	if want := []string{"add a@2"}; !slices.Equal(recorder.events(), want) {
+		t.Errorf("sent %v, want %v", recorder.events(), want)
+	}
+}
+
+func TestEventQueue_retry(t *testing.T) {
+	tests := []struct {
+		name   string
+		panics int
+		want   []string
+	}{
+		{name: "a failed event is retried", panics: 2, want: []string{"add a@1"}},
+		{name: "an event failing every retry is dropped", panics: maxEventRetries + 1, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &eventRecorder{panics: tt.panics}
+			q := newEventQueue(recorder, 1, rate.NewLimiter(rate.Inf, 1))
+			q.OnAdd(newConfigMap("a", "1"), true)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			q.run(ctx)
+			waitFor(t, "synced", q.synced)
+			if got := recorder.events(); !slices.Equal(got, tt.want) {
+				t.Errorf("sent %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventQueue_withoutWorkers(t *testing.T) {
+	recorder := &eventRecorder{}
+	q := newEventQueue(recorder, 0, rate.NewLimiter(rate.Inf, 1))
+
+	q.OnAdd(newConfigMap("a", "1"), true)
+	q.OnUpdate(nil, newConfigMap("a", "2"))
+	if want := []string{"add a@1", "update a@2"}; !slices.Equal(recorder.events(), want) {
+		t.Errorf("sent %v, want %v", recorder.events(), want)
+	}
+	if !q.synced() {
+		t.Errorf("synced() = false after sending the events inline")
+	}
+}
+
+func TestEventQueue_stats(t *testing.T) {
+	q := newEventQueue(&eventRecorder{}, 1, rate.NewLimiter(rate.Inf, 1))
+	if depth, _ := q.stats(); depth != 0 {
+		t.Errorf("depth = %d of an empty queue, want 0", depth)
+	}
+
+	before := time.Now()
+	q.OnAdd(newConfigMap("a", "1"), false)
+	q.OnUpdate(nil, newConfigMap("b", "1"))
+	q.OnUpdate(nil, newConfigMap("a", "2"))
+	depth, oldest := q.stats()
+	if depth != 2 {
+		t.Errorf("depth = %d, want 2", depth)
+	}
+	if oldest.Before(before) || oldest.After(time.Now()) {
+		t.Errorf("oldest item queued at %s, want after %s", oldest, before)
+	}
+}
@@ -0,0 +1,98 @@
+package dynamiccontroller
+
+import (
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// relist tracks the objects seen while the no-cache watcher lists every object again.
+type relist struct {
+	seen map[types.UID]struct{}
+	// skipUnchanged leaves out objects whose resource version has not changed since they were sent,
+	// a resync sends every object.
+	skipUnchanged bool
+	skipped       int
+}
+
+// DeletedObject returns the object of a delete event, also when the delete was not observed and obj is a
+// cache.DeletedFinalStateUnknown. The object of an unobserved delete may only hold its type and uid.
+func DeletedObject(obj any) (*unstructured.Unstructured, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	return u, ok && u != nil
+}
+
+// beginRelist starts a full list, the objects known before it and not listed are deleted by endRelist.
+func (c *DynamicController) beginRelist() {
+	if c.listed.Load() {
+		watchRelists.WithLabelValues(c.resource.String()).Inc()
+	}
+	c.relisting = &relist{
+		seen:          make(map[types.UID]struct{}, len(c.known)),
+		skipUnchanged: len(c.known) > 0 && !c.resyncing.Load(),
+	}
+}
+
+// relistObject sends an object from a full list to the add handler.
+func (c *DynamicController) relistObject(u *unstructured.Unstructured) {
+	uid := u.GetUID()
+	if c.relisting != nil {
+		c.relisting.seen[uid] = struct{}{}
+		if resourceVersion, ok := c.known[uid]; ok && c.relisting.skipUnchanged && resourceVersion == u.GetResourceVersion() {
+			c.relisting.skipped++
+			return
+		}
+	}
+	c.remember(u)
+	c.events.OnAdd(u, true)
+}
+
+// endRelist sends deletes for the known objects not seen by the full list, they were deleted while the watch was down.
+func (c *DynamicController) endRelist() {
+	if c.relisting == nil {
+		return
+	}
+	deleted := 0
+	for uid := range c.known {
+		if _, ok := c.relisting.seen[uid]; ok {
+			continue
+		}
+		delete(c.known, uid)
+		c.events.OnDelete(c.tombstone(uid))
+		deleted++
+	}
+	if c.relisting.skipUnchanged || deleted > 0 {
+		rlog.Info("dynamic no-cache relist done", rlog.Any("gvr", c.resource.String()), rlog.Int("objects", len(c.relisting.seen)), rlog.Int("unchanged", c.relisting.skipped), rlog.Int("deleted", deleted))
+	}
+	c.relisting = nil
+}
+
+// remember adds the object to the known objects, only its uid and resource version are kept.
+func (c *DynamicController) remember(u *unstructured.Unstructured) {
+	if c.apiVersion == "" {
+		c.apiVersion = u.GetAPIVersion()
+		c.kind = u.GetKind()
+	}
+	c.known[u.GetUID()] = u.GetResourceVersion()
+}
+
+func (c *DynamicController) forget(u *unstructured.Unstructured) {
+	delete(c.known, u.GetUID())
+}
+
+// tombstone returns the delete event for an object the watcher did not see being deleted,
+// like the informers it is a cache.DeletedFinalStateUnknown, holding an object with only the type and uid set,
+// and the namespace if the controller watches one namespace.
+func (c *DynamicController) tombstone(uid types.UID) cache.DeletedFinalStateUnknown {
+	u := &unstructured.Unstructured{}
+	u.SetAPIVersion(c.apiVersion)
+	u.SetKind(c.kind)
+	u.SetNamespace(c.filter.Namespace)
+	u.SetUID(uid)
+	return cache.DeletedFinalStateUnknown{Key: string(uid), Obj: u}
+}
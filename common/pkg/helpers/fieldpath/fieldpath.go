@@ -0,0 +1,260 @@
+// Package fieldpath selects fields in unstructured kubernetes objects using simple JSON paths.
+//
+// A path is a list of segments separated by dots, for example
+//
+//	metadata.managedFields
+//	status.conditions[*].lastHeartbeatTime
+//	spec.containers[0].env[*].value
+//	metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]
+//
+// A segment is a map key, * for every key of a map, [*] for every element of a list,
+// [N] for the element at index N, or a quoted key in brackets for keys containing dots.
+package fieldpath
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type segmentType int
+
+const (
+	segmentKey segmentType = iota
+	segmentAnyKey
+	segmentIndex
+	segmentAnyIndex
+)
+
+type segment struct {
+	typ   segmentType
+	key   string
+	index int
+}
+
+// Path is a parsed field path.
+type Path struct {
+	raw      string
+	segments []segment
+}
+
+// Parse parses a field path, see the package documentation for the syntax.
+func Parse(path string) (Path, error) {
+	p := Path{raw: path}
+	rest := strings.TrimSpace(path)
+	if rest == "" {
+		return Path{}, fmt.Errorf("empty field path")
+	}
+
+	expectKey := true
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return Path{}, fmt.Errorf("unterminated bracket in field path %q", path)
+			}
+			seg, err := parseBracket(rest[1:end])
+			if err != nil {
+				return Path{}, fmt.Errorf("invalid field path %q: %w", path, err)
+			}
+			p.segments = append(p.segments, seg)
+			rest = rest[end+1:]
+			expectKey = false
+		case rest[0] == '.':
+			if expectKey {
+				return Path{}, fmt.Errorf("empty segment in field path %q", path)
+			}
+			rest = rest[1:]
+			expectKey = true
+			if rest == "" {
+				return Path{}, fmt.Errorf("field path %q ends with a dot", path)
+			}
+		default:
+			if !expectKey {
+				return Path{}, fmt.Errorf("missing dot before %q in field path %q", rest, path)
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "*" {
+				p.segments = append(p.segments, segment{typ: segmentAnyKey})
+			} else {
+				p.segments = append(p.segments, segment{typ: segmentKey, key: key})
+			}
+			rest = rest[end:]
+			expectKey = false
+		}
+	}
+	return p, nil
+}
+
+func parseBracket(content string) (segment, error) {
+	switch {
+	case content == "*":
+		return segment{typ: segmentAnyIndex}, nil
+	case len(content) >= 2 && (content[0] == '"' || content[0] == '\'') && content[len(content)-1] == content[0]:
+		return segment{typ: segmentKey, key: content[1 : len(content)-1]}, nil
+	}
+	index, err := strconv.Atoi(content)
+	if err != nil || index < 0 {
+		return segment{}, fmt.Errorf("invalid index %q", content)
+	}
+	return segment{typ: segmentIndex, index: index}, nil
+}
+
+func (p Path) String() string {
+	return p.raw
+}
+
+// Without returns obj without the fields matched by the path.
+// Maps and lists along the path are copied, obj itself is not modified.
+func (p Path) Without(obj map[string]any) map[string]any {
+	return p.Update(obj, func(any) (any, bool) { return nil, false })
+}
+
+// Update calls fn for every field matched by the path and returns obj with the matched fields replaced by the returned value,
+// or removed if fn returns false. Maps and lists along the path are copied, obj itself is not modified.
+func (p Path) Update(obj map[string]any, fn func(value any) (any, bool)) map[string]any {
+	if len(p.segments) == 0 {
+		return obj
+	}
+	updated, changed, _ := update(obj, p.segments, fn)
+	if !changed {
+		return obj
+	}
+	return updated.(map[string]any)
+}
+
+// update applies fn to the fields matched by segments below value.
+// It returns the new value, whether anything changed and whether the value should be kept.
+func update(value any, segments []segment, fn func(any) (any, bool)) (any, bool, bool) {
+	if len(segments) == 0 {
+		newValue, keep := fn(value)
+		return newValue, true, keep
+	}
+	seg, rest := segments[0], segments[1:]
+
+	switch seg.typ {
+	case segmentKey, segmentAnyKey:
+		m, ok := value.(map[string]any)
+		if !ok {
+			return value, false, true
+		}
+		var out map[string]any
+		for key, child := range m {
+			if seg.typ == segmentKey && key != seg.key {
+				continue
+			}
+			newChild, changed, keep := update(child, rest, fn)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = make(map[string]any, len(m))
+				for k, v := range m {
+					out[k] = v
+				}
+			}
+			if keep {
+				out[key] = newChild
+			} else {
+				delete(out, key)
+			}
+		}
+		if out == nil {
+			return value, false, true
+		}
+		return out, true, true
+
+	case segmentIndex, segmentAnyIndex:
+		list, ok := value.([]any)
+		if !ok {
+			return value, false, true
+		}
+		var out []any
+		removed := make(map[int]bool)
+		for i, child := range list {
+			if seg.typ == segmentIndex && i != seg.index {
+				continue
+			}
+			newChild, changed, keep := update(child, rest, fn)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = make([]any, len(list))
+				copy(out, list)
+			}
+			if keep {
+				out[i] = newChild
+			} else {
+				removed[i] = true
+			}
+		}
+		if out == nil {
+			return value, false, true
+		}
+		if len(removed) > 0 {
+			kept := make([]any, 0, len(out)-len(removed))
+			for i, v := range out {
+				if !removed[i] {
+					kept = append(kept, v)
+				}
+			}
+			out = kept
+		}
+		return out, true, true
+	}
+	return value, false, true
+}
+
+// AnyKind is the rule key matching every resource type.
+const AnyKind = "*"
+
+// Rules holds field paths keyed by "<apiVersion>/<kind>" or AnyKind.
+type Rules map[string][]Path
+
+// ParseRules parses rules on the form "<apiVersion>/<kind>=<path>,<path>;*=<path>",
+// for example "*=metadata.managedFields;v1/Node=status.conditions[*].lastHeartbeatTime".
+func ParseRules(rules string) (Rules, error) {
+	parsed := make(Rules)
+	for rule := range strings.SplitSeq(rules, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		gvk, paths, found := strings.Cut(rule, "=")
+		gvk = strings.TrimSpace(gvk)
+		if !found || gvk == "" {
+			return nil, fmt.Errorf("invalid field rule %q, expected <apiVersion>/<kind>=<path>[,<path>]", rule)
+		}
+		if gvk != AnyKind && !strings.Contains(gvk, "/") {
+			return nil, fmt.Errorf("invalid kind %q in field rule %q, expected <apiVersion>/<kind> or %s", gvk, rule, AnyKind)
+		}
+		for path := range strings.SplitSeq(paths, ",") {
+			p, err := Parse(path)
+			if err != nil {
+				return nil, err
+			}
+			parsed[gvk] = append(parsed[gvk], p)
+		}
+	}
+	return parsed, nil
+}
+
+// For returns the paths matching the resource type of obj, including the AnyKind paths.
+func (r Rules) For(obj map[string]any) []Path {
+	if len(r) == 0 {
+		return nil
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	paths := r[AnyKind]
+	if kindPaths := r[apiVersion+"/"+kind]; len(kindPaths) > 0 {
+		paths = append(paths[:len(paths):len(paths)], kindPaths...)
+	}
+	return paths
+}
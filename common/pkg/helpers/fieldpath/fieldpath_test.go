@@ -0,0 +1,128 @@
+package fieldpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testObject() map[string]any {
+	return map[string]any{
+		"metadata": map[string]any{
+			"name": "node-1",
+			"annotations": map[string]any{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				"team": "ror",
+			},
+		},
+		"status": map[string]any{
+			"conditions": []any{
+				map[string]any{"type": "Ready", "lastHeartbeatTime": "2024-01-01T00:00:00Z"},
+				map[string]any{"type": "MemoryPressure", "lastHeartbeatTime": "2024-01-01T00:00:00Z"},
+			},
+		},
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "metadata.managedFields"},
+		{path: "status.conditions[*].lastHeartbeatTime"},
+		{path: "spec.containers[0].env[*].value"},
+		{path: `metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`},
+		{path: "metadata.labels.*"},
+		{path: "", wantErr: true},
+		{path: "metadata..name", wantErr: true},
+		{path: "metadata.", wantErr: true},
+		{path: "status.conditions[*", wantErr: true},
+		{path: "status.conditions[-1]", wantErr: true},
+		{path: "status.conditions[*]name", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := Parse(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPath_Without(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want func(obj map[string]any)
+	}{
+		{
+			name: "Test removing a field from every list element",
+			path: "status.conditions[*].lastHeartbeatTime",
+			want: func(obj map[string]any) {
+				for _, c := range obj["status"].(map[string]any)["conditions"].([]any) {
+					delete(c.(map[string]any), "lastHeartbeatTime")
+				}
+			},
+		}, {
+			name: "Test removing a quoted key",
+			path: `metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`,
+			want: func(obj map[string]any) {
+				delete(obj["metadata"].(map[string]any)["annotations"].(map[string]any), "kubectl.kubernetes.io/last-applied-configuration")
+			},
+		}, {
+			name: "Test removing a list element",
+			path: "status.conditions[0]",
+			want: func(obj map[string]any) {
+				status := obj["status"].(map[string]any)
+				status["conditions"] = status["conditions"].([]any)[1:]
+			},
+		}, {
+			name: "Test removing every key of a map",
+			path: "metadata.annotations.*",
+			want: func(obj map[string]any) {
+				obj["metadata"].(map[string]any)["annotations"] = map[string]any{}
+			},
+		}, {
+			name: "Test missing field",
+			path: "spec.containers[*].env",
+			want: func(obj map[string]any) {},
+		}, {
+			name: "Test path through a non map value",
+			path: "metadata.name.first",
+			want: func(obj map[string]any) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := Parse(tt.path)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.path, err)
+			}
+			obj := testObject()
+			want := testObject()
+			tt.want(want)
+
+			got := path.Without(obj)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Without() = %v, want %v", got, want)
+			}
+			if !reflect.DeepEqual(obj, testObject()) {
+				t.Errorf("Without() modified the input object")
+			}
+		})
+	}
+}
+
+func TestPath_Update(t *testing.T) {
+	path, err := Parse("status.conditions[*].type")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	got := path.Update(testObject(), func(any) (any, bool) { return "***", true })
+	for _, c := range got["status"].(map[string]any)["conditions"].([]any) {
+		if c.(map[string]any)["type"] != "***" {
+			t.Errorf("Update() did not replace %v", c)
+		}
+	}
+}
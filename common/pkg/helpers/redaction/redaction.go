@@ -0,0 +1,126 @@
+// Package redaction removes or masks fields of kubernetes resources before they are published to ror-api.
+package redaction
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/fieldpath"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+)
+
+// MaskedValue replaces the string values of masked fields.
+const MaskedValue = "*****"
+
+// annotationPaths are the annotations checked against the annotation pattern.
+var annotationPaths = mustParsePaths("metadata.annotations", "spec.template.metadata.annotations")
+
+// Redactor drops and masks fields of resources by resource type and field path.
+// A nil Redactor leaves resources unchanged.
+type Redactor struct {
+	drop        fieldpath.Rules
+	mask        fieldpath.Rules
+	annotations *regexp.Regexp
+}
+
+// NewRedactor creates a redactor from field rules on the format of fieldpath.ParseRules,
+// and a pattern matching the keys of annotations to drop from every resource.
+func NewRedactor(dropFields string, maskFields string, annotationPattern string) (*Redactor, error) {
+	drop, err := fieldpath.ParseRules(dropFields)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse drop fields: %w", err)
+	}
+	mask, err := fieldpath.ParseRules(maskFields)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse mask fields: %w", err)
+	}
+	r := &Redactor{drop: drop, mask: mask}
+	if annotationPattern != "" {
+		r.annotations, err = regexp.Compile(annotationPattern)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse annotation pattern: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// MustNewRedactorFromConfig creates a redactor from ROR_REDACT_DROP_FIELDS, ROR_REDACT_MASK_FIELDS and ROR_REDACT_ANNOTATIONS.
+func MustNewRedactorFromConfig() *Redactor {
+	dropFields := rorconfig.GetString(agentconsts.RedactDropFieldsEnv)
+	maskFields := rorconfig.GetString(agentconsts.RedactMaskFieldsEnv)
+	annotationPattern := rorconfig.GetString(agentconsts.RedactAnnotationsEnv)
+	r, err := NewRedactor(dropFields, maskFields, annotationPattern)
+	if err != nil {
+		rlog.Fatal("could not configure redaction", err)
+	}
+	if dropFields != "" || maskFields != "" || annotationPattern != "" {
+		rlog.Info("redaction configured", rlog.String("dropFields", dropFields), rlog.String("maskFields", maskFields), rlog.String("annotations", annotationPattern))
+	}
+	return r
+}
+
+// Redact returns obj with the configured fields dropped or masked, obj itself is not modified.
+// Masking replaces string values with MaskedValue and drops values of other types.
+func (r *Redactor) Redact(obj map[string]any) map[string]any {
+	if r == nil || obj == nil {
+		return obj
+	}
+	for _, path := range r.drop.For(obj) {
+		obj = path.Without(obj)
+	}
+	for _, path := range r.mask.For(obj) {
+		obj = path.Update(obj, mask)
+	}
+	if r.annotations != nil {
+		for _, path := range annotationPaths {
+			obj = path.Update(obj, r.dropAnnotations)
+		}
+	}
+	return obj
+}
+
+func mustParsePaths(paths ...string) []fieldpath.Path {
+	parsed := make([]fieldpath.Path, 0, len(paths))
+	for _, p := range paths {
+		path, err := fieldpath.Parse(p)
+		if err != nil {
+			panic(err)
+		}
+		parsed = append(parsed, path)
+	}
+	return parsed
+}
+
+func mask(value any) (any, bool) {
+	if _, ok := value.(string); ok {
+		return MaskedValue, true
+	}
+	return nil, false
+}
+
+func (r *Redactor) dropAnnotations(value any) (any, bool) {
+	annotations, ok := value.(map[string]any)
+	if !ok {
+		return value, true
+	}
+	var kept map[string]any
+	for key := range annotations {
+		if !r.annotations.MatchString(key) {
+			continue
+		}
+		if kept == nil {
+			kept = make(map[string]any, len(annotations))
+			for k, v := range annotations {
+				kept[k] = v
+			}
+		}
+		delete(kept, key)
+	}
+	if kept == nil {
+		return value, true
+	}
+	return kept, true
+}
@@ -0,0 +1,135 @@
+package redaction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testPod() map[string]any {
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]any{
+			"name": "pod-1",
+			"annotations": map[string]any{
+				"vault.hashicorp.com/token": "s.abc",
+				"team":                      "ror",
+			},
+		},
+		"spec": map[string]any{
+			"containers": []any{
+				map[string]any{
+					"name": "app",
+					"env": []any{
+						map[string]any{"name": "PASSWORD", "value": "secret"},
+						map[string]any{"name": "PORT", "value": "8080"},
+					},
+					"args": []any{"--token=secret"},
+				},
+			},
+		},
+	}
+}
+
+func TestRedactor_Redact(t *testing.T) {
+	tests := []struct {
+		name        string
+		drop        string
+		mask        string
+		annotations string
+		want        func(obj map[string]any)
+	}{
+		{
+			name: "Test no rules",
+			want: func(obj map[string]any) {},
+		}, {
+			name: "Test mask env values",
+			mask: "v1/Pod=spec.containers[*].env[*].value",
+			want: func(obj map[string]any) {
+				container := obj["spec"].(map[string]any)["containers"].([]any)[0].(map[string]any)
+				for _, env := range container["env"].([]any) {
+					env.(map[string]any)["value"] = MaskedValue
+				}
+			},
+		}, {
+			name: "Test mask drops non string values",
+			mask: "*=spec.containers[*].args",
+			want: func(obj map[string]any) {
+				container := obj["spec"].(map[string]any)["containers"].([]any)[0].(map[string]any)
+				delete(container, "args")
+			},
+		}, {
+			name: "Test drop fields",
+			drop: "*=spec.containers[*].args;v1/Pod=spec.containers[*].env",
+			want: func(obj map[string]any) {
+				container := obj["spec"].(map[string]any)["containers"].([]any)[0].(map[string]any)
+				delete(container, "args")
+				delete(container, "env")
+			},
+		}, {
+			name: "Test rules for other kinds",
+			drop: "apps/v1/Deployment=spec.template.spec.containers[*].env",
+			want: func(obj map[string]any) {},
+		}, {
+			name:        "Test drop annotations",
+			annotations: `^vault\.hashicorp\.com/`,
+			want: func(obj map[string]any) {
+				delete(obj["metadata"].(map[string]any)["annotations"].(map[string]any), "vault.hashicorp.com/token")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedactor(tt.drop, tt.mask, tt.annotations)
+			if err != nil {
+				t.Fatalf("NewRedactor() error = %v", err)
+			}
+			want := testPod()
+			tt.want(want)
+
+			got := r.Redact(testPod())
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Redact() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRedactor_RedactDoesNotModifyInput(t *testing.T) {
+	r, err := NewRedactor("*=spec", "*=metadata.name", ".*")
+	if err != nil {
+		t.Fatalf("NewRedactor() error = %v", err)
+	}
+	obj := testPod()
+	r.Redact(obj)
+	if !reflect.DeepEqual(obj, testPod()) {
+		t.Errorf("Redact() modified the input object")
+	}
+}
+
+func TestRedactor_Nil(t *testing.T) {
+	var r *Redactor
+	if got := r.Redact(testPod()); !reflect.DeepEqual(got, testPod()) {
+		t.Errorf("Redact() = %v, want unchanged object", got)
+	}
+}
+
+func TestNewRedactor_Invalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		drop        string
+		mask        string
+		annotations string
+	}{
+		{name: "Test invalid drop rule", drop: "Pod=spec"},
+		{name: "Test invalid mask path", mask: "v1/Pod=spec..containers"},
+		{name: "Test invalid annotation pattern", annotations: "(["},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRedactor(tt.drop, tt.mask, tt.annotations); err == nil {
+				t.Errorf("NewRedactor() expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package sharding splits the work of the agent between replicas, configured by ROR_SHARD_COUNT and ROR_SHARD_MODE.
+// Every replica owns one shard, and sends the objects of either its share of the resource types or its share of the namespaces.
+// Resource types and namespaces are assigned by rendezvous hashing, so changing the shard count only moves
+// the resource types and namespaces of the shards added or removed.
+package sharding
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Mode selects what is split between the shards.
+type Mode string
+
+const (
+	// ModeResources gives every resource type to one shard.
+	ModeResources Mode = "resources"
+	// ModeNamespaces watches every resource type in every shard, the objects of a namespace are sent by one shard.
+	// Cluster scoped objects are watched and sent by the first shard.
+	ModeNamespaces Mode = "namespaces"
+)
+
+// Shard is the part of the work done by one replica, the zero value does all of it.
+type Shard struct {
+	Index int
+	Count int
+	Mode  Mode
+}
+
+// Config is the sharding configured for the agent.
+type Config struct {
+	Count int
+	Mode  Mode
+	// Index is the shard of this replica, negative when it claims a free shard at start
+	Index int
+}
+
+// ConfigFromEnv returns the sharding configured by ROR_SHARD_COUNT, ROR_SHARD_MODE and ROR_SHARD_INDEX.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Count: rorconfig.GetInt(agentconsts.ShardCountEnv),
+		Mode:  Mode(rorconfig.GetString(agentconsts.ShardModeEnv)),
+		Index: rorconfig.GetInt(agentconsts.ShardIndexEnv),
+	}
+	if cfg.Count < 1 {
+		cfg.Count = 1
+	}
+	if cfg.Mode != ModeResources && cfg.Mode != ModeNamespaces {
+		return cfg, fmt.Errorf("unknown shard mode %q, must be %q or %q", cfg.Mode, ModeResources, ModeNamespaces)
+	}
+	if cfg.Index >= cfg.Count {
+		return cfg, fmt.Errorf("shard index %d out of range for %d shards", cfg.Index, cfg.Count)
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether the work is split between more than one shard.
+func (c Config) Enabled() bool {
+	return c.Count > 1
+}
+
+// Shard returns the shard with the given index.
+func (c Config) Shard(index int) Shard {
+	return Shard{Index: index, Count: c.Count, Mode: c.Mode}
+}
+
+// Enabled reports whether the shard only does a part of the work.
+func (s Shard) Enabled() bool {
+	return s.Count > 1
+}
+
+// Primary reports whether the shard does the work not split between shards, like the heartbeat.
+func (s Shard) Primary() bool {
+	return s.Index == 0
+}
+
+// OwnsResource reports whether the shard watches the resource type.
+func (s Shard) OwnsResource(gvr schema.GroupVersionResource) bool {
+	if !s.Enabled() || s.Mode != ModeResources {
+		return true
+	}
+	return owner(gvr.GroupResource().String(), s.Count) == s.Index
+}
+
+// OwnsNamespace reports whether the shard sends the objects in namespace, empty for cluster scoped objects.
+func (s Shard) OwnsNamespace(namespace string) bool {
+	if !s.Enabled() || s.Mode != ModeNamespaces {
+		return true
+	}
+	if namespace == "" {
+		return s.Primary()
+	}
+	return owner(namespace, s.Count) == s.Index
+}
+
+func (s Shard) String() string {
+	if !s.Enabled() {
+		return "all"
+	}
+	return fmt.Sprintf("%d/%d (%s)", s.Index, s.Count, s.Mode)
+}
+
+// owner returns the shard with the highest score for key.
+func owner(key string, count int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+
+	best, bestScore := 0, uint64(0)
+	for index := range count {
+		if score := mix(sum ^ mix(uint64(index)+1)); index == 0 || score > bestScore {
+			best, bestScore = index, score
+		}
+	}
+	return best
+}
+
+// mix is the splitmix64 finalizer, it spreads keys differing in a few bits over the whole range.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,81 @@
+package sharding
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestShard_OwnsResource(t *testing.T) {
+	gvrs := make([]schema.GroupVersionResource, 0, 50)
+	for i := range 50 {
+		gvrs = append(gvrs, schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: fmt.Sprintf("resource%d", i)})
+	}
+
+	tests := []struct {
+		name      string
+		count     int
+		mode      Mode
+		wantOwned int
+	}{
+		{name: "Test one shard owns every resource type", count: 1, mode: ModeResources, wantOwned: 50},
+		{name: "Test every resource type has one owner", count: 4, mode: ModeResources, wantOwned: 50},
+		{name: "Test namespace sharding watches every resource type in every shard", count: 3, mode: ModeNamespaces, wantOwned: 150},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owned := 0
+			for index := range tt.count {
+				shard := Shard{Index: index, Count: tt.count, Mode: tt.mode}
+				for _, gvr := range gvrs {
+					if shard.OwnsResource(gvr) {
+						owned++
+					}
+				}
+			}
+			if owned != tt.wantOwned {
+				t.Errorf("owned %d resource types, want %d", owned, tt.wantOwned)
+			}
+		})
+	}
+}
+
+func TestShard_OwnsNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		shard     Shard
+		namespace string
+		want      bool
+	}{
+		{name: "Test zero value owns every namespace", shard: Shard{}, namespace: "default", want: true},
+		{name: "Test resource sharding owns every namespace", shard: Shard{Index: 1, Count: 2, Mode: ModeResources}, namespace: "default", want: true},
+		{name: "Test cluster scoped objects belong to the first shard", shard: Shard{Index: 0, Count: 2, Mode: ModeNamespaces}, namespace: "", want: true},
+		{name: "Test cluster scoped objects are skipped by other shards", shard: Shard{Index: 1, Count: 2, Mode: ModeNamespaces}, namespace: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.shard.OwnsNamespace(tt.namespace); got != tt.want {
+				t.Errorf("OwnsNamespace(%q) = %t, want %t", tt.namespace, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOwner_stable(t *testing.T) {
+	// growing from 4 to 5 shards only moves keys to the new shard
+	moved := 0
+	for i := range 1000 {
+		key := fmt.Sprintf("namespace-%d", i)
+		before, after := owner(key, 4), owner(key, 5)
+		if before != after {
+			if after != 4 {
+				t.Fatalf("%s moved from shard %d to %d, want only moves to the new shard", key, before, after)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 350 {
+		t.Errorf("%d of 1000 keys moved to the new shard, want about 200", moved)
+	}
+}
@@ -0,0 +1,53 @@
+package statuscode
+
+import (
+	"errors"
+)
+
+// Error is an error carrying the http status code of the response from ror-api.
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) StatusCode() int {
+	return e.Code
+}
+
+// New returns an error with the message and status code.
+func New(code int, message string) error {
+	return &Error{Code: code, Err: errors.New(message)}
+}
+
+// Wrap adds the status code to err, or returns nil if err is nil.
+func Wrap(err error, code int) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// FromError returns the http status code of an error returned by the ror client, or 0 if the error has none,
+// like when ror-api could not be reached. The code is taken from the error type, never parsed from the message.
+func FromError(err error) int {
+	if err == nil {
+		return 0
+	}
+	var statusErr interface{ StatusCode() int }
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode()
+	}
+	var rorErr interface{ GetStatusCode() int }
+	if errors.As(err, &rorErr) {
+		return rorErr.GetStatusCode()
+	}
+	return 0
+}
@@ -0,0 +1,42 @@
+package statuscode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type rorError struct {
+	status int
+}
+
+func (e rorError) Error() string      { return "request failed" }
+func (e rorError) GetStatusCode() int { return e.status }
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "Test FromError nil", err: nil, want: 0},
+		{name: "Test FromError status code in message is ignored", err: errors.New("got Status Code: 404 from api"), want: 0},
+		{name: "Test FromError typed", err: fmt.Errorf("wrapped: %w", New(422, "request failed")), want: 422},
+		{name: "Test FromError ror error", err: fmt.Errorf("wrapped: %w", rorError{status: 409}), want: 409},
+		{name: "Test FromError wrapped", err: Wrap(errors.New("status 400 in body"), 503), want: 503},
+		{name: "Test FromError no status", err: errors.New("uid 3c99c410-3cdd-11ee-be56-0242ac120002 failed"), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromError(tt.err); got != tt.want {
+				t.Errorf("FromError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap_nil(t *testing.T) {
+	if err := Wrap(nil, 500); err != nil {
+		t.Errorf("Wrap(nil) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,31 @@
+// Package timeouts bounds single calls to ror-api and the kubernetes API,
+// the deadlines are set by ROR_API_TIMEOUT_SECONDS and ROR_KUBERNETES_TIMEOUT_SECONDS.
+package timeouts
+
+import (
+	"context"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+)
+
+// RorApi returns a context for one call to ror-api, canceled with ctx or when the timeout expires.
+func RorApi(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, agentconsts.RorApiTimeoutSecondsEnv)
+}
+
+// Kubernetes returns a context for one call to the kubernetes API, canceled with ctx or when the timeout expires.
+func Kubernetes(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, agentconsts.KubernetesTimeoutSecondsEnv)
+}
+
+// withTimeout only adds cancellation if the timeout in key is not positive.
+func withTimeout(ctx context.Context, key string) (context.Context, context.CancelFunc) {
+	seconds := rorconfig.GetInt(key)
+	if seconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+}
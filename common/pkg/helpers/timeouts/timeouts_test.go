@@ -0,0 +1,50 @@
+package timeouts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+)
+
+func TestTimeouts(t *testing.T) {
+	tests := []struct {
+		name         string
+		seconds      int
+		wantDeadline bool
+	}{
+		{name: "positive timeout sets a deadline", seconds: 5, wantDeadline: true},
+		{name: "zero disables the timeout", seconds: 0, wantDeadline: false},
+		{name: "negative disables the timeout", seconds: -1, wantDeadline: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rorconfig.Set(agentconsts.RorApiTimeoutSecondsEnv, tt.seconds)
+			rorconfig.Set(agentconsts.KubernetesTimeoutSecondsEnv, tt.seconds)
+
+			for name, fn := range map[string]func(context.Context) (context.Context, context.CancelFunc){"RorApi": RorApi, "Kubernetes": Kubernetes} {
+				parent, cancelParent := context.WithCancel(context.Background())
+				ctx, cancel := fn(parent)
+
+				deadline, ok := ctx.Deadline()
+				if ok != tt.wantDeadline {
+					t.Fatalf("%s: deadline set = %v, want %v", name, ok, tt.wantDeadline)
+				}
+				if ok && time.Until(deadline) > time.Duration(tt.seconds)*time.Second {
+					t.Errorf("%s: deadline %s is after the timeout", name, deadline)
+				}
+
+				cancelParent()
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Second):
+					t.Errorf("%s: context not canceled with its parent", name)
+				}
+				cancel()
+			}
+		})
+	}
+}
@@ -0,0 +1,446 @@
+// Package eventfeed sends kubernetes events to ror-api, so the reasons behind failing workloads, like FailedScheduling,
+// BackOff or OOMKilling, can be seen in ror. It is enabled by ROR_EVENT_FEED.
+//
+// Events are watched from events.k8s.io/v1 and filtered by type, reason and namespace. Repeats of an event, like
+// a pod restarting in a loop, are sent at most once every ROR_EVENT_FEED_DEDUPE_SECONDS with the latest count,
+// and events are sent at no more than ROR_EVENT_FEED_QPS.
+//
+// Each event is sent to the v1 resources endpoint of ror-api as a resource of kind Event in events.k8s.io/v1 with
+// an Event as its resource. It is created the first time it is sent, its repeats update it. The feed is only started
+// by the v1 agent, as both agents may run in a cluster and would send every event twice.
+package eventfeed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/controllers/dynamiccontroller"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+	eventsv1 "k8s.io/api/events/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// flushInterval is how often the events waiting are sent
+	flushInterval = 10 * time.Second
+	// maxTrackedEvents bounds the events remembered for deduplication, new events are dropped above it
+	maxTrackedEvents = 10000
+	// createdRetention is how long an event created in ror-api is remembered after it was last seen, so a repeat
+	// after a long pause updates it. Kubernetes keeps events for an hour by default.
+	createdRetention = time.Hour
+)
+
+// Results counted by ror_agent_event_feed_events_total.
+const (
+	resultSent     = "sent"
+	resultFiltered = "filtered"
+	resultRepeated = "repeated"
+	resultDropped  = "dropped"
+	resultFailed   = "failed"
+)
+
+var (
+	eventsGVR = schema.GroupVersionResource{Group: "events.k8s.io", Version: "v1", Resource: "events"}
+
+	feedEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsservice.Namespace,
+		Subsystem: "event_feed",
+		Name:      "events_total",
+		Help:      "Kubernetes events received by the event feed by result: sent, filtered, repeated, dropped or failed.",
+	}, []string{"result"})
+)
+
+// Config selects the events sent and how often.
+type Config struct {
+	// Types, Reasons and Namespaces only send the events matching one of the values, all events when empty
+	Types      []string
+	Reasons    []string
+	Namespaces []string
+	// DedupeWindow is the minimum time between sending repeats of an event
+	DedupeWindow time.Duration
+	// Limiter limits the events sent to ror-api
+	Limiter *rate.Limiter
+}
+
+// ConfigFromEnv returns the configuration from the ROR_EVENT_FEED_* variables.
+func ConfigFromEnv() Config {
+	limit := rate.Limit(rorconfig.GetInt(agentconsts.EventFeedQPSEnv))
+	if limit <= 0 {
+		limit = rate.Inf
+	}
+	return Config{
+		Types:        splitList(rorconfig.GetString(agentconsts.EventFeedTypesEnv)),
+		Reasons:      splitList(rorconfig.GetString(agentconsts.EventFeedReasonsEnv)),
+		Namespaces:   splitList(rorconfig.GetString(agentconsts.EventFeedNamespacesEnv)),
+		DedupeWindow: time.Duration(rorconfig.GetInt(agentconsts.EventFeedDedupeSecondsEnv)) * time.Second,
+		Limiter:      rate.NewLimiter(limit, max(rorconfig.GetInt(agentconsts.EventFeedBurstEnv), 1)),
+	}
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Event is a kubernetes event as sent to ror-api, it is the resource of the events.k8s.io/v1 Event resources
+// of the cluster in ror. The Uid is the uid of the first kubernetes event object sent, repeats sent later update it.
+type Event struct {
+	Uid                 string          `json:"uid"`
+	Namespace           string          `json:"namespace"`
+	Name                string          `json:"name"`
+	Type                string          `json:"type"`
+	Reason              string          `json:"reason"`
+	Note                string          `json:"note"`
+	Regarding           ObjectReference `json:"regarding"`
+	ReportingController string          `json:"reportingController,omitempty"`
+	// Count is the number of times the kubernetes event object was seen, including repeats not sent
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// ObjectReference is the object an event is about.
+type ObjectReference struct {
+	ApiVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Uid        string `json:"uid,omitempty"`
+}
+
+// key identifies the repeats of an event, kubernetes starts a new event object for a repeat after a while.
+func (e Event) key() string {
+	return strings.Join([]string{e.Regarding.Kind, e.Regarding.Namespace, e.Regarding.Name, e.Type, e.Reason, e.Note}, "\x00")
+}
+
+// Sender delivers events to ror-api. Create sends an event the first time, Update sends its repeats.
+type Sender interface {
+	Create(ctx context.Context, event Event) error
+	Update(ctx context.Context, event Event) error
+}
+
+// trackedEvent is the latest state of an event and when it was last sent.
+type trackedEvent struct {
+	event   Event
+	sentAt  time.Time
+	pending bool
+	// created is set once the event is in ror-api, its repeats are sent as updates
+	created bool
+}
+
+// createdEvent is an event created in ror-api and no longer tracked, remembered until createdRetention has passed.
+type createdEvent struct {
+	uid      string
+	lastSeen time.Time
+}
+
+// Feed receives the events from a dynamic controller and sends them to ror-api.
+type Feed struct {
+	config Config
+	sender Sender
+	now    func() time.Time
+
+	mu      sync.Mutex
+	events  map[string]*trackedEvent
+	created map[string]createdEvent
+}
+
+// NewFeed returns a feed sending the events matching config with sender, Run starts sending.
+func NewFeed(config Config, sender Sender) *Feed {
+	if config.Limiter == nil {
+		config.Limiter = rate.NewLimiter(rate.Inf, 1)
+	}
+	return &Feed{
+		config:  config,
+		sender:  sender,
+		now:     time.Now,
+		events:  make(map[string]*trackedEvent),
+		created: make(map[string]createdEvent),
+	}
+}
+
+// MayStart starts watching the events and sending them to ror-api if ROR_EVENT_FEED is set, the feed stops when ctx is canceled.
+func MayStart(ctx context.Context, client clusteragentclient.RorAgentClientInterface) {
+	if !rorconfig.GetBool(agentconsts.EventFeedEnv) {
+		return
+	}
+	dynamicClient, err := client.GetKubernetesClientset().GetDynamicClient()
+	if err != nil {
+		rlog.Error("could not start event feed", err)
+		return
+	}
+	feed := NewFeed(ConfigFromEnv(), NewRorApiSender(client))
+	for _, filter := range feed.watchFilters() {
+		dynamiccontroller.NewFilteredDynamicController(dynamicClient, feed, filter).Run(ctx)
+	}
+	go feed.Run(ctx)
+	rlog.Info("Event feed started", rlog.Any("types", feed.config.Types), rlog.Any("reasons", feed.config.Reasons), rlog.Any("namespaces", feed.config.Namespaces))
+}
+
+// watchFilters selects the events in the api server when a single type or reason is configured, one filter per namespace.
+func (f *Feed) watchFilters() []dynamiccontroller.WatchFilter {
+	var selectors []fields.Selector
+	if len(f.config.Types) == 1 {
+		selectors = append(selectors, fields.OneTermEqualSelector("type", f.config.Types[0]))
+	}
+	if len(f.config.Reasons) == 1 {
+		selectors = append(selectors, fields.OneTermEqualSelector("reason", f.config.Reasons[0]))
+	}
+	filter := dynamiccontroller.WatchFilter{}
+	if len(selectors) > 0 {
+		filter.FieldSelector = fields.AndSelectors(selectors...).String()
+	}
+	if len(f.config.Namespaces) == 0 {
+		return []dynamiccontroller.WatchFilter{filter}
+	}
+	filters := make([]dynamiccontroller.WatchFilter, 0, len(f.config.Namespaces))
+	for _, namespace := range f.config.Namespaces {
+		namespaceFilter := filter
+		namespaceFilter.Namespace = namespace
+		filters = append(filters, namespaceFilter)
+	}
+	return filters
+}
+
+func (f *Feed) GetSchema() schema.GroupVersionResource {
+	return eventsGVR
+}
+
+// GetHandlers observes added and updated events, deleted events are left in ror as kubernetes expires them after an hour.
+func (f *Feed) GetHandlers() dynamiccontroller.Resourcehandlers {
+	return dynamiccontroller.Resourcehandlers{
+		AddFunc:    f.observe,
+		UpdateFunc: func(_, obj any) { f.observe(obj) },
+	}
+}
+
+func (f *Feed) observe(obj any) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	event, err := eventFromUnstructured(u)
+	if err != nil {
+		rlog.Warn("could not read event", rlog.String("namespace", u.GetNamespace()), rlog.String("name", u.GetName()), rlog.String("error", err.Error()))
+		return
+	}
+	f.add(event)
+}
+
+// add tracks the event to be sent by the next flush. Repeats of an event sent within the dedupe window wait until it has passed.
+func (f *Feed) add(event Event) {
+	if !f.matches(event) {
+		feedEvents.WithLabelValues(resultFiltered).Inc()
+		return
+	}
+	// events from before the agent started, like those listed at start, are only sent if recent
+	if f.now().Sub(event.LastSeen) > f.staleAfter() {
+		feedEvents.WithLabelValues(resultFiltered).Inc()
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := event.key()
+	tracked, ok := f.events[key]
+	if !ok {
+		if len(f.events) >= maxTrackedEvents {
+			feedEvents.WithLabelValues(resultDropped).Inc()
+			return
+		}
+		tracked = &trackedEvent{event: event, pending: true}
+		if created, ok := f.created[key]; ok {
+			// seen again after a long pause, the event already in ror-api is updated
+			tracked.created = true
+			tracked.event.Uid = created.uid
+			delete(f.created, key)
+		}
+		f.events[key] = tracked
+		return
+	}
+	if !event.LastSeen.After(tracked.event.LastSeen) && event.Count <= tracked.event.Count {
+		return
+	}
+	if !tracked.pending {
+		feedEvents.WithLabelValues(resultRepeated).Inc()
+	}
+	event.FirstSeen = minTime(event.FirstSeen, tracked.event.FirstSeen)
+	if tracked.created {
+		// a repeat in a new kubernetes event object updates the event already in ror-api
+		event.Uid = tracked.event.Uid
+	}
+	tracked.event = event
+	tracked.pending = true
+}
+
+// staleAfter is how long an event is of interest after it was last seen.
+func (f *Feed) staleAfter() time.Duration {
+	return max(f.config.DedupeWindow, flushInterval)
+}
+
+func (f *Feed) matches(event Event) bool {
+	return matchesAny(f.config.Types, event.Type) &&
+		matchesAny(f.config.Reasons, event.Reason) &&
+		matchesAny(f.config.Namespaces, event.Namespace)
+}
+
+func matchesAny(values []string, value string) bool {
+	return len(values) == 0 || slices.Contains(values, value)
+}
+
+// Run sends the events waiting every flushInterval until ctx is canceled.
+func (f *Feed) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.flush(ctx)
+		}
+	}
+}
+
+// flush sends the events due within the rate limit and forgets events not seen within the dedupe window.
+// Events held back by the rate limit or failing to send are tried again by the next flush.
+func (f *Feed) flush(ctx context.Context) {
+	now := f.now()
+	due := f.due(now)
+	for _, tracked := range due {
+		if !f.config.Limiter.Allow() {
+			break
+		}
+		f.mu.Lock()
+		event := tracked.event
+		created := tracked.created
+		tracked.pending = false
+		tracked.sentAt = now
+		f.mu.Unlock()
+
+		if err := f.send(ctx, event, created); err != nil {
+			feedEvents.WithLabelValues(resultFailed).Inc()
+			rlog.Warn("could not send event", rlog.String("reason", event.Reason), rlog.String("regarding", event.Regarding.Kind+"/"+event.Regarding.Name), rlog.String("error", err.Error()))
+			f.mu.Lock()
+			tracked.pending = true
+			tracked.sentAt = time.Time{}
+			f.mu.Unlock()
+			continue
+		}
+		f.mu.Lock()
+		tracked.created = true
+		f.mu.Unlock()
+		feedEvents.WithLabelValues(resultSent).Inc()
+	}
+}
+
+// send creates the event in ror-api, or updates it if it is already created. An event reported as already created,
+// like an event forgotten while ror-api still has it, is updated.
+func (f *Feed) send(ctx context.Context, event Event, created bool) error {
+	if created {
+		return f.sender.Update(ctx, event)
+	}
+	err := f.sender.Create(ctx, event)
+	if statuscode.FromError(err) == http.StatusConflict {
+		return f.sender.Update(ctx, event)
+	}
+	return err
+}
+
+// due returns the events waiting to be sent, oldest first, whose last send is outside the dedupe window.
+// Events not seen within the dedupe window are forgotten, those created in ror-api are remembered for createdRetention.
+func (f *Feed) due(now time.Time) []*trackedEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var due []*trackedEvent
+	for key, tracked := range f.events {
+		switch {
+		case tracked.pending && now.Sub(tracked.sentAt) >= f.config.DedupeWindow:
+			due = append(due, tracked)
+		case !tracked.pending && now.Sub(tracked.event.LastSeen) > f.staleAfter():
+			if tracked.created && len(f.created) < maxTrackedEvents {
+				f.created[key] = createdEvent{uid: tracked.event.Uid, lastSeen: tracked.event.LastSeen}
+			}
+			delete(f.events, key)
+		}
+	}
+	for key, created := range f.created {
+		if now.Sub(created.lastSeen) > createdRetention {
+			delete(f.created, key)
+		}
+	}
+	slices.SortFunc(due, func(a, b *trackedEvent) int {
+		return a.event.LastSeen.Compare(b.event.LastSeen)
+	})
+	return due
+}
+
+func eventFromUnstructured(u *unstructured.Unstructured) (Event, error) {
+	var k8sEvent eventsv1.Event
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &k8sEvent); err != nil {
+		return Event{}, fmt.Errorf("could not convert event: %w", err)
+	}
+
+	event := Event{
+		Uid:       string(k8sEvent.UID),
+		Namespace: k8sEvent.Namespace,
+		Name:      k8sEvent.Name,
+		Type:      k8sEvent.Type,
+		Reason:    k8sEvent.Reason,
+		Note:      k8sEvent.Note,
+		Regarding: ObjectReference{
+			ApiVersion: k8sEvent.Regarding.APIVersion,
+			Kind:       k8sEvent.Regarding.Kind,
+			Namespace:  k8sEvent.Regarding.Namespace,
+			Name:       k8sEvent.Regarding.Name,
+			Uid:        string(k8sEvent.Regarding.UID),
+		},
+		ReportingController: k8sEvent.ReportingController,
+		Count:               max(k8sEvent.DeprecatedCount, 1),
+		FirstSeen:           k8sEvent.CreationTimestamp.Time,
+		LastSeen:            k8sEvent.CreationTimestamp.Time,
+	}
+	if !k8sEvent.DeprecatedFirstTimestamp.IsZero() {
+		event.FirstSeen = k8sEvent.DeprecatedFirstTimestamp.Time
+	}
+	switch {
+	case k8sEvent.Series != nil:
+		event.Count = max(k8sEvent.Series.Count, event.Count)
+		event.LastSeen = k8sEvent.Series.LastObservedTime.Time
+	case !k8sEvent.DeprecatedLastTimestamp.IsZero():
+		event.LastSeen = k8sEvent.DeprecatedLastTimestamp.Time
+	case !k8sEvent.EventTime.IsZero():
+		event.LastSeen = k8sEvent.EventTime.Time
+	}
+	return event, nil
+}
+
+func minTime(a time.Time, b time.Time) time.Time {
+	if b.IsZero() || (!a.IsZero() && a.Before(b)) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,312 @@
+package eventfeed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fakeSender records the events sent and whether they were created or updated, failing while err is set.
+// Creates fail with createErr when set.
+type fakeSender struct {
+	mu        sync.Mutex
+	sent      []Event
+	actions   []string
+	err       error
+	createErr error
+}
+
+func (s *fakeSender) Create(_ context.Context, event Event) error {
+	if s.createErr != nil {
+		return s.createErr
+	}
+	return s.record("create", event)
+}
+
+func (s *fakeSender) Update(_ context.Context, event Event) error {
+	return s.record("update", event)
+}
+
+func (s *fakeSender) record(action string, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, event)
+	s.actions = append(s.actions, action)
+	return nil
+}
+
+var start = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func testEvent(reason string, count int32, lastSeen time.Time) Event {
+	return Event{
+		Uid:       "uid-" + reason,
+		Namespace: "default",
+		Name:      "web.1",
+		Type:      "Warning",
+		Reason:    reason,
+		Note:      "something failed",
+		Regarding: ObjectReference{ApiVersion: "v1", Kind: "Pod", Namespace: "default", Name: "web"},
+		Count:     count,
+		FirstSeen: start,
+		LastSeen:  lastSeen,
+	}
+}
+
+func newTestFeed(config Config, sender Sender, now *time.Time) *Feed {
+	feed := NewFeed(config, sender)
+	feed.now = func() time.Time { return *now }
+	return feed
+}
+
+func TestFeed_filter(t *testing.T) {
+	config := Config{Types: []string{"Warning"}, Reasons: []string{"BackOff", "FailedScheduling"}, Namespaces: []string{"default"}, DedupeWindow: time.Minute}
+	tests := []struct {
+		name     string
+		event    func(Event) Event
+		wantSent bool
+	}{
+		{name: "Test matching event is sent", event: func(e Event) Event { return e }, wantSent: true},
+		{name: "Test other type is filtered", event: func(e Event) Event { e.Type = "Normal"; return e }},
+		{name: "Test other reason is filtered", event: func(e Event) Event { e.Reason = "Pulled"; return e }},
+		{name: "Test other namespace is filtered", event: func(e Event) Event { e.Namespace = "kube-system"; return e }},
+		{name: "Test stale event is filtered", event: func(e Event) Event { e.LastSeen = start.Add(-time.Hour); return e }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			sender := &fakeSender{}
+			feed := newTestFeed(config, sender, &now)
+			feed.add(tt.event(testEvent("BackOff", 1, start)))
+			feed.flush(context.Background())
+			if got := len(sender.sent) == 1; got != tt.wantSent {
+				t.Errorf("sent %d events, want sent = %t", len(sender.sent), tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestFeed_dedupe(t *testing.T) {
+	now := start
+	sender := &fakeSender{}
+	feed := newTestFeed(Config{DedupeWindow: time.Minute}, sender, &now)
+
+	feed.add(testEvent("BackOff", 1, now))
+	feed.flush(context.Background())
+
+	// repeats within the window are held back and sent once with the latest count
+	for i := int32(2); i <= 5; i++ {
+		now = now.Add(10 * time.Second)
+		feed.add(testEvent("BackOff", i, now))
+		feed.flush(context.Background())
+	}
+	if len(sender.sent) != 1 {
+		t.Fatalf("sent %d events within the dedupe window, want 1", len(sender.sent))
+	}
+
+	now = start.Add(time.Minute)
+	feed.flush(context.Background())
+	if len(sender.sent) != 2 {
+		t.Fatalf("sent %d events after the dedupe window, want 2", len(sender.sent))
+	}
+	if got := sender.sent[1].Count; got != 5 {
+		t.Errorf("repeat sent with count %d, want 5", got)
+	}
+	if want := []string{"create", "update"}; !slices.Equal(sender.actions, want) {
+		t.Errorf("sent as %v, want %v", sender.actions, want)
+	}
+
+	// an update without a new occurrence is not a repeat
+	feed.add(testEvent("BackOff", 5, start.Add(40*time.Second)))
+	now = now.Add(2 * time.Minute)
+	feed.flush(context.Background())
+	if len(sender.sent) != 2 {
+		t.Errorf("sent %d events without a repeat, want 2", len(sender.sent))
+	}
+	if len(feed.events) != 0 {
+		t.Errorf("tracking %d events not seen within the dedupe window, want 0", len(feed.events))
+	}
+}
+
+func TestFeed_repeatInNewEventObject(t *testing.T) {
+	now := start
+	sender := &fakeSender{}
+	feed := newTestFeed(Config{}, sender, &now)
+
+	feed.add(testEvent("BackOff", 1, now))
+	feed.flush(context.Background())
+
+	now = now.Add(time.Minute)
+	repeat := testEvent("BackOff", 1, now)
+	repeat.Uid = "uid-new-object"
+	feed.add(repeat)
+	feed.flush(context.Background())
+
+	if want := []string{"create", "update"}; !slices.Equal(sender.actions, want) {
+		t.Fatalf("sent as %v, want %v", sender.actions, want)
+	}
+	if got := sender.sent[1].Uid; got != sender.sent[0].Uid {
+		t.Errorf("repeat sent with uid %q, want the uid %q of the created event", got, sender.sent[0].Uid)
+	}
+}
+
+func TestFeed_repeatAfterForgotten(t *testing.T) {
+	now := start
+	sender := &fakeSender{}
+	feed := newTestFeed(Config{DedupeWindow: time.Minute}, sender, &now)
+
+	feed.add(testEvent("BackOff", 1, now))
+	feed.flush(context.Background())
+
+	// not seen for longer than the dedupe window, the event is no longer tracked
+	now = now.Add(10 * time.Minute)
+	feed.flush(context.Background())
+	if len(feed.events) != 0 {
+		t.Fatalf("tracking %d events not seen within the dedupe window, want 0", len(feed.events))
+	}
+
+	repeat := testEvent("BackOff", 2, now)
+	repeat.Uid = "uid-new-object"
+	feed.add(repeat)
+	feed.flush(context.Background())
+
+	if want := []string{"create", "update"}; !slices.Equal(sender.actions, want) {
+		t.Fatalf("sent as %v, want %v", sender.actions, want)
+	}
+	if got := sender.sent[1].Uid; got != sender.sent[0].Uid {
+		t.Errorf("repeat sent with uid %q, want the uid %q of the created event", got, sender.sent[0].Uid)
+	}
+
+	// forgotten after createdRetention
+	now = now.Add(10 * time.Minute)
+	feed.flush(context.Background())
+	now = now.Add(createdRetention)
+	feed.flush(context.Background())
+	if len(feed.created) != 0 {
+		t.Errorf("remembering %d created events after %s, want 0", len(feed.created), createdRetention)
+	}
+}
+
+func TestFeed_createConflict(t *testing.T) {
+	now := start
+	sender := &fakeSender{createErr: statuscode.New(http.StatusConflict, "already exists")}
+	feed := newTestFeed(Config{}, sender, &now)
+
+	feed.add(testEvent("BackOff", 1, now))
+	feed.flush(context.Background())
+
+	if want := []string{"update"}; !slices.Equal(sender.actions, want) {
+		t.Errorf("sent as %v, want %v", sender.actions, want)
+	}
+}
+
+func TestFeed_flushRetriesAndLimits(t *testing.T) {
+	now := start
+	sender := &fakeSender{err: errors.New("ror-api unavailable")}
+	feed := newTestFeed(Config{Limiter: rate.NewLimiter(rate.Every(time.Hour), 2)}, sender, &now)
+
+	for _, reason := range []string{"BackOff", "FailedScheduling", "OOMKilling"} {
+		feed.add(testEvent(reason, 1, now))
+	}
+	feed.flush(context.Background())
+	if len(sender.sent) != 0 {
+		t.Fatalf("sent %d events while failing", len(sender.sent))
+	}
+
+	sender.err = nil
+	feed.config.Limiter = rate.NewLimiter(rate.Every(time.Hour), 2)
+	feed.flush(context.Background())
+	if len(sender.sent) != 2 {
+		t.Fatalf("sent %d events, want 2 allowed by the rate limit", len(sender.sent))
+	}
+
+	feed.config.Limiter = rate.NewLimiter(rate.Inf, 1)
+	feed.flush(context.Background())
+	if len(sender.sent) != 3 {
+		t.Errorf("sent %d events, want the event held back by the rate limit sent by the next flush", len(sender.sent))
+	}
+}
+
+func TestEventFromUnstructured(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "events.k8s.io/v1",
+		"kind":       "Event",
+		"metadata": map[string]any{
+			"name":              "web.1",
+			"namespace":         "default",
+			"uid":               "1234",
+			"creationTimestamp": "2026-01-01T11:00:00Z",
+		},
+		"type":                "Warning",
+		"reason":              "BackOff",
+		"note":                "Back-off restarting failed container",
+		"reportingController": "kubelet",
+		"eventTime":           nil,
+		"regarding": map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"namespace":  "default",
+			"name":       "web",
+		},
+		"series": map[string]any{
+			"count":            int64(7),
+			"lastObservedTime": "2026-01-01T12:00:00.000000Z",
+		},
+	}}
+	event, err := eventFromUnstructured(u)
+	if err != nil {
+		t.Fatalf("eventFromUnstructured() error = %v", err)
+	}
+	if event.Uid != "1234" || event.Reason != "BackOff" || event.Regarding.Kind != "Pod" || event.Regarding.Name != "web" {
+		t.Errorf("eventFromUnstructured() = %+v", event)
+	}
+	if event.Count != 7 {
+		t.Errorf("Count = %d, want 7 from the series", event.Count)
+	}
+	if !event.LastSeen.Equal(start) {
+		t.Errorf("LastSeen = %s, want %s from the series", event.LastSeen, start)
+	}
+	if !event.FirstSeen.Equal(start.Add(-time.Hour)) {
+		t.Errorf("FirstSeen = %s, want the creation time", event.FirstSeen)
+	}
+}
+
+func TestFeed_watchFilters(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		wantFilters   int
+		wantSelector  string
+		wantNamespace string
+	}{
+		{name: "Test all events", config: Config{}, wantFilters: 1},
+		{name: "Test single type and reason are selected by the api server", config: Config{Types: []string{"Warning"}, Reasons: []string{"BackOff"}}, wantFilters: 1, wantSelector: "type=Warning,reason=BackOff"},
+		{name: "Test several reasons are filtered by the feed", config: Config{Types: []string{"Warning"}, Reasons: []string{"BackOff", "Failed"}}, wantFilters: 1, wantSelector: "type=Warning"},
+		{name: "Test one filter per namespace", config: Config{Namespaces: []string{"default", "ror"}}, wantFilters: 2, wantNamespace: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := NewFeed(tt.config, &fakeSender{}).watchFilters()
+			if len(filters) != tt.wantFilters {
+				t.Fatalf("got %d filters, want %d", len(filters), tt.wantFilters)
+			}
+			if filters[0].FieldSelector != tt.wantSelector {
+				t.Errorf("FieldSelector = %q, want %q", filters[0].FieldSelector, tt.wantSelector)
+			}
+			if filters[0].Namespace != tt.wantNamespace {
+				t.Errorf("Namespace = %q, want %q", filters[0].Namespace, tt.wantNamespace)
+			}
+		})
+	}
+}
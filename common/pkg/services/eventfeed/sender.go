@@ -0,0 +1,70 @@
+package eventfeed
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+)
+
+// eventKind is the kind of the events in ror, sent with the api version of eventsGVR and an Event as resource.
+const eventKind = "Event"
+
+type rorApiSender struct {
+	client clusteragentclient.RorAgentClientInterface
+}
+
+// NewRorApiSender returns a sender creating the events as events.k8s.io/v1 Event resources owned by the cluster,
+// and updating them with their repeats.
+func NewRorApiSender(client clusteragentclient.RorAgentClientInterface) Sender {
+	return &rorApiSender{client: client}
+}
+
+func (s *rorApiSender) Create(ctx context.Context, event Event) error {
+	rorClient := s.client.GetRorClient()
+	ctx, cancel := timeouts.RorApi(ctx)
+	defer cancel()
+	start := time.Now()
+	err := rorClient.V1().Resources().Create(ctx, s.resourceUpdate(event, apiresourcecontracts.K8sActionAdd))
+	metricsservice.ObserveRorApiRequest("events_create", start, err)
+	return err
+}
+
+func (s *rorApiSender) Update(ctx context.Context, event Event) error {
+	rorClient := s.client.GetRorClient()
+	ctx, cancel := timeouts.RorApi(ctx)
+	defer cancel()
+	start := time.Now()
+	err := rorClient.V1().Resources().Update(ctx, s.resourceUpdate(event, apiresourcecontracts.K8sActionUpdate))
+	metricsservice.ObserveRorApiRequest("events_update", start, err)
+	return err
+}
+
+func (s *rorApiSender) resourceUpdate(event Event, action apiresourcecontracts.ResourceAction) *apiresourcecontracts.ResourceUpdateModel {
+	owner := s.client.GetRorClient().GetOwnerref()
+	return &apiresourcecontracts.ResourceUpdateModel{
+		Owner: apiresourcecontracts.ResourceOwnerReference{
+			Scope:   owner.Scope,
+			Subject: string(owner.Subject),
+		},
+		ApiVersion: eventsGVR.GroupVersion().String(),
+		Kind:       eventKind,
+		Uid:        event.Uid,
+		Action:     action,
+		Hash:       eventHash(event),
+		Resource:   event,
+	}
+}
+
+// eventHash changes when an event is seen again.
+func eventHash(event Event) string {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s/%d/%d", event.Uid, event.Count, event.LastSeen.UnixNano())
+	return fmt.Sprintf("%016x", h.Sum64())
+}
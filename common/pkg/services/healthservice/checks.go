@@ -0,0 +1,186 @@
+package healthservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Probe selects the checks run by an endpoint of the agent health server.
+type Probe int
+
+const (
+	// ProbeNone checks are only reported by /health.
+	ProbeNone Probe = iota
+	// ProbeLiveness checks fail when the agent is stuck and only a restart helps, they are reported by /livez and /readyz.
+	ProbeLiveness
+	// ProbeReadiness checks fail when the agent is not doing its work, like before the initial lists are done
+	// or while ror-api or kubernetes can't be reached. They are reported by /readyz.
+	ProbeReadiness
+)
+
+// CheckResult is the outcome of a single agent health check.
+type CheckResult struct {
+	Status Status `json:"status"`
+	Output string `json:"output,omitempty"`
+}
+
+// CheckFunc reports the current health of an agent subsystem.
+type CheckFunc func() CheckResult
+
+type healthReport struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type registeredCheck struct {
+	check CheckFunc
+	probe Probe
+}
+
+var (
+	checksLock sync.RWMutex
+	checks     = map[string]registeredCheck{}
+
+	lastSuccessLock sync.Mutex
+	lastSuccess     = map[string]time.Time{}
+)
+
+// RegisterCheck registers or replaces the agent health check with the given name, it is only reported by /health.
+func RegisterCheck(name string, check CheckFunc) {
+	registerCheck(name, check, ProbeNone)
+}
+
+// RegisterLivenessCheck registers or replaces a check failing the liveness probe.
+func RegisterLivenessCheck(name string, check CheckFunc) {
+	registerCheck(name, check, ProbeLiveness)
+}
+
+// RegisterReadinessCheck registers or replaces a check failing the readiness probe.
+func RegisterReadinessCheck(name string, check CheckFunc) {
+	registerCheck(name, check, ProbeReadiness)
+}
+
+func registerCheck(name string, check CheckFunc, probe Probe) {
+	checksLock.Lock()
+	defer checksLock.Unlock()
+	checks[name] = registeredCheck{check: check, probe: probe}
+}
+
+// UnregisterCheck removes the check with the given name, if registered.
+func UnregisterCheck(name string) {
+	checksLock.Lock()
+	defer checksLock.Unlock()
+	delete(checks, name)
+}
+
+// RegisterLastSuccessCheck registers a readiness check failing when the periodic task has not succeeded
+// within maxAge, counted from now until RecordSuccess is first called for it.
+func RegisterLastSuccessCheck(task string, maxAge time.Duration) {
+	lastSuccessLock.Lock()
+	if _, ok := lastSuccess[task]; !ok {
+		lastSuccess[task] = time.Now()
+	}
+	lastSuccessLock.Unlock()
+
+	RegisterReadinessCheck(task, func() CheckResult {
+		lastSuccessLock.Lock()
+		last := lastSuccess[task]
+		lastSuccessLock.Unlock()
+		if age := time.Since(last); age > maxAge {
+			return CheckResult{Status: StatusFail, Output: fmt.Sprintf("%s last succeeded %s ago", task, age.Round(time.Second))}
+		}
+		return CheckResult{Status: StatusPass}
+	})
+}
+
+// RecordSuccess records that the periodic task succeeded now.
+func RecordSuccess(task string) {
+	lastSuccessLock.Lock()
+	defer lastSuccessLock.Unlock()
+	lastSuccess[task] = time.Now()
+}
+
+// RunChecks runs all registered checks and returns the combined status,
+// which is the worst status reported by any check.
+func RunChecks() (Status, map[string]CheckResult) {
+	return runChecks(func(Probe) bool { return true })
+}
+
+// RunProbe runs the checks of the probe and returns the combined status. The readiness probe includes the liveness checks.
+func RunProbe(probe Probe) (Status, map[string]CheckResult) {
+	return runChecks(func(p Probe) bool {
+		return p == probe || (probe == ProbeReadiness && p == ProbeLiveness)
+	})
+}
+
+func runChecks(include func(Probe) bool) (Status, map[string]CheckResult) {
+	checksLock.RLock()
+	names := make([]string, 0, len(checks))
+	for name, registered := range checks {
+		if include(registered.probe) {
+			names = append(names, name)
+		}
+	}
+	checksLock.RUnlock()
+	sort.Strings(names)
+
+	status := StatusPass
+	results := make(map[string]CheckResult, len(names))
+	for _, name := range names {
+		checksLock.RLock()
+		registered, ok := checks[name]
+		checksLock.RUnlock()
+		if !ok {
+			continue
+		}
+
+		result := registered.check()
+		results[name] = result
+		status = worstStatus(status, result.Status)
+	}
+	return status, results
+}
+
+func worstStatus(a Status, b Status) Status {
+	if a == StatusFail || b == StatusFail {
+		return StatusFail
+	}
+	if a == StatusWarn || b == StatusWarn {
+		return StatusWarn
+	}
+	return StatusPass
+}
+
+// checksHandler serves the registered checks as json, responding 503 if any check fails.
+func checksHandler(w http.ResponseWriter, _ *http.Request) {
+	writeReport(w, RunChecks)
+}
+
+// probeHandler serves the checks of the probe as json, responding 503 if any check fails.
+func probeHandler(probe Probe) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeReport(w, func() (Status, map[string]CheckResult) { return RunProbe(probe) })
+	}
+}
+
+func writeReport(w http.ResponseWriter, run func() (Status, map[string]CheckResult)) {
+	status, results := run()
+
+	w.Header().Set("Content-Type", "application/json")
+	if status == StatusFail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(healthReport{Status: status, Checks: results})
+}
@@ -0,0 +1,116 @@
+package healthservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func check(status Status) CheckFunc {
+	return func() CheckResult { return CheckResult{Status: status} }
+}
+
+func resetChecks(t *testing.T) {
+	t.Helper()
+	checksLock.Lock()
+	checks = map[string]registeredCheck{}
+	checksLock.Unlock()
+	lastSuccessLock.Lock()
+	lastSuccess = map[string]time.Time{}
+	lastSuccessLock.Unlock()
+}
+
+func TestRunProbe(t *testing.T) {
+	tests := []struct {
+		name       string
+		probe      Probe
+		wantStatus Status
+		wantChecks []string
+	}{
+		{name: "liveness only runs liveness checks", probe: ProbeLiveness, wantStatus: StatusPass, wantChecks: []string{"live"}},
+		{name: "readiness includes liveness checks", probe: ProbeReadiness, wantStatus: StatusFail, wantChecks: []string{"live", "ready"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetChecks(t)
+			RegisterCheck("info", check(StatusWarn))
+			RegisterLivenessCheck("live", check(StatusPass))
+			RegisterReadinessCheck("ready", check(StatusFail))
+
+			status, results := RunProbe(tt.probe)
+			if status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", status, tt.wantStatus)
+			}
+			names := make([]string, 0, len(results))
+			for name := range results {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			if !slices.Equal(names, tt.wantChecks) {
+				t.Errorf("checks = %v, want %v", names, tt.wantChecks)
+			}
+		})
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	resetChecks(t)
+	RegisterCheck("info", check(StatusWarn))
+	RegisterLivenessCheck("live", check(StatusPass))
+	if status, results := RunChecks(); status != StatusWarn || len(results) != 2 {
+		t.Errorf("RunChecks() = %s with %d checks, want %s with 2", status, len(results), StatusWarn)
+	}
+
+	RegisterReadinessCheck("ready", check(StatusFail))
+	UnregisterCheck("ready")
+	if status, _ := RunChecks(); status != StatusWarn {
+		t.Errorf("status = %s after unregistering the failing check, want %s", status, StatusWarn)
+	}
+}
+
+func TestRegisterLastSuccessCheck(t *testing.T) {
+	resetChecks(t)
+	RegisterLastSuccessCheck("task", time.Hour)
+	if status, _ := RunProbe(ProbeReadiness); status != StatusPass {
+		t.Errorf("status = %s right after registering, want %s", status, StatusPass)
+	}
+
+	lastSuccessLock.Lock()
+	lastSuccess["task"] = time.Now().Add(-2 * time.Hour)
+	lastSuccessLock.Unlock()
+	status, results := RunProbe(ProbeReadiness)
+	if status != StatusFail || results["task"].Output == "" {
+		t.Errorf("RunProbe() = %s %v for a stale task, want %s with output", status, results["task"], StatusFail)
+	}
+	if status, _ := RunProbe(ProbeLiveness); status != StatusPass {
+		t.Errorf("liveness status = %s for a stale task, want %s", status, StatusPass)
+	}
+
+	RecordSuccess("task")
+	if status, _ := RunProbe(ProbeReadiness); status != StatusPass {
+		t.Errorf("status = %s after RecordSuccess, want %s", status, StatusPass)
+	}
+}
+
+func TestProbeHandler(t *testing.T) {
+	resetChecks(t)
+	RegisterLivenessCheck("live", check(StatusPass))
+	RegisterReadinessCheck("ready", check(StatusFail))
+
+	tests := []struct {
+		probe Probe
+		want  int
+	}{
+		{probe: ProbeLiveness, want: http.StatusOK},
+		{probe: ProbeReadiness, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		probeHandler(tt.probe)(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != tt.want {
+			t.Errorf("probe %d responded %d, want %d", tt.probe, rec.Code, tt.want)
+		}
+	}
+}
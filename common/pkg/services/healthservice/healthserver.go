@@ -1,6 +1,10 @@
 package healthservice
 
 import (
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
 	"github.com/NorskHelsenett/ror/pkg/config/configconsts"
 	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
 	healthserver "github.com/NorskHelsenett/ror/pkg/helpers/rorhealth/server"
@@ -14,4 +18,28 @@ func MustStart() {
 	if err != nil {
 		rlog.Fatal("could not start health server", err)
 	}
+
+	mayStartAgentHealthServer()
+}
+
+// mayStartAgentHealthServer serves the registered checks on ROR_AGENT_HEALTH_ENDPOINT, every check on /health,
+// the liveness checks on /livez and the readiness and liveness checks on /readyz.
+func mayStartAgentHealthServer() {
+	endpoint := rorconfig.GetString(agentconsts.AgentHealthEndpointEnv)
+	if endpoint == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", checksHandler)
+	mux.HandleFunc("/livez", probeHandler(ProbeLiveness))
+	mux.HandleFunc("/readyz", probeHandler(ProbeReadiness))
+
+	go func() {
+		rlog.Info("Starting agent health server", rlog.String("endpoint", endpoint))
+		err := http.ListenAndServe(endpoint, mux) // #nosec G114 - internal health endpoint
+		if err != nil {
+			rlog.Error("could not start agent health server", err)
+		}
+	}()
 }
@@ -0,0 +1,215 @@
+// Package leaderelectionservice lets one of several agent replicas do the work, using a Lease in POD_NAMESPACE.
+// The other replicas wait as standby with their ror-api client ready, and take over when the lease of the leader expires.
+package leaderelectionservice
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/lifecycleservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
+
+	"github.com/NorskHelsenett/ror/pkg/config/configconsts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+var isLeader = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsservice.Namespace,
+	Subsystem: "leader_election",
+	Name:      "is_leader",
+	Help:      "1 when this replica holds the lease and does the work of the agent, 0 on standby, by lease.",
+}, []string{"lease"})
+
+// Config configures the leader election.
+type Config struct {
+	Enabled   bool
+	Namespace string
+	LeaseName string
+	// Identity names this replica in the lease, the pod name by default
+	Identity      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// ConfigFromEnv returns the configuration from ROR_LEADER_ELECTION and the ROR_LEADER_ELECTION_* variables,
+// the lease is created in POD_NAMESPACE.
+func ConfigFromEnv() Config {
+	identity, err := os.Hostname()
+	if err != nil || identity == "" {
+		identity = fmt.Sprintf("ror-agent-%d", os.Getpid())
+	}
+	return Config{
+		Enabled:       rorconfig.GetBool(agentconsts.LeaderElectionEnv),
+		Namespace:     rorconfig.GetString(configconsts.POD_NAMESPACE),
+		LeaseName:     rorconfig.GetString(agentconsts.LeaderElectionLeaseNameEnv),
+		Identity:      identity,
+		LeaseDuration: time.Duration(rorconfig.GetInt(agentconsts.LeaderElectionLeaseDurationSecondsEnv)) * time.Second,
+		RenewDeadline: time.Duration(rorconfig.GetInt(agentconsts.LeaderElectionRenewDeadlineSecondsEnv)) * time.Second,
+		RetryPeriod:   time.Duration(rorconfig.GetInt(agentconsts.LeaderElectionRetryPeriodSecondsEnv)) * time.Second,
+	}
+}
+
+// MustRun calls lead once this replica is the leader, configured by ConfigFromEnv, with the shard of the cluster it watches.
+// The context passed to lead is canceled when the agent shuts down or the leadership is lost,
+// losing it also shuts the agent down so the replica restarts as standby. MustRun does not wait for the leadership.
+//
+// When sharded every shard has its own lease. A replica given a shard by ROR_SHARD_INDEX leads it if leader election
+// is enabled, other replicas claim the first shard without a leader and wait as standby for any shard when all are taken.
+func MustRun(lifecycle *lifecycleservice.Lifecycle, client clusteragentclient.RorAgentClientInterface, lead func(ctx context.Context, shard sharding.Shard)) {
+	cfg := ConfigFromEnv()
+	shards, err := sharding.ConfigFromEnv()
+	if err != nil {
+		rlog.Fatal("invalid sharding configuration", err)
+	}
+	index := max(shards.Index, 0)
+	if !cfg.Enabled && (!shards.Enabled() || shards.Index >= 0) {
+		lead(lifecycle.Context(), shards.Shard(index))
+		return
+	}
+
+	clientset, err := client.GetKubernetesClientset().GetKubernetesClientset()
+	if err != nil {
+		rlog.Fatal("could not get kubernetes clientset for leader election", err)
+	}
+	lost := func() {
+		rlog.Warn("Lost leadership, shutting down", rlog.String("identity", cfg.Identity))
+		lifecycle.Stop()
+	}
+	switch {
+	case !shards.Enabled():
+		err = Run(lifecycle.Context(), clientset, cfg, func(ctx context.Context) { lead(ctx, shards.Shard(0)) }, lost)
+	case shards.Index >= 0:
+		cfg.LeaseName = shardLeaseName(cfg.LeaseName, shards.Index)
+		err = Run(lifecycle.Context(), clientset, cfg, func(ctx context.Context) { lead(ctx, shards.Shard(index)) }, lost)
+	default:
+		err = RunSharded(lifecycle.Context(), clientset, cfg, shards.Count, func(ctx context.Context, index int) { lead(ctx, shards.Shard(index)) }, lost)
+	}
+	if err != nil {
+		rlog.Fatal("could not start leader election", err)
+	}
+}
+
+// RunSharded competes for the lease of every shard and calls lead with the first shard acquired, the other leases
+// are given up. Like Run, lost is called when the lease of that shard is lost while ctx is still active.
+// The shard leases are used even if cfg is not enabled.
+func RunSharded(ctx context.Context, clientset kubernetes.Interface, cfg Config, count int, lead func(ctx context.Context, index int), lost func()) error {
+	claimed := atomic.Int64{}
+	claimed.Store(-1)
+
+	cancels := make([]context.CancelFunc, count)
+	contexts := make([]context.Context, count)
+	for index := range count {
+		contexts[index], cancels[index] = context.WithCancel(ctx)
+	}
+	for index := range count {
+		shardCfg := cfg
+		shardCfg.Enabled = true
+		shardCfg.LeaseName = shardLeaseName(cfg.LeaseName, index)
+		err := Run(contexts[index], clientset, shardCfg, func(leadCtx context.Context) {
+			if !claimed.CompareAndSwap(-1, int64(index)) {
+				// another shard was acquired first, give this lease to another replica
+				cancels[index]()
+				return
+			}
+			for other, cancel := range cancels {
+				if other != index {
+					cancel()
+				}
+			}
+			lead(leadCtx, index)
+		}, lost)
+		if err != nil {
+			for _, cancel := range cancels {
+				cancel()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func shardLeaseName(leaseName string, index int) string {
+	return fmt.Sprintf("%s-shard-%d", leaseName, index)
+}
+
+// Run calls lead once this replica holds the lease, with a context canceled when ctx is canceled or the lease is lost.
+// lost is called when the lease is lost while ctx is still active. The lease is released when ctx is canceled,
+// so a standby replica takes over without waiting for it to expire. With leader election disabled lead is called with ctx.
+func Run(ctx context.Context, clientset kubernetes.Interface, cfg Config, lead func(ctx context.Context), lost func()) error {
+	if !cfg.Enabled {
+		lead(ctx)
+		return nil
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      cfg.LeaseName,
+			Namespace: cfg.Namespace,
+		},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: cfg.Identity},
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            cfg.LeaseName,
+		LeaseDuration:   cfg.LeaseDuration,
+		RenewDeadline:   cfg.RenewDeadline,
+		RetryPeriod:     cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				rlog.Info("Leading, starting the agent", rlog.String("lease", cfg.LeaseName), rlog.String("identity", cfg.Identity))
+				isLeader.WithLabelValues(cfg.LeaseName).Set(1)
+				lead(ctx)
+			},
+			OnStoppedLeading: func() {
+				isLeader.WithLabelValues(cfg.LeaseName).Set(0)
+				// also called when ctx is canceled on standby, with ctx active the lease was acquired and lost
+				if ctx.Err() == nil {
+					lost()
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if identity != cfg.Identity {
+					rlog.Info("Standby, another replica is leading", rlog.String("lease", cfg.LeaseName), rlog.String("leader", identity))
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	healthCheckName := "leaderElection:" + cfg.LeaseName
+	healthservice.RegisterCheck(healthCheckName, func() healthservice.CheckResult {
+		if elector.IsLeader() {
+			return healthservice.CheckResult{Status: healthservice.StatusPass, Output: "leading"}
+		}
+		return healthservice.CheckResult{Status: healthservice.StatusPass, Output: fmt.Sprintf("standby, %q is leading", elector.GetLeader())}
+	})
+
+	rlog.Info("Waiting for leadership", rlog.String("lease", cfg.LeaseName), rlog.String("namespace", cfg.Namespace), rlog.String("identity", cfg.Identity))
+	go func() {
+		// Run returns when ctx is canceled or the lease is lost, a lost lease is not retried as lost shuts the agent down
+		elector.Run(ctx)
+		healthservice.UnregisterCheck(healthCheckName)
+	}()
+	return nil
+}
@@ -0,0 +1,146 @@
+package leaderelectionservice
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testConfig(identity string) Config {
+	return Config{
+		Enabled:       true,
+		Namespace:     "ror",
+		LeaseName:     "ror-agent",
+		Identity:      identity,
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+}
+
+// replica records the calls of a leader election candidate.
+type replica struct {
+	leading atomic.Bool
+	lost    atomic.Bool
+	cancel  context.CancelFunc
+}
+
+func startReplica(t *testing.T, clientset kubernetes.Interface, identity string) *replica {
+	t.Helper()
+	r := &replica{}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	t.Cleanup(cancel)
+	err := Run(ctx, clientset, testConfig(identity), func(context.Context) { r.leading.Store(true) }, func() { r.lost.Store(true) })
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	return r
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRun_disabled(t *testing.T) {
+	ctx := context.Background()
+	var got context.Context
+	err := Run(ctx, nil, Config{}, func(ctx context.Context) { got = ctx }, func() { t.Errorf("lost called without leader election") })
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != ctx {
+		t.Errorf("lead was not called with ctx")
+	}
+}
+
+func TestRun_standbyTakesOver(t *testing.T) {
+	clientset := fake.NewClientset()
+	first := startReplica(t, clientset, "first")
+	waitFor(t, "the first replica to lead", first.leading.Load)
+
+	second := startReplica(t, clientset, "second")
+	time.Sleep(300 * time.Millisecond)
+	if second.leading.Load() {
+		t.Fatalf("second replica leads while the first holds the lease")
+	}
+
+	first.cancel()
+	waitFor(t, "the second replica to take over", second.leading.Load)
+	if first.lost.Load() {
+		t.Errorf("lost called for a replica shutting down")
+	}
+}
+
+func TestRun_lost(t *testing.T) {
+	clientset := fake.NewClientset()
+	var unreachable atomic.Bool
+	// once unreachable the lease can no longer be renewed
+	clientset.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if unreachable.Load() {
+			return true, nil, errors.New("api server unreachable")
+		}
+		return false, nil, nil
+	})
+	r := startReplica(t, clientset, "first")
+	waitFor(t, "the replica to lead", r.leading.Load)
+
+	unreachable.Store(true)
+	waitFor(t, "the leadership to be lost", r.lost.Load)
+}
+
+// shardReplica records the shard claimed by a sharded leader election candidate.
+type shardReplica struct {
+	shard  atomic.Int64
+	cancel context.CancelFunc
+}
+
+func startShardReplica(t *testing.T, clientset kubernetes.Interface, identity string, count int) *shardReplica {
+	t.Helper()
+	r := &shardReplica{}
+	r.shard.Store(-1)
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	t.Cleanup(cancel)
+	cfg := testConfig(identity)
+	cfg.Enabled = false
+	err := RunSharded(ctx, clientset, cfg, count, func(_ context.Context, index int) { r.shard.Store(int64(index)) }, func() {})
+	if err != nil {
+		t.Fatalf("RunSharded() error = %v", err)
+	}
+	return r
+}
+
+func TestRunSharded(t *testing.T) {
+	clientset := fake.NewClientset()
+	first := startShardReplica(t, clientset, "first", 2)
+	waitFor(t, "the first replica to claim a shard", func() bool { return first.shard.Load() >= 0 })
+	second := startShardReplica(t, clientset, "second", 2)
+	waitFor(t, "the second replica to claim a shard", func() bool { return second.shard.Load() >= 0 })
+	if first.shard.Load() == second.shard.Load() {
+		t.Fatalf("both replicas claimed shard %d", first.shard.Load())
+	}
+
+	standby := startShardReplica(t, clientset, "standby", 2)
+	time.Sleep(300 * time.Millisecond)
+	if standby.shard.Load() >= 0 {
+		t.Fatalf("standby replica claimed shard %d while every shard has a leader", standby.shard.Load())
+	}
+
+	first.cancel()
+	waitFor(t, "the standby replica to take over", func() bool { return standby.shard.Load() == first.shard.Load() })
+}
@@ -0,0 +1,141 @@
+// Package lifecycleservice shuts the agent down in order when it receives SIGTERM or SIGINT.
+package lifecycleservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+)
+
+// Exit codes returned by Wait.
+const (
+	ExitOK              = 0
+	ExitShutdownFailed  = 1
+	ExitShutdownTimeout = 2
+)
+
+// ShutdownFunc stops a part of the agent, it should return when ctx expires.
+type ShutdownFunc func(ctx context.Context) error
+
+type shutdownHook struct {
+	name string
+	fn   ShutdownFunc
+}
+
+// Lifecycle holds the root context of the agent and the hooks run at shutdown.
+type Lifecycle struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	// stopped is closed by Stop
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	mu    sync.Mutex
+	hooks []shutdownHook
+}
+
+// NewLifecycle returns a lifecycle giving the shutdown hooks timeout to complete.
+func NewLifecycle(timeout time.Duration) *Lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Lifecycle{
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: timeout,
+		stopped: make(chan struct{}),
+	}
+}
+
+// NewLifecycleFromConfig returns a lifecycle using ROR_SHUTDOWN_TIMEOUT_SECONDS as the shutdown deadline.
+func NewLifecycleFromConfig() *Lifecycle {
+	return NewLifecycle(time.Duration(rorconfig.GetInt(agentconsts.ShutdownTimeoutSecondsEnv)) * time.Second)
+}
+
+// Context returns the root context of the agent, it is canceled once the shutdown hooks have run.
+// Work bound to it, like holding the leader lease, goes on while the hooks drain the agent.
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// OnShutdown registers fn to run at shutdown. Hooks run one at a time in the order they are registered.
+func (l *Lifecycle) OnShutdown(name string, fn ShutdownFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Stop begins the shutdown without a signal.
+func (l *Lifecycle) Stop() {
+	l.stopOnce.Do(func() { close(l.stopped) })
+}
+
+// Wait blocks until a signal is received on sigs or Stop is called, shuts down and returns the exit code of the agent.
+func (l *Lifecycle) Wait(sigs <-chan os.Signal) int {
+	select {
+	case sig := <-sigs:
+		rlog.Info("Shutting down...", rlog.String("signal", sig.String()))
+	case <-l.stopped:
+		rlog.Info("Shutting down...")
+	}
+
+	err := l.Shutdown()
+	switch {
+	case err == nil:
+		rlog.Info("Shutdown complete")
+		return ExitOK
+	case errors.Is(err, context.DeadlineExceeded):
+		rlog.Error("Shutdown did not complete before the deadline", err, rlog.String("timeout", l.timeout.String()))
+		return ExitShutdownTimeout
+	default:
+		rlog.Error("Shutdown failed", err)
+		return ExitShutdownFailed
+	}
+}
+
+// Shutdown runs the shutdown hooks and then cancels the root context, all hooks share the shutdown deadline.
+// The root context is canceled last so the leader lease is only released once the agent is drained.
+// A hook still running at the deadline is abandoned, the remaining hooks are started with the expired context but not waited for.
+func (l *Lifecycle) Shutdown() error {
+	defer l.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	l.mu.Lock()
+	hooks := l.hooks
+	l.mu.Unlock()
+
+	var errs []error
+	for _, hook := range hooks {
+		started := time.Now()
+		err := runHook(ctx, hook)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hook.name, err))
+			rlog.Error("shutdown step failed", err, rlog.String("step", hook.name))
+			continue
+		}
+		rlog.Info("shutdown step done", rlog.String("step", hook.name), rlog.String("duration", time.Since(started).String()))
+	}
+	return errors.Join(errs...)
+}
+
+func runHook(ctx context.Context, hook shutdownHook) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
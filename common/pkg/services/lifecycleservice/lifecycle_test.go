@@ -0,0 +1,84 @@
+package lifecycleservice
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLifecycle_Wait(t *testing.T) {
+	tests := []struct {
+		name     string
+		hooks    []ShutdownFunc
+		wantCode int
+	}{
+		{
+			name: "Test clean shutdown",
+			hooks: []ShutdownFunc{
+				func(context.Context) error { return nil },
+			},
+			wantCode: ExitOK,
+		}, {
+			name: "Test failing hook",
+			hooks: []ShutdownFunc{
+				func(context.Context) error { return errors.New("flush failed") },
+				func(context.Context) error { return nil },
+			},
+			wantCode: ExitShutdownFailed,
+		}, {
+			name: "Test hook exceeding the deadline",
+			hooks: []ShutdownFunc{
+				func(ctx context.Context) error {
+					time.Sleep(time.Second)
+					return nil
+				},
+			},
+			wantCode: ExitShutdownTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle := NewLifecycle(50 * time.Millisecond)
+			for i, hook := range tt.hooks {
+				lifecycle.OnShutdown(string(rune('a'+i)), hook)
+			}
+			sigs := make(chan os.Signal, 1)
+			sigs <- syscall.SIGTERM
+
+			if got := lifecycle.Wait(sigs); got != tt.wantCode {
+				t.Errorf("Wait() = %d, want %d", got, tt.wantCode)
+			}
+			if lifecycle.Context().Err() == nil {
+				t.Errorf("Wait() did not cancel the root context")
+			}
+		})
+	}
+}
+
+func TestLifecycle_ShutdownOrder(t *testing.T) {
+	lifecycle := NewLifecycle(time.Second)
+	var order []string
+	for _, name := range []string{"watchers", "resourcecache", "scheduler"} {
+		lifecycle.OnShutdown(name, func(ctx context.Context) error {
+			if lifecycle.Context().Err() != nil {
+				t.Errorf("hook %s ran after the root context was canceled", name)
+			}
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	lifecycle.Stop()
+	if got := lifecycle.Wait(make(chan os.Signal)); got != ExitOK {
+		t.Fatalf("Wait() = %d, want %d", got, ExitOK)
+	}
+	want := []string{"watchers", "resourcecache", "scheduler"}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("hooks ran in order %v, want %v", order, want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package metricsservice
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rorApiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "ror_api",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of the requests to ror-api by operation and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "code"})
+
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful run of a periodic task, like the heartbeat.",
+	}, []string{"task"})
+)
+
+// ObserveRorApiRequest records the duration and status code of a ror-api request started at start.
+// The code is 2xx for a successful request and error when a failed request has no status code.
+func ObserveRorApiRequest(operation string, start time.Time, err error) {
+	rorApiRequestDuration.WithLabelValues(operation, statusCodeLabel(err)).Observe(time.Since(start).Seconds())
+}
+
+func statusCodeLabel(err error) string {
+	if err == nil {
+		return "2xx"
+	}
+	if code := statuscode.FromError(err); code != 0 {
+		return strconv.Itoa(code)
+	}
+	return "error"
+}
+
+// SetLastSuccess records that the periodic task succeeded now.
+func SetLastSuccess(task string) {
+	lastSuccess.WithLabelValues(task).SetToCurrentTime()
+}
@@ -0,0 +1,55 @@
+package metricsservice
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// requestCount returns the number of requests observed for the operation and status code.
+func requestCount(t *testing.T, operation string, code string) uint64 {
+	t.Helper()
+	metrics := make(chan prometheus.Metric, 100)
+	rorApiRequestDuration.Collect(metrics)
+	close(metrics)
+	for metric := range metrics {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{}
+		for _, label := range m.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["operation"] == operation && labels["code"] == code {
+			return m.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestObserveRorApiRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode string
+	}{
+		{name: "success", err: nil, wantCode: "2xx"},
+		{name: "status code of error", err: statuscode.New(503, "request failed"), wantCode: "503"},
+		{name: "no response", err: errors.New("connection refused"), wantCode: "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operation := "test_" + tt.name
+			ObserveRorApiRequest(operation, time.Now(), tt.err)
+			if got := requestCount(t, operation, tt.wantCode); got != 1 {
+				t.Errorf("observed %d requests with code %s, want 1", got, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package metricsservice
+
+import (
+	"net/http"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes the name of every metric exported by the agent.
+const Namespace = "ror_agent"
+
+// MayStartMetricsServer serves the prometheus metrics on /metrics at ROR_METRICS_ENDPOINT, unless it is empty.
+func MayStartMetricsServer() {
+	endpoint := rorconfig.GetString(agentconsts.MetricsEndpointEnv)
+	if endpoint == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	go func() {
+		rlog.Info("Starting metrics server", rlog.String("endpoint", endpoint))
+		err := http.ListenAndServe(endpoint, mux) // #nosec G114 - internal metrics endpoint
+		if err != nil {
+			rlog.Error("could not start metrics server", err)
+		}
+	}()
+}
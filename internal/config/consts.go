@@ -0,0 +1,34 @@
+package config
+
+// Environment variables used to configure the v1 agent.
+const (
+	// WorkqueuePersistenceEnv selects the backend used to persist the retry workqueue, and the keys of the shard when sharded,
+	// one of "none", "file" or "secret".
+	WorkqueuePersistenceEnv = "ROR_WORKQUEUE_PERSISTENCE"
+	// WorkqueuePersistencePathEnv is the file used by the "file" backend, typically on an emptyDir or PVC.
+	WorkqueuePersistencePathEnv = "ROR_WORKQUEUE_PERSISTENCE_PATH"
+	// WorkqueuePersistenceSecretEnv is the name of the secret in POD_NAMESPACE used by the "secret" backend.
+	WorkqueuePersistenceSecretEnv = "ROR_WORKQUEUE_PERSISTENCE_SECRET"
+	// WorkqueueMaxRetriesEnv is the number of retries before an update rejected by ror-api is dead-lettered, 0 retries forever.
+	WorkqueueMaxRetriesEnv = "ROR_WORKQUEUE_MAX_RETRIES"
+	// WorkqueueBackoffBaseSecondsEnv is the delay before the first retry, doubled for every following retry.
+	WorkqueueBackoffBaseSecondsEnv = "ROR_WORKQUEUE_BACKOFF_BASE_SECONDS"
+	// WorkqueueBackoffMaxSecondsEnv caps the delay between retries.
+	WorkqueueBackoffMaxSecondsEnv = "ROR_WORKQUEUE_BACKOFF_MAX_SECONDS"
+	// WorkqueueHealthMaxItemsEnv is the number of queued updates above which the agent reports not ready, 0 disables the check.
+	WorkqueueHealthMaxItemsEnv = "ROR_WORKQUEUE_HEALTH_MAX_ITEMS"
+	// WorkqueueHealthMaxStuckSecondsEnv is how long the workqueue may hold updates without sending any of them
+	// before the agent reports not ready.
+	WorkqueueHealthMaxStuckSecondsEnv = "ROR_WORKQUEUE_HEALTH_MAX_STUCK_SECONDS"
+	// ResourceCleanupDelaySecondsEnv is the minimum time before resources missing from the cluster are removed from ror,
+	// the cleanup also waits for every dynamic watcher to complete its initial list.
+	ResourceCleanupDelaySecondsEnv = "ROR_RESOURCE_CLEANUP_DELAY_SECONDS"
+	// ResourceReconcileIntervalMinutesEnv is the interval between full reconciliations against ror-api, 0 disables it.
+	ResourceReconcileIntervalMinutesEnv = "ROR_RESOURCE_RECONCILE_INTERVAL_MINUTES"
+	// ResourceHashAlgorithmEnv is the algorithm used to hash resources, one of "md5", "sha256" or "xxhash".
+	ResourceHashAlgorithmEnv = "ROR_RESOURCE_HASH_ALGORITHM"
+	// ResourceHashIgnoreFieldsEnv lists fields ignored when hashing resources, so changes to them are not sent to ror-api.
+	// The format is "<apiVersion>/<kind>=<path>,<path>;*=<path>" where * applies to every resource type,
+	// for example "*=metadata.managedFields;v1/Node=status.conditions[*].lastHeartbeatTime".
+	ResourceHashIgnoreFieldsEnv = "ROR_RESOURCE_HASH_IGNORE_FIELDS"
+)
@@ -21,8 +21,57 @@ func Init() {
 	rorconfig.SetDefault(configconsts.API_KEY_SECRET, "ror-apikey")
 	rorconfig.SetDefault(configconsts.ENABLE_PPROF, false)
 	rorconfig.SetDefault(agentconsts.DynamicWatchNoCacheEnv, true)
+	rorconfig.SetDefault(agentconsts.DynamicWatchListEnv, true)
+	rorconfig.SetDefault(agentconsts.DynamicWatchListTimeoutSecondsEnv, 60)
+	rorconfig.SetDefault(agentconsts.DynamicWatchWorkersEnv, 4)
+	rorconfig.SetDefault(agentconsts.DynamicWatchQPSEnv, 50)
+	rorconfig.SetDefault(agentconsts.DynamicWatchBurstEnv, 200)
 	rorconfig.SetDefault(agentconsts.ForceGCAfterInitialListEnv, true)
+	rorconfig.SetDefault(agentconsts.AgentHealthEndpointEnv, ":8101")
+	rorconfig.SetDefault(agentconsts.MetricsEndpointEnv, ":8102")
+	rorconfig.SetDefault(agentconsts.DryRunEnv, false)
+	rorconfig.SetDefault(agentconsts.DryRunOutputEnv, "stdout")
+	rorconfig.SetDefault(agentconsts.RedactDropFieldsEnv, "")
+	rorconfig.SetDefault(agentconsts.RedactMaskFieldsEnv, "")
+	rorconfig.SetDefault(agentconsts.RedactAnnotationsEnv, "")
+	rorconfig.SetDefault(agentconsts.WatchConfigFileEnv, "")
+	rorconfig.SetDefault(agentconsts.WatchConfigMapEnv, "")
+	rorconfig.SetDefault(agentconsts.DiscoveryPollIntervalSecondsEnv, 60)
+	rorconfig.SetDefault(agentconsts.ShutdownTimeoutSecondsEnv, 25)
+	rorconfig.SetDefault(agentconsts.RorApiTimeoutSecondsEnv, 30)
+	rorconfig.SetDefault(agentconsts.KubernetesTimeoutSecondsEnv, 30)
+	rorconfig.SetDefault(agentconsts.HealthWatchMaxIdleSecondsEnv, 900)
+	rorconfig.SetDefault(agentconsts.HealthMaxReportAgeSecondsEnv, 600)
+	rorconfig.SetDefault(agentconsts.LeaderElectionEnv, false)
+	rorconfig.SetDefault(agentconsts.LeaderElectionLeaseNameEnv, "ror-agent")
+	rorconfig.SetDefault(agentconsts.LeaderElectionLeaseDurationSecondsEnv, 15)
+	rorconfig.SetDefault(agentconsts.LeaderElectionRenewDeadlineSecondsEnv, 10)
+	rorconfig.SetDefault(agentconsts.LeaderElectionRetryPeriodSecondsEnv, 2)
+	rorconfig.SetDefault(agentconsts.ShardCountEnv, 1)
+	rorconfig.SetDefault(agentconsts.ShardModeEnv, "resources")
+	rorconfig.SetDefault(agentconsts.ShardIndexEnv, -1)
+	rorconfig.SetDefault(agentconsts.EventFeedEnv, false)
+	rorconfig.SetDefault(agentconsts.EventFeedTypesEnv, "Warning")
+	rorconfig.SetDefault(agentconsts.EventFeedReasonsEnv, "")
+	rorconfig.SetDefault(agentconsts.EventFeedNamespacesEnv, "")
+	rorconfig.SetDefault(agentconsts.EventFeedDedupeSecondsEnv, 300)
+	rorconfig.SetDefault(agentconsts.EventFeedQPSEnv, 5)
+	rorconfig.SetDefault(agentconsts.EventFeedBurstEnv, 50)
+	rorconfig.SetDefault(agentconsts.ApiKeyCheckIntervalSecondsEnv, 60)
+	rorconfig.SetDefault(agentconsts.ApiKeyReregisterAfterEnv, 5)
 	rorconfig.SetDefault(configconsts.ROLE, "ror-agent")
+	rorconfig.SetDefault(WorkqueuePersistenceEnv, "none")
+	rorconfig.SetDefault(WorkqueuePersistencePathEnv, "/var/lib/ror-agent/workqueue.json")
+	rorconfig.SetDefault(WorkqueuePersistenceSecretEnv, "ror-agent-workqueue")
+	rorconfig.SetDefault(WorkqueueMaxRetriesEnv, 10)
+	rorconfig.SetDefault(WorkqueueBackoffBaseSecondsEnv, 10)
+	rorconfig.SetDefault(WorkqueueBackoffMaxSecondsEnv, 600)
+	rorconfig.SetDefault(WorkqueueHealthMaxItemsEnv, 5000)
+	rorconfig.SetDefault(WorkqueueHealthMaxStuckSecondsEnv, 3600)
+	rorconfig.SetDefault(ResourceCleanupDelaySecondsEnv, 60)
+	rorconfig.SetDefault(ResourceReconcileIntervalMinutesEnv, 360)
+	rorconfig.SetDefault(ResourceHashAlgorithmEnv, "md5")
+	rorconfig.SetDefault(ResourceHashIgnoreFieldsEnv, "*=metadata.managedFields;v1/Node=status.conditions[*].lastHeartbeatTime")
 
 	rorconfig.AutomaticEnv()
 }
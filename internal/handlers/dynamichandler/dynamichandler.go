@@ -1,27 +1,34 @@
 package dynamichandler
 
 import (
+	"context"
+
 	"github.com/NorskHelsenett/ror-agent/common/pkg/controllers/dynamiccontroller"
+	"github.com/NorskHelsenett/ror-agent/internal/services/resourceupdate"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type dynamicClientHandler struct {
+	ctx           context.Context
+	resourceCache resourceupdate.ResourceCacheInterface
 }
 
-var Handlers = dynamiccontroller.Resourcehandlers{
-	AddFunc:    addResource,
-	UpdateFunc: updateResource,
-	DeleteFunc: deleteResource,
-}
-
-func NewDynamicClientHandler() *dynamicClientHandler {
-	return &dynamicClientHandler{}
+// NewDynamicClientHandler returns a handler sending resource events to the resource cache, the sends are canceled with ctx.
+func NewDynamicClientHandler(ctx context.Context, resourceCache resourceupdate.ResourceCacheInterface) *dynamicClientHandler {
+	return &dynamicClientHandler{
+		ctx:           ctx,
+		resourceCache: resourceCache,
+	}
 }
 
-func (d dynamicClientHandler) GetHandlersForSchema(schema schema.GroupVersionResource) dynamiccontroller.DynamicHandler {
+func (d *dynamicClientHandler) GetHandlersForSchema(schema schema.GroupVersionResource) dynamiccontroller.DynamicHandler {
 	handler := schemaHandler{
-		schema:   schema,
-		handlers: Handlers,
+		schema: schema,
+		handlers: dynamiccontroller.Resourcehandlers{
+			AddFunc:    d.addResource,
+			UpdateFunc: d.updateResource,
+			DeleteFunc: d.deleteResource,
+		},
 	}
 	return &handler
 }
@@ -1,22 +1,25 @@
 package dynamichandler
 
 import (
-	"github.com/NorskHelsenett/ror-agent/internal/services/resourceupdate"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/controllers/dynamiccontroller"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func addResource(obj any) {
+func (d *dynamicClientHandler) addResource(obj any) {
 	rawData := obj.(*unstructured.Unstructured)
-	resourceupdate.SendResource(apiresourcecontracts.K8sActionAdd, rawData)
+	d.resourceCache.SendResource(d.ctx, apiresourcecontracts.K8sActionAdd, rawData)
 }
 
-func deleteResource(obj any) {
-	rawData := obj.(*unstructured.Unstructured)
-	resourceupdate.SendResource(apiresourcecontracts.K8sActionDelete, rawData)
+func (d *dynamicClientHandler) deleteResource(obj any) {
+	rawData, ok := dynamiccontroller.DeletedObject(obj)
+	if !ok {
+		return
+	}
+	d.resourceCache.SendResource(d.ctx, apiresourcecontracts.K8sActionDelete, rawData)
 }
 
-func updateResource(_ any, obj any) {
+func (d *dynamicClientHandler) updateResource(_ any, obj any) {
 	rawData := obj.(*unstructured.Unstructured)
-	resourceupdate.SendResource(apiresourcecontracts.K8sActionUpdate, rawData)
+	d.resourceCache.SendResource(d.ctx, apiresourcecontracts.K8sActionUpdate, rawData)
 }
@@ -6,6 +6,7 @@ import (
 	"math"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
 	"github.com/NorskHelsenett/ror-agent/internal/kubernetes/k8smodels"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts"
@@ -15,7 +16,7 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func GetNodes(rorClientInterface clusteragentclient.RorAgentClientInterface) ([]k8smodels.Node, error) {
+func GetNodes(ctx context.Context, rorClientInterface clusteragentclient.RorAgentClientInterface) ([]k8smodels.Node, error) {
 	var nodes []k8smodels.Node
 
 	metricsClient, err := rorClientInterface.GetKubernetesClientset().GetMetricsClient()
@@ -46,7 +47,9 @@ func GetNodes(rorClientInterface clusteragentclient.RorAgentClientInterface) ([]
 		n.KubeletVersion = node.Status.NodeInfo.KubeletVersion
 		n.OperatingSystem = node.Status.NodeInfo.OperatingSystem
 
-		nodeMetrics, err := metricsClient.MetricsV1beta1().NodeMetricses().Get(context.TODO(), node.Name, v1.GetOptions{})
+		metricsCtx, cancel := timeouts.Kubernetes(ctx)
+		nodeMetrics, err := metricsClient.MetricsV1beta1().NodeMetricses().Get(metricsCtx, node.Name, v1.GetOptions{})
+		cancel()
 		if err == nil {
 			cpuUsage := nodeMetrics.Usage.Cpu()
 			cpuAllocated, _ := node.Status.Allocatable.Cpu().AsInt64()
@@ -0,0 +1,114 @@
+package rorResources
+
+import (
+	"crypto/md5" // #nosec G501 - MD5 is used for hash calculation only
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NorskHelsenett/ror-agent/internal/config"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/fieldpath"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	HashAlgorithmMD5    = "md5"
+	HashAlgorithmSHA256 = "sha256"
+	HashAlgorithmXXHash = "xxhash"
+)
+
+// resourceHasher calculates the hash used to decide if a resource has changed since it was sent to ror-api.
+type resourceHasher struct {
+	sum func(data []byte) string
+	// ignore holds the field paths removed before hashing
+	ignore fieldpath.Rules
+}
+
+var hasher = &resourceHasher{sum: md5Sum}
+
+// MustInitResourceHasher configures the hash algorithm and ignored fields from ROR_RESOURCE_HASH_ALGORITHM
+// and ROR_RESOURCE_HASH_IGNORE_FIELDS. Changing either makes the agent resend every resource once.
+func MustInitResourceHasher() {
+	algorithm := rorconfig.GetString(config.ResourceHashAlgorithmEnv)
+	ignoreFields := rorconfig.GetString(config.ResourceHashIgnoreFieldsEnv)
+	h, err := newResourceHasher(algorithm, ignoreFields)
+	if err != nil {
+		rlog.Fatal("could not configure resource hashing", err)
+	}
+	hasher = h
+	rlog.Info("resource hashing configured", rlog.String("algorithm", algorithm), rlog.String("ignoreFields", ignoreFields))
+}
+
+func newResourceHasher(algorithm string, ignoreFields string) (*resourceHasher, error) {
+	h := &resourceHasher{}
+	switch strings.ToLower(strings.TrimSpace(algorithm)) {
+	case HashAlgorithmMD5, "":
+		h.sum = md5Sum
+	case HashAlgorithmSHA256:
+		h.sum = sha256Sum
+	case HashAlgorithmXXHash:
+		h.sum = xxhashSum
+	default:
+		return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+	}
+
+	ignore, err := fieldpath.ParseRules(ignoreFields)
+	if err != nil {
+		return nil, err
+	}
+	h.ignore = ignore
+	return h, nil
+}
+
+// hash calculates the hash of obj without the ignored fields, obj itself is not modified.
+// encoding/json sorts map keys, so the hash does not depend on the order of the fields.
+func (h *resourceHasher) hash(obj map[string]any) (string, error) {
+	hashObj := make(map[string]any, len(obj))
+	for k, v := range obj {
+		hashObj[k] = v
+	}
+
+	md, ok := obj["metadata"].(map[string]any)
+	if !ok || md == nil {
+		md = map[string]any{}
+	}
+	mdCopy := make(map[string]any, len(md))
+	for k, v := range md {
+		mdCopy[k] = v
+	}
+
+	// Match previous behavior: set these fields to null before hashing.
+	mdCopy["resourceVersion"] = nil
+	mdCopy["creationTimestamp"] = nil
+	mdCopy["generation"] = nil
+	hashObj["metadata"] = mdCopy
+
+	for _, path := range h.ignore.For(obj) {
+		hashObj = path.Without(hashObj)
+	}
+
+	input, err := json.Marshal(hashObj)
+	if err != nil {
+		rlog.Error("error marshaling json for hash", err)
+		return "", err
+	}
+	return h.sum(input), nil
+}
+
+func md5Sum(data []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(data)) // #nosec G401 - MD5 is used for hash calculation only
+}
+
+func sha256Sum(data []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+func xxhashSum(data []byte) string {
+	return strconv.FormatUint(xxhash.Sum64(data), 16)
+}
@@ -0,0 +1,109 @@
+package rorResources
+
+import (
+	"testing"
+)
+
+func testNode(heartbeat string, ready string) map[string]any {
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata": map[string]any{
+			"name":            "node-1",
+			"resourceVersion": heartbeat,
+			"managedFields":   []any{map[string]any{"time": heartbeat}},
+		},
+		"status": map[string]any{
+			"conditions": []any{
+				map[string]any{"type": "Ready", "status": ready, "lastHeartbeatTime": heartbeat},
+			},
+		},
+	}
+}
+
+func TestNewResourceHasher(t *testing.T) {
+	tests := []struct {
+		name         string
+		algorithm    string
+		ignoreFields string
+		wantErr      bool
+	}{
+		{name: "Test default", algorithm: "", ignoreFields: ""},
+		{name: "Test sha256", algorithm: "sha256", ignoreFields: "*=metadata.managedFields"},
+		{name: "Test xxhash", algorithm: "XXHash", ignoreFields: "*=metadata.managedFields;v1/Node=status.conditions[*].lastHeartbeatTime,metadata.labels"},
+		{name: "Test unknown algorithm", algorithm: "crc32", wantErr: true},
+		{name: "Test missing paths", algorithm: "md5", ignoreFields: "v1/Node", wantErr: true},
+		{name: "Test invalid kind", algorithm: "md5", ignoreFields: "Node=status", wantErr: true},
+		{name: "Test invalid path", algorithm: "md5", ignoreFields: "v1/Node=status..conditions", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newResourceHasher(tt.algorithm, tt.ignoreFields)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newResourceHasher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResourceHasher_hash(t *testing.T) {
+	tests := []struct {
+		name         string
+		algorithm    string
+		ignoreFields string
+		a            map[string]any
+		b            map[string]any
+		wantEqual    bool
+	}{
+		{
+			name:      "Test heartbeat changes hash without ignored fields",
+			algorithm: "md5",
+			a:         testNode("1", "True"),
+			b:         testNode("2", "True"),
+			wantEqual: false,
+		}, {
+			name:         "Test heartbeat ignored",
+			algorithm:    "sha256",
+			ignoreFields: "*=metadata.managedFields;v1/Node=status.conditions[*].lastHeartbeatTime",
+			a:            testNode("1", "True"),
+			b:            testNode("2", "True"),
+			wantEqual:    true,
+		}, {
+			name:         "Test status change not ignored",
+			algorithm:    "xxhash",
+			ignoreFields: "*=metadata.managedFields;v1/Node=status.conditions[*].lastHeartbeatTime",
+			a:            testNode("1", "True"),
+			b:            testNode("2", "False"),
+			wantEqual:    false,
+		}, {
+			name:         "Test ignored fields only apply to their kind",
+			algorithm:    "md5",
+			ignoreFields: "*=metadata.managedFields;apps/v1/Deployment=status.conditions[*].lastHeartbeatTime",
+			a:            testNode("1", "True"),
+			b:            testNode("2", "True"),
+			wantEqual:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := newResourceHasher(tt.algorithm, tt.ignoreFields)
+			if err != nil {
+				t.Fatalf("newResourceHasher() error = %v", err)
+			}
+			hashA, err := h.hash(tt.a)
+			if err != nil {
+				t.Fatalf("hash() error = %v", err)
+			}
+			hashB, err := h.hash(tt.b)
+			if err != nil {
+				t.Fatalf("hash() error = %v", err)
+			}
+			if (hashA == hashB) != tt.wantEqual {
+				t.Errorf("hash() equal = %v, want %v (%s, %s)", hashA == hashB, tt.wantEqual, hashA, hashB)
+			}
+			if _, ok := tt.a["metadata"].(map[string]any)["managedFields"]; !ok {
+				t.Errorf("hash() modified the input object")
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package rorResources
+
+import (
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/redaction"
+)
+
+// redactor drops and masks fields of resources before they are hashed and sent to ror-api, nil redacts nothing.
+var redactor *redaction.Redactor
+
+// MustInitResourceRedactor configures the fields redacted from resources, see redaction.MustNewRedactorFromConfig.
+func MustInitResourceRedactor() {
+	redactor = redaction.MustNewRedactorFromConfig()
+}
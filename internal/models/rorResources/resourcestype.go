@@ -1,8 +1,6 @@
 package rorResources
 
 import (
-	"crypto/md5" // #nosec G501 - MD5 is used for hash calculation only
-	"encoding/json"
 	"fmt"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
@@ -35,13 +33,14 @@ func NewFromUnstructured(input *unstructured.Unstructured) (rorResource, error)
 	}
 
 	removeUnnecessaryDataFromObject(input.Object)
+	obj := redactor.Redact(input.Object)
 
-	h, err := calculateHashFromObject(input.Object)
+	h, err := calculateHashFromObject(obj)
 	if err != nil {
 		return returnResource, err
 	}
 	returnResource.Hash = h
-	if err := getResourceFromObject(&returnResource, input.Object); err != nil {
+	if err := getResourceFromObject(&returnResource, obj); err != nil {
 		return returnResource, err
 	}
 	return returnResource, nil
@@ -60,34 +59,7 @@ func prepareResourcePayloadFromObject[D any](obj map[string]any) (D, error) {
 }
 
 func calculateHashFromObject(obj map[string]any) (string, error) {
-	hashObj := make(map[string]any, len(obj))
-	for k, v := range obj {
-		hashObj[k] = v
-	}
-
-	md, ok := obj["metadata"].(map[string]any)
-	if !ok || md == nil {
-		md = map[string]any{}
-	}
-	mdCopy := make(map[string]any, len(md))
-	for k, v := range md {
-		mdCopy[k] = v
-	}
-
-	// Match previous behavior: set these fields to null before hashing.
-	mdCopy["resourceVersion"] = nil
-	mdCopy["creationTimestamp"] = nil
-	mdCopy["generation"] = nil
-	hashObj["metadata"] = mdCopy
-
-	input, err := json.Marshal(hashObj)
-	if err != nil {
-		rlog.Error("error marshaling json for hash", err)
-		return "", err
-	}
-
-	resourceHash := fmt.Sprintf("%x", md5.Sum(input)) // #nosec G401 - MD5 is used for hash calculation only
-	return resourceHash, nil
+	return hasher.hash(obj)
 }
 
 func removeUnnecessaryDataFromObject(obj map[string]any) {
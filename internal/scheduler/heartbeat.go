@@ -2,26 +2,39 @@ package scheduler
 
 import (
 	"context"
+	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
 
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 
 	"github.com/NorskHelsenett/ror-agent/internal/services"
 )
 
-func HeartbeatReporting(rorClientInterface clusteragentclient.RorAgentClientInterface) error {
-	clusterReport, err := services.GetHeartbeatReport(rorClientInterface)
+// heartbeatTask names the heartbeat in the health checks and metrics.
+const heartbeatTask = "heartbeat"
+
+func HeartbeatReporting(ctx context.Context, rorClientInterface clusteragentclient.RorAgentClientInterface) error {
+	clusterReport, err := services.GetHeartbeatReport(ctx, rorClientInterface)
 	if err != nil {
 		rlog.Error("error when getting heartbeat report", err)
 		return err
 	}
 
-	err = rorClientInterface.GetRorClient().V1().Clusters().SendHeartbeat(context.TODO(), clusterReport)
+	sendCtx, cancel := timeouts.RorApi(ctx)
+	defer cancel()
+	start := time.Now()
+	err = rorClientInterface.GetRorClient().V1().Clusters().SendHeartbeat(sendCtx, clusterReport)
+	metricsservice.ObserveRorApiRequest("clusters_heartbeat", start, err)
 	if err != nil {
 		rlog.Error("error when sending heartbeat report to ror", err)
 		return err
 	}
+	metricsservice.SetLastSuccess(heartbeatTask)
+	healthservice.RecordSuccess(heartbeatTask)
 	rlog.Info("heartbeat report sent to ror")
 	return nil
 }
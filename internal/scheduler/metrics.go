@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
 	"github.com/NorskHelsenett/ror-agent/internal/services/authservice"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts"
@@ -18,14 +19,14 @@ import (
 )
 
 // TODO: Change to use RorClient
-func MetricsReporting(rorClientInterface clusteragentclient.RorAgentClientInterface) error {
+func MetricsReporting(ctx context.Context, rorClientInterface clusteragentclient.RorAgentClientInterface) error {
 	k8sClient, err := rorClientInterface.GetKubernetesClientset().GetKubernetesClientset()
 	if err != nil {
 		return err
 	}
 	var metricsReport apicontracts.MetricsReport
 
-	metricsReportNodes, err := CreateNodeMetricsList(k8sClient)
+	metricsReportNodes, err := CreateNodeMetricsList(ctx, k8sClient)
 	if err != nil {
 		rlog.Error("error converting podmetrics", err)
 		return err
@@ -38,7 +39,9 @@ func MetricsReporting(rorClientInterface clusteragentclient.RorAgentClientInterf
 	}
 	metricsReport.Nodes = metricsReportNodes
 
-	err = rorClientInterface.GetRorClient().V1().Metrics().PostReport(context.TODO(), metricsReport)
+	postCtx, cancel := timeouts.RorApi(ctx)
+	defer cancel()
+	err = rorClientInterface.GetRorClient().V1().Metrics().PostReport(postCtx, metricsReport)
 	if err != nil {
 		rlog.Error("error when sending metrics report to ror", err)
 		return err
@@ -47,11 +50,13 @@ func MetricsReporting(rorClientInterface clusteragentclient.RorAgentClientInterf
 	return nil
 }
 
-func CreateNodeMetricsList(k8sClient *kubernetes.Clientset) ([]apicontracts.NodeMetric, error) {
+func CreateNodeMetricsList(ctx context.Context, k8sClient *kubernetes.Clientset) ([]apicontracts.NodeMetric, error) {
 	var nodeMetricsList apicontracts.NodeMetricsList
 	var metricsReportNodes []apicontracts.NodeMetric
 
-	data, err := k8sClient.RESTClient().Get().AbsPath("apis/metrics.k8s.io/v1beta1/nodes").DoRaw(context.TODO())
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
+	data, err := k8sClient.RESTClient().Get().AbsPath("apis/metrics.k8s.io/v1beta1/nodes").DoRaw(ctx)
 	if err != nil {
 		rlog.Error("error converting nodemetrics", err)
 		return metricsReportNodes, err
@@ -1,21 +1,28 @@
 package scheduler
 
 import (
+	"context"
 	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 
 	"github.com/go-co-op/gocron"
 )
 
-func MustStart(rorClientInterface clusteragentclient.RorAgentClientInterface) {
+// MustStart starts the scheduled jobs of the agent, the jobs are canceled with ctx.
+func MustStart(ctx context.Context, rorClientInterface clusteragentclient.RorAgentClientInterface) *gocron.Scheduler {
 	scheduler := gocron.NewScheduler(time.UTC)
-	_, err := scheduler.Every(1).Minute().Tag("heartbeat").Do(HeartbeatReporting, rorClientInterface)
+	healthservice.RegisterLastSuccessCheck(heartbeatTask, time.Duration(rorconfig.GetInt(agentconsts.HealthMaxReportAgeSecondsEnv))*time.Second)
+	_, err := scheduler.Every(1).Minute().Tag("heartbeat").Do(HeartbeatReporting, ctx, rorClientInterface)
 	if err != nil {
 		rlog.Fatal("Failed to setup heartbeat schedule", err)
 	}
 
 	// Metrics reporting is handled by agent v2
 	scheduler.StartAsync()
+	return scheduler
 }
@@ -13,6 +13,7 @@ import (
 	vitiv1alpha1 "github.com/vitistack/common/pkg/v1alpha1"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
 	"github.com/NorskHelsenett/ror-agent/internal/kubernetes/k8smodels"
 	"github.com/NorskHelsenett/ror-agent/internal/kubernetes/nodeservice"
 	"github.com/NorskHelsenett/ror-agent/internal/utils"
@@ -103,7 +104,8 @@ func NewAccessGroupsFromData(data map[string]string) accessGroups {
 	return accessGroups
 }
 
-func GetHeartbeatReport(rorClientInterface clusteragentclient.RorAgentClientInterface) (apicontracts.Cluster, error) {
+// GetHeartbeatReport collects the heartbeat report of the cluster, every call to the kubernetes API is canceled with ctx.
+func GetHeartbeatReport(ctx context.Context, rorClientInterface clusteragentclient.RorAgentClientInterface) (apicontracts.Cluster, error) {
 
 	k8sClient, err := rorClientInterface.GetKubernetesClientset().GetKubernetesClientset()
 	if err != nil {
@@ -115,14 +117,14 @@ func GetHeartbeatReport(rorClientInterface clusteragentclient.RorAgentClientInte
 	datacenterName := "local"
 	provider := providermodels.ProviderTypeUnknown
 
-	nhnToolingMetadata, err := getNhnToolingMetadata(rorClientInterface)
+	nhnToolingMetadata, err := getNhnToolingMetadata(ctx, rorClientInterface)
 	if err != nil {
 		rlog.Warn("NHN-Tooling is not installed?!")
 	}
 
 	kubernetesVersion := getKubernetesServerVersion(rorClientInterface)
 
-	nodes, err := nodeservice.GetNodes(rorClientInterface)
+	nodes, err := nodeservice.GetNodes(ctx, rorClientInterface)
 	if err != nil {
 		rlog.Error("error getting nodes", err)
 	}
@@ -139,7 +141,7 @@ func GetHeartbeatReport(rorClientInterface clusteragentclient.RorAgentClientInte
 		}
 	}
 
-	k8sControlPlaneEndpoint, err = getControlPlaneEndpoint(k8sClient)
+	k8sControlPlaneEndpoint, err = getControlPlaneEndpoint(ctx, k8sClient)
 	if err != nil {
 		rlog.Error("could not get control plane endpoint", err)
 	}
@@ -151,7 +153,7 @@ func GetHeartbeatReport(rorClientInterface clusteragentclient.RorAgentClientInte
 	datacenterName = interregationreport.Datacenter
 	provider = interregationreport.KubernetesProvider
 
-	ingresses, err := getIngresses(k8sClient)
+	ingresses, err := getIngresses(ctx, k8sClient)
 	if err != nil {
 		rlog.Error("could not get ingresses", err)
 	}
@@ -175,7 +177,9 @@ func GetHeartbeatReport(rorClientInterface clusteragentclient.RorAgentClientInte
 
 	var created time.Time
 	kubeSystem := "kube-system"
-	kubeSystemNamespace, err := k8sClient.CoreV1().Namespaces().Get(context.Background(), kubeSystem, v1.GetOptions{})
+	namespaceCtx, cancel := timeouts.Kubernetes(ctx)
+	kubeSystemNamespace, err := k8sClient.CoreV1().Namespaces().Get(namespaceCtx, kubeSystem, v1.GetOptions{})
+	cancel()
 	if err != nil {
 		rlog.Error("could not fetch namespace", err, rlog.String("namespace", kubeSystem))
 	} else {
@@ -304,23 +308,32 @@ func getKubernetesServerVersion(rorClientInterface clusteragentclient.RorAgentCl
 	return kubernetesVersion
 }
 
-func getIngresses(k8sClient *kubernetes.Clientset) ([]apicontracts.Ingress, error) {
+func getIngresses(ctx context.Context, k8sClient *kubernetes.Clientset) ([]apicontracts.Ingress, error) {
 	var ingressList []apicontracts.Ingress
-	nsList, err := k8sClient.CoreV1().Namespaces().List(context.Background(), v1.ListOptions{})
+	listCtx, cancel := timeouts.Kubernetes(ctx)
+	nsList, err := k8sClient.CoreV1().Namespaces().List(listCtx, v1.ListOptions{})
+	cancel()
 	if err != nil {
 		rlog.Error("could not fetch namespaces", err)
 		return ingressList, errors.New("could not fetch namespaces from cluster")
 	}
 
 	for _, namespace := range nsList.Items {
+		if ctx.Err() != nil {
+			return ingressList, ctx.Err()
+		}
 		ing := k8sClient.NetworkingV1().Ingresses(namespace.Name)
-		ingresses, err := ing.List(context.Background(), v1.ListOptions{})
+		listCtx, cancel := timeouts.Kubernetes(ctx)
+		ingresses, err := ing.List(listCtx, v1.ListOptions{})
+		cancel()
 		if err != nil {
 			rlog.Error("could not list ingress in namespace", err, rlog.String("namespace", namespace.Name))
 			continue
 		}
 		for _, ingress := range ingresses.Items {
-			richIngress, err := utils.GetIngressDetails(context.Background(), k8sClient, &ingress)
+			detailsCtx, cancel := timeouts.Kubernetes(ctx)
+			richIngress, err := utils.GetIngressDetails(detailsCtx, k8sClient, &ingress)
+			cancel()
 			if err != nil {
 				rlog.Error("could not enrich ingress", err,
 					rlog.String("ingress", ingress.Name),
@@ -435,9 +448,11 @@ func appendNodeToNodePools(nodePools *[]apicontracts.NodePool, node *k8smodels.N
 	}
 }
 
-func getControlPlaneEndpoint(clientset *kubernetes.Clientset) (string, error) {
+func getControlPlaneEndpoint(ctx context.Context, clientset *kubernetes.Clientset) (string, error) {
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
 
-	nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), v1.ListOptions{})
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, v1.ListOptions{})
 
 	if err != nil {
 		errMsg := "getControlPlaneEndpoint: Could not get nodes from k8s"
@@ -452,7 +467,7 @@ func getControlPlaneEndpoint(clientset *kubernetes.Clientset) (string, error) {
 		}
 	}
 
-	kubeadmConfigMap, err := clientset.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), "kubeadm-config", v1.GetOptions{})
+	kubeadmConfigMap, err := clientset.CoreV1().ConfigMaps("kube-system").Get(ctx, "kubeadm-config", v1.GetOptions{})
 	if err != nil {
 		errMsg := "getControlPlaneEndpoint: Could not get cluster config from kube-system/kubeadm-config, check rbac"
 		return "", errors.New(errMsg)
@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
 	"github.com/NorskHelsenett/ror-agent/internal/kubernetes/k8smodels"
 	"github.com/NorskHelsenett/ror-agent/internal/models/argomodels"
 	"github.com/NorskHelsenett/ror/pkg/config/configconsts"
@@ -17,7 +18,7 @@ import (
 	"k8s.io/client-go/dynamic"
 )
 
-func getNhnToolingMetadata(rorClientInterface clusteragentclient.RorAgentClientInterface) (k8smodels.NhnTooling, error) {
+func getNhnToolingMetadata(ctx context.Context, rorClientInterface clusteragentclient.RorAgentClientInterface) (k8smodels.NhnTooling, error) {
 	result := k8smodels.NhnTooling{
 		Version:      MissingConst,
 		Branch:       MissingConst,
@@ -36,10 +37,12 @@ func getNhnToolingMetadata(rorClientInterface clusteragentclient.RorAgentClientI
 	}
 
 	namespace := rorconfig.GetString(configconsts.POD_NAMESPACE)
-	nhnToolingConfigMap, err := k8sClient.CoreV1().ConfigMaps(namespace).Get(context.TODO(), "nhn-tooling", v1.GetOptions{
+	configMapCtx, cancel := timeouts.Kubernetes(ctx)
+	nhnToolingConfigMap, err := k8sClient.CoreV1().ConfigMaps(namespace).Get(configMapCtx, "nhn-tooling", v1.GetOptions{
 		TypeMeta:        v1.TypeMeta{},
 		ResourceVersion: "",
 	})
+	cancel()
 
 	if err != nil {
 		return result, fmt.Errorf("could not find config map %s for ror in namespace %s", "nhn-tooling", namespace)
@@ -63,7 +66,7 @@ func getNhnToolingMetadata(rorClientInterface clusteragentclient.RorAgentClientI
 	}
 
 	branch := MissingConst
-	nhnToolingApp, err := getNhnToolingInfo(dynamicClient)
+	nhnToolingApp, err := getNhnToolingInfo(ctx, dynamicClient)
 	if err != nil {
 		rlog.Error("could not get nhn-tooling application", err)
 	} else {
@@ -81,15 +84,17 @@ func getNhnToolingMetadata(rorClientInterface clusteragentclient.RorAgentClientI
 	return result, nil
 }
 
-func getNhnToolingInfo(dynamicClient dynamic.Interface) (argomodels.Application, error) {
+func getNhnToolingInfo(ctx context.Context, dynamicClient dynamic.Interface) (argomodels.Application, error) {
 	result := argomodels.Application{}
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
 	applications, err := dynamicClient.Resource(schema.GroupVersionResource{
 		Group:    "argoproj.io",
 		Version:  "v1alpha1",
 		Resource: "applications",
 	}).
 		Namespace("argocd").
-		Get(context.TODO(), "nhn-tooling", v1.GetOptions{})
+		Get(ctx, "nhn-tooling", v1.GetOptions{})
 	if err != nil {
 		rlog.Error("could not get nhn-tooling application", err)
 		return result, err
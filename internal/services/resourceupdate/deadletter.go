@@ -0,0 +1,39 @@
+package resourceupdate
+
+import (
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+)
+
+// deadLetterMaxItems bounds the dead-letter list, the oldest items are dropped first.
+const deadLetterMaxItems = 1000
+
+type ResourceCacheDeadLetter struct {
+	ResourceCacheWorkqueueObject
+	StatusCode     int
+	Error          string
+	DeadLetteredAt time.Time
+}
+
+type ResourceCacheDeadLetters []ResourceCacheDeadLetter
+
+func (d ResourceCacheDeadLetters) ItemCount() int {
+	return len(d)
+}
+
+func (d *ResourceCacheDeadLetters) Add(item ResourceCacheWorkqueueObject, err error) {
+	deadLetter := ResourceCacheDeadLetter{
+		ResourceCacheWorkqueueObject: item,
+		StatusCode:                   statuscode.FromError(err),
+		DeadLetteredAt:               time.Now(),
+	}
+	if err != nil {
+		deadLetter.Error = err.Error()
+	}
+
+	*d = append(*d, deadLetter)
+	if len(*d) > deadLetterMaxItems {
+		*d = (*d)[len(*d)-deadLetterMaxItems:]
+	}
+}
@@ -0,0 +1,77 @@
+package resourceupdate
+
+import (
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsSubsystem = "resource"
+
+const (
+	resultSent      = "sent"
+	resultUnchanged = "unchanged"
+	resultFailed    = "failed"
+)
+
+var resourceUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsservice.Namespace,
+	Subsystem: metricsSubsystem,
+	Name:      "updates_total",
+	Help:      "Resource updates by action and result, sent to ror-api, skipped as unchanged by hash or failed.",
+}, []string{"action", "result"})
+
+func observeResourceUpdate(action apiresourcecontracts.ResourceAction, err error) {
+	result := resultSent
+	if err != nil {
+		result = resultFailed
+	}
+	resourceUpdates.WithLabelValues(string(action), result).Inc()
+}
+
+var (
+	workqueueDepthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsservice.Namespace, metricsSubsystem, "workqueue_depth"),
+		"Resource updates waiting in the workqueue to be retried.",
+		nil, nil)
+
+	workqueueOldestDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsservice.Namespace, metricsSubsystem, "workqueue_oldest_item_age_seconds"),
+		"Time since the oldest resource update in the workqueue was queued or last retried.",
+		nil, nil)
+)
+
+// workqueueCollector reports the depth of the workqueue and the age of its oldest item, read once per scrape.
+type workqueueCollector struct {
+	rc *ResourceCache
+}
+
+func (c workqueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- workqueueDepthDesc
+	ch <- workqueueOldestDesc
+}
+
+func (c workqueueCollector) Collect(ch chan<- prometheus.Metric) {
+	depth, age := c.rc.workqueueStats(time.Now())
+	ch <- prometheus.MustNewConstMetric(workqueueDepthDesc, prometheus.GaugeValue, float64(depth))
+	ch <- prometheus.MustNewConstMetric(workqueueOldestDesc, prometheus.GaugeValue, age.Seconds())
+}
+
+func (rc *ResourceCache) registerWorkqueueMetrics() {
+	prometheus.MustRegister(workqueueCollector{rc: rc})
+}
+
+func (rc *ResourceCache) workqueueStats(now time.Time) (int, time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	depth := rc.Workqueue.ItemCount()
+	if depth == 0 {
+		return 0, 0
+	}
+	return depth, now.Sub(rc.Workqueue.OldestSubmitted())
+}
@@ -0,0 +1,59 @@
+package resourceupdate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_resourcecache_resourceUpdateMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		failing    bool
+		sentBefore bool
+		wantResult string
+	}{
+		{name: "Test metrics count sent updates", wantResult: resultSent},
+		{name: "Test metrics count unchanged updates", sentBefore: true, wantResult: resultUnchanged},
+		{name: "Test metrics count failed updates", failing: true, wantResult: resultFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := newFakeSender()
+			sender.failing.Store(tt.failing)
+			rc := NewResourceCache(sender, nil, RetryPolicy{})
+			update := &apiresourcecontracts.ResourceUpdateModel{Uid: "3c99c410-3cdd-11ee-be56-0242ac120002", Hash: "1", Action: apiresourcecontracts.K8sActionUpdate}
+			if tt.sentBefore {
+				rc.HashList.UpdateHash(update.Uid, update.Hash)
+			}
+			counter := resourceUpdates.WithLabelValues(string(update.Action), tt.wantResult)
+			before := testutil.ToFloat64(counter)
+
+			rc.sendResourceUpdate(context.Background(), update)
+
+			assert.Equal(t, 1.0, testutil.ToFloat64(counter)-before)
+		})
+	}
+}
+
+func Test_resourcecache_workqueueStats(t *testing.T) {
+	rc := NewResourceCache(newFakeSender(), nil, RetryPolicy{})
+	now := time.Now()
+	depth, oldest := rc.workqueueStats(now)
+	assert.Equal(t, 0, depth)
+	assert.Equal(t, time.Duration(0), oldest)
+
+	rc.Workqueue.AddObject(ResourceCacheWorkqueueObject{SubmittedTime: now.Add(-time.Minute), ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{Uid: "3c99c410-3cdd-11ee-be56-0242ac120002"}})
+	rc.Workqueue.AddObject(ResourceCacheWorkqueueObject{SubmittedTime: now.Add(-time.Hour), ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{Uid: "3c99c410-3cdd-11ee-be56-0242ac120022"}})
+
+	depth, oldest = rc.workqueueStats(now)
+
+	assert.Equal(t, 2, depth)
+	assert.Equal(t, time.Hour, oldest)
+	assert.Equal(t, 2, testutil.CollectAndCount(workqueueCollector{rc: rc}))
+}
@@ -0,0 +1,316 @@
+package resourceupdate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+	"github.com/NorskHelsenett/ror-agent/internal/config"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	kubernetesclient "github.com/NorskHelsenett/ror/pkg/clients/kubernetes"
+	"github.com/NorskHelsenett/ror/pkg/config/configconsts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	WorkqueuePersistenceNone   = "none"
+	WorkqueuePersistenceFile   = "file"
+	WorkqueuePersistenceSecret = "secret"
+
+	workqueueSecretKey = "workqueue.json"
+	shardKeysSecretKey = "keys.json"
+	// secrets are limited to 1MiB, the persisted workqueue is trimmed to stay well below the limit
+	workqueueSecretMaxBytes = 900 * 1024
+	// workqueuePersistInterval is the minimum time between two saves of the workqueue
+	workqueuePersistInterval = time.Second
+)
+
+// WorkqueuePersistence stores a snapshot of the workqueue so queued updates survive a restart of the agent.
+// The resource cache saves the workqueue whenever it changes, at most once per workqueuePersistInterval.
+type WorkqueuePersistence interface {
+	Load() ([]ResourceCacheWorkqueueObject, error)
+	Save(workqueue []ResourceCacheWorkqueueObject) error
+}
+
+// NewWorkqueuePersistenceFromConfig returns the persistence backend selected by ROR_WORKQUEUE_PERSISTENCE.
+// When sharded every shard persists its workqueue in its own secret.
+func NewWorkqueuePersistenceFromConfig(client clusteragentclient.RorAgentClientInterface, shard sharding.Shard) WorkqueuePersistence {
+	backend := rorconfig.GetString(config.WorkqueuePersistenceEnv)
+	switch backend {
+	case WorkqueuePersistenceFile:
+		return NewFileWorkqueuePersistence(rorconfig.GetString(config.WorkqueuePersistencePathEnv))
+	case WorkqueuePersistenceSecret:
+		secretName := rorconfig.GetString(config.WorkqueuePersistenceSecretEnv)
+		if shard.Enabled() {
+			secretName = fmt.Sprintf("%s-shard-%d", secretName, shard.Index)
+		}
+		return NewSecretWorkqueuePersistence(client.GetKubernetesClientset(), rorconfig.GetString(configconsts.POD_NAMESPACE), secretName)
+	case WorkqueuePersistenceNone, "":
+		return noopWorkqueuePersistence{}
+	default:
+		rlog.Warn("unknown workqueue persistence backend, workqueue will not be persisted", rlog.String("backend", backend))
+		return noopWorkqueuePersistence{}
+	}
+}
+
+type noopWorkqueuePersistence struct{}
+
+func (noopWorkqueuePersistence) Load() ([]ResourceCacheWorkqueueObject, error) {
+	return nil, nil
+}
+
+func (noopWorkqueuePersistence) Save([]ResourceCacheWorkqueueObject) error {
+	return nil
+}
+
+type fileWorkqueuePersistence struct {
+	path string
+}
+
+// NewFileWorkqueuePersistence persists the workqueue as json in the file at path.
+func NewFileWorkqueuePersistence(path string) WorkqueuePersistence {
+	return &fileWorkqueuePersistence{path: path}
+}
+
+func (p *fileWorkqueuePersistence) Load() ([]ResourceCacheWorkqueueObject, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read workqueue file %s: %w", p.path, err)
+	}
+	return unmarshalWorkqueue(data)
+}
+
+// Save writes the workqueue to a temporary file and renames it, so a crash never leaves a partially written file.
+func (p *fileWorkqueuePersistence) Save(workqueue []ResourceCacheWorkqueueObject) error {
+	data, err := json.Marshal(workqueue)
+	if err != nil {
+		return fmt.Errorf("could not marshal workqueue: %w", err)
+	}
+	return writeFileAtomic(p.path, data)
+}
+
+// LoadShardKeys reads the keys of the shard from the file next to the workqueue file.
+func (p *fileWorkqueuePersistence) LoadShardKeys() (persistedShardKeys, error) {
+	var keys persistedShardKeys
+	data, err := os.ReadFile(p.path + ".keys")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keys, nil
+		}
+		return keys, fmt.Errorf("could not read shard keys file %s.keys: %w", p.path, err)
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return keys, fmt.Errorf("could not unmarshal persisted shard keys: %w", err)
+	}
+	return keys, nil
+}
+
+// SaveShardKeys writes the keys of the shard to the file next to the workqueue file.
+func (p *fileWorkqueuePersistence) SaveShardKeys(keys persistedShardKeys) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("could not marshal shard keys: %w", err)
+	}
+	return writeFileAtomic(p.path+".keys", data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("could not create directory for %s: %w", path, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("could not write %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+type secretWorkqueuePersistence struct {
+	clientset *kubernetesclient.K8sClientsets
+	namespace string
+	name      string
+}
+
+// NewSecretWorkqueuePersistence persists the workqueue in a secret in the given namespace.
+func NewSecretWorkqueuePersistence(clientset *kubernetesclient.K8sClientsets, namespace string, name string) WorkqueuePersistence {
+	return &secretWorkqueuePersistence{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (p *secretWorkqueuePersistence) Load() ([]ResourceCacheWorkqueueObject, error) {
+	secret, err := p.clientset.GetSecret(p.namespace, p.name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get workqueue secret %s/%s: %w", p.namespace, p.name, err)
+	}
+	data, ok := secret.Data[workqueueSecretKey]
+	if !ok || len(data) == 0 {
+		return nil, nil
+	}
+	return unmarshalWorkqueue(data)
+}
+
+// Save trims the workqueue to workqueueSecretMaxBytes, see marshalWorkqueueWithin, so the secret is never rejected for its size.
+func (p *secretWorkqueuePersistence) Save(workqueue []ResourceCacheWorkqueueObject) error {
+	data, dropped, err := marshalWorkqueueWithin(workqueue, workqueueSecretMaxBytes)
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		rlog.Warn("persisted workqueue exceeds the secret size limit, newest updates not persisted, consider using the file backend", rlog.Int("bytes", len(data)), rlog.Int("items", len(workqueue)), rlog.Int("dropped", dropped))
+	}
+
+	return p.saveSecretData(p.name, workqueueSecretKey, data)
+}
+
+// LoadShardKeys reads the keys of the shard from their own secret, named after the workqueue secret.
+func (p *secretWorkqueuePersistence) LoadShardKeys() (persistedShardKeys, error) {
+	var keys persistedShardKeys
+	secret, err := p.clientset.GetSecret(p.namespace, p.shardKeysName())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return keys, nil
+		}
+		return keys, fmt.Errorf("could not get shard keys secret %s/%s: %w", p.namespace, p.shardKeysName(), err)
+	}
+	data, ok := secret.Data[shardKeysSecretKey]
+	if !ok || len(data) == 0 {
+		return keys, nil
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return keys, fmt.Errorf("could not unmarshal persisted shard keys: %w", err)
+	}
+	return keys, nil
+}
+
+// SaveShardKeys writes the keys of the shard to their own secret, so they do not count against the size of the workqueue.
+// Keys beyond workqueueSecretMaxBytes are left out, their resources are not removed if deleted while the agent is down.
+func (p *secretWorkqueuePersistence) SaveShardKeys(keys persistedShardKeys) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("could not marshal shard keys: %w", err)
+	}
+	if len(data) > workqueueSecretMaxBytes {
+		total := len(keys.Uids)
+		// every uid takes the same space, keep the share of them fitting within the limit
+		keys.Uids = keys.Uids[:total*workqueueSecretMaxBytes/len(data)]
+		if data, err = json.Marshal(keys); err != nil {
+			return fmt.Errorf("could not marshal shard keys: %w", err)
+		}
+		rlog.Warn("persisted shard keys exceed the secret size limit, consider using the file backend", rlog.Int("keys", total), rlog.Int("dropped", total-len(keys.Uids)))
+	}
+	return p.saveSecretData(p.shardKeysName(), shardKeysSecretKey, data)
+}
+
+func (p *secretWorkqueuePersistence) shardKeysName() string {
+	return p.name + "-keys"
+}
+
+// saveSecretData sets key to data in the secret name, creating the secret if it does not exist.
+func (p *secretWorkqueuePersistence) saveSecretData(name string, key string, data []byte) error {
+	secret, err := p.clientset.GetSecret(p.namespace, name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("could not get secret %s/%s: %w", p.namespace, name, err)
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: p.namespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				key: data,
+			},
+		}
+		_, err = p.clientset.CreateSecret(p.namespace, secret)
+		return err
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[key] = data
+	_, err = p.clientset.SetSecret(p.namespace, secret)
+	return err
+}
+
+// marshalWorkqueueWithin marshals the workqueue as a json array of at most maxBytes, returning the number of items dropped to fit.
+// Creates and updates are dropped first, newest first, as the watchers send them again after a restart
+// when the resource differs from ror. Deletes are only known through the workqueue and are dropped last.
+func marshalWorkqueueWithin(workqueue []ResourceCacheWorkqueueObject, maxBytes int) ([]byte, int, error) {
+	encoded := make([][]byte, len(workqueue))
+	// the brackets of the array, and a comma before every item but the first
+	size := 2
+	for i, item := range workqueue {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not marshal workqueue: %w", err)
+		}
+		encoded[i] = data
+		size += len(data) + 1
+	}
+	if len(workqueue) > 0 {
+		size--
+	}
+
+	dropped := 0
+	drop := func(keep func(ResourceCacheWorkqueueObject) bool) {
+		for i := len(workqueue) - 1; i >= 0 && size > maxBytes; i-- {
+			if encoded[i] == nil || keep(workqueue[i]) {
+				continue
+			}
+			size -= len(encoded[i]) + 1
+			encoded[i] = nil
+			dropped++
+		}
+	}
+	drop(func(item ResourceCacheWorkqueueObject) bool {
+		return item.ResourceUpdate != nil && item.ResourceUpdate.Action == apiresourcecontracts.K8sActionDelete
+	})
+	drop(func(ResourceCacheWorkqueueObject) bool { return false })
+
+	data := make([]byte, 0, max(size, 2))
+	data = append(data, '[')
+	for _, item := range encoded {
+		if item == nil {
+			continue
+		}
+		if len(data) > 1 {
+			data = append(data, ',')
+		}
+		data = append(data, item...)
+	}
+	data = append(data, ']')
+	return data, dropped, nil
+}
+
+func unmarshalWorkqueue(data []byte) ([]ResourceCacheWorkqueueObject, error) {
+	var workqueue []ResourceCacheWorkqueueObject
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(data, &workqueue); err != nil {
+		return nil, fmt.Errorf("could not unmarshal persisted workqueue: %w", err)
+	}
+	return workqueue, nil
+}
@@ -0,0 +1,175 @@
+package resourceupdate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestFileWorkqueuePersistence_SaveLoad(t *testing.T) {
+	workqueue := []ResourceCacheWorkqueueObject{
+		{
+			SubmittedTime: time.Now(),
+			RetryCount:    2,
+			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+				Uid:    "3c99c410-3cdd-11ee-be56-0242ac120002",
+				Action: apiresourcecontracts.K8sActionDelete,
+			},
+		},
+		{
+			SubmittedTime: time.Now(),
+			RetryCount:    0,
+			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+				Uid:        "3c99c410-3cdd-11ee-be56-0242ac120012",
+				ApiVersion: "v1",
+				Kind:       "Namespace",
+				Hash:       "1234",
+				Action:     apiresourcecontracts.K8sActionAdd,
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		save []ResourceCacheWorkqueueObject
+		want []ResourceCacheWorkqueueObject
+	}{
+		{
+			name: "Test persist workqueue with items",
+			save: workqueue,
+			want: workqueue,
+		}, {
+			name: "Test persist empty workqueue",
+			save: []ResourceCacheWorkqueueObject{},
+			want: []ResourceCacheWorkqueueObject{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewFileWorkqueuePersistence(filepath.Join(t.TempDir(), "state", "workqueue.json"))
+			if err := p.Save(tt.save); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			got, err := p.Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !cmp.Equal(got, tt.want, cmpopts.IgnoreTypes(time.Now()), cmpopts.EquateEmpty()) {
+				t.Errorf("%s failed: %s", tt.name, cmp.Diff(tt.want, got, cmpopts.IgnoreTypes(time.Now())))
+			}
+		})
+	}
+}
+
+func TestFileWorkqueuePersistence_LoadMissingFile(t *testing.T) {
+	p := NewFileWorkqueuePersistence(filepath.Join(t.TempDir(), "missing.json"))
+	got, err := p.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Load() got %d items, want 0", len(got))
+	}
+}
+
+func TestFileWorkqueuePersistence_ShardKeys(t *testing.T) {
+	shard := sharding.Shard{Index: 1, Count: 2, Mode: sharding.ModeNamespaces}
+	persistence := NewFileWorkqueuePersistence(filepath.Join(t.TempDir(), "workqueue.json"))
+
+	rc := NewResourceCache(newFakeSender(), persistence, RetryPolicy{})
+	rc.setShard(shard)
+	rc.mu.Lock()
+	rc.addKey("3c99c410-3cdd-11ee-be56-0242ac120002")
+	rc.mu.Unlock()
+	rc.persistShardKeys()
+
+	restored := NewResourceCache(newFakeSender(), persistence, RetryPolicy{})
+	restored.setShard(shard)
+	restored.restoreShardKeys()
+	if _, ok := restored.keys["3c99c410-3cdd-11ee-be56-0242ac120002"]; !ok || len(restored.keys) != 1 {
+		t.Errorf("restoreShardKeys() keys = %v, want the persisted key", restored.keys)
+	}
+
+	// keys of another shard count may now belong to another shard
+	other := NewResourceCache(newFakeSender(), persistence, RetryPolicy{})
+	other.setShard(sharding.Shard{Index: 1, Count: 3, Mode: sharding.ModeNamespaces})
+	other.restoreShardKeys()
+	if len(other.keys) != 0 {
+		t.Errorf("restoreShardKeys() restored %d keys persisted with another shard count", len(other.keys))
+	}
+}
+
+func TestFileWorkqueuePersistence_LoadCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "workqueue.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFileWorkqueuePersistence(path)
+	if _, err := p.Load(); err == nil {
+		t.Errorf("Load() expected error for corrupt file")
+	}
+}
+
+func TestMarshalWorkqueueWithin(t *testing.T) {
+	item := func(uid string, action apiresourcecontracts.ResourceAction) ResourceCacheWorkqueueObject {
+		return ResourceCacheWorkqueueObject{ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{Uid: uid, Action: action}}
+	}
+	workqueue := []ResourceCacheWorkqueueObject{
+		item("delete-1", apiresourcecontracts.K8sActionDelete),
+		item("update-1", apiresourcecontracts.K8sActionUpdate),
+		item("delete-2", apiresourcecontracts.K8sActionDelete),
+		item("update-2", apiresourcecontracts.K8sActionUpdate),
+	}
+	full, err := json.Marshal(workqueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every item has the same size, the array adds the brackets and a comma between the items
+	itemSize := (len(full) - 2 - (len(workqueue) - 1)) / len(workqueue)
+
+	tests := []struct {
+		name        string
+		maxBytes    int
+		wantUids    []string
+		wantDropped int
+	}{
+		{name: "Test workqueue within the limit is kept", maxBytes: len(full), wantUids: []string{"delete-1", "update-1", "delete-2", "update-2"}},
+		{name: "Test newest update is dropped first", maxBytes: len(full) - 1, wantUids: []string{"delete-1", "update-1", "delete-2"}, wantDropped: 1},
+		{name: "Test updates are dropped before deletes", maxBytes: 2*itemSize + 3, wantUids: []string{"delete-1", "delete-2"}, wantDropped: 2},
+		{name: "Test deletes are dropped newest first when needed", maxBytes: itemSize + 2, wantUids: []string{"delete-1"}, wantDropped: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, dropped, err := marshalWorkqueueWithin(workqueue, tt.maxBytes)
+			if err != nil {
+				t.Fatalf("marshalWorkqueueWithin() error = %v", err)
+			}
+			if len(data) > tt.maxBytes {
+				t.Errorf("marshalWorkqueueWithin() %d bytes, want at most %d", len(data), tt.maxBytes)
+			}
+			if dropped != tt.wantDropped {
+				t.Errorf("marshalWorkqueueWithin() dropped %d, want %d", dropped, tt.wantDropped)
+			}
+			got, err := unmarshalWorkqueue(data)
+			if err != nil {
+				t.Fatalf("unmarshalWorkqueue() error = %v", err)
+			}
+			var gotUids []string
+			for _, item := range got {
+				gotUids = append(gotUids, item.ResourceUpdate.Uid)
+			}
+			if !cmp.Equal(gotUids, tt.wantUids) {
+				t.Errorf("%s failed: %s", tt.name, cmp.Diff(tt.wantUids, gotUids))
+			}
+		})
+	}
+}
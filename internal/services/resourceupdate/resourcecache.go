@@ -4,12 +4,20 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
+	"github.com/NorskHelsenett/ror-agent/internal/config"
 	"github.com/NorskHelsenett/ror-agent/internal/services/authservice"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
 
 	"github.com/NorskHelsenett/ror/pkg/helpers/resourcecache/resourcecachehashlist"
 	"github.com/NorskHelsenett/ror/pkg/rlog"
@@ -19,74 +27,323 @@ import (
 	"github.com/go-co-op/gocron"
 )
 
-var ResourceCache resourcecache
+// ResourceWatchers are the dynamic watchers feeding the resource cache.
+type ResourceWatchers interface {
+	// HasSynced reports whether every watcher has sent all existing resources since the last resync.
+	HasSynced() bool
+	// Resync makes every watcher send all existing resources again.
+	Resync()
+}
 
-type resourcecache struct {
+// ResourceCache keeps track of the resources sent to ror-api and retries the updates that failed.
+// It is shared by every dynamic watcher and the scheduler, all state is guarded by mu.
+type ResourceCache struct {
+	// ctx is used by the schedulers, it is canceled when the agent shuts down
+	ctx                     context.Context
+	mu                      sync.Mutex
+	runMu                   sync.Mutex
 	client                  clusteragentclient.RorAgentClientInterface
+	sender                  ResourceUpdateSender
 	HashList                resourcecachehashlist.HashList
 	Workqueue               ResourceCacheWorkqueue
+	DeadLetters             ResourceCacheDeadLetters
+	retryPolicy             RetryPolicy
 	cleanupRunning          bool
+	cleanupStarted          time.Time
+	cleanupDelay            time.Duration
+	reconcileInterval       int
+	watchers                ResourceWatchers
 	scheduler               *gocron.Scheduler
 	memLogLastEstimateBytes uint64
+	persistence             WorkqueuePersistence
+	persistedItems          int
+	// persistSignal wakes the workqueue persister when the workqueue has changed
+	persistSignal chan struct{}
+	inFlight      map[string]struct{}
+	// workqueueProgress is when an update last left the workqueue, or the workqueue was last seen empty
+	workqueueProgress time.Time
+	workqueueMaxItems int
+	workqueueMaxStuck time.Duration
+	// shard is the part of the cluster watched by this replica, when sharded the cleanup only removes resources among keys
+	shard sharding.Shard
+	// keys are the uids of the resources of the shard, nil when not sharded, see shardkeys.go
+	keys        map[string]struct{}
+	keysChanged bool
+}
+
+// NewResourceCache returns a resource cache using the given sender, without contacting ror-api or starting any schedulers.
+func NewResourceCache(sender ResourceUpdateSender, persistence WorkqueuePersistence, retryPolicy RetryPolicy) *ResourceCache {
+	if persistence == nil {
+		persistence = noopWorkqueuePersistence{}
+	}
+	return &ResourceCache{
+		ctx:               context.Background(),
+		sender:            sender,
+		persistence:       persistence,
+		retryPolicy:       retryPolicy,
+		workqueueProgress: time.Now(),
+		persistSignal:     make(chan struct{}, 1),
+	}
 }
 
-func (rc *resourcecache) MustInit(client clusteragentclient.RorAgentClientInterface) {
+// MustInitNewResourceCache creates the resource cache used by the agent, loads the hashlist from ror-api,
+// replays the persisted workqueue and starts the workqueue and cleanup schedulers. The schedulers stop sending when ctx is canceled.
+func MustInitNewResourceCache(ctx context.Context, client clusteragentclient.RorAgentClientInterface, shard sharding.Shard) *ResourceCache {
 	var err error
 	if client == nil {
-		rc.client, err = clusteragentclient.NewRorAgentClient(clusteragentclient.GetDefaultRorAgentClientConfig())
+		client, err = clusteragentclient.NewRorAgentClient(clusteragentclient.GetDefaultRorAgentClientConfig())
 		if err != nil {
 			rlog.Fatal("failed to initialize cluster agent client for resource cache", err)
 		}
-	} else {
-		rc.client = client
 	}
-	rc.HashList, err = rc.client.GetRorClient().V1().Resources().GetHashList(context.TODO(), rc.client.GetRorClient().GetOwnerref())
+	rc := NewResourceCache(NewRorResourceUpdateSender(client), NewWorkqueuePersistenceFromConfig(client, shard), NewRetryPolicyFromConfig())
+	rc.ctx = ctx
+	rc.setShard(shard)
+	rc.client = client
+	rc.cleanupDelay = time.Duration(rorconfig.GetInt(config.ResourceCleanupDelaySecondsEnv)) * time.Second
+	rc.reconcileInterval = rorconfig.GetInt(config.ResourceReconcileIntervalMinutesEnv)
+	rc.workqueueMaxItems = rorconfig.GetInt(config.WorkqueueHealthMaxItemsEnv)
+	rc.workqueueMaxStuck = time.Duration(rorconfig.GetInt(config.WorkqueueHealthMaxStuckSecondsEnv)) * time.Second
+
+	rc.HashList, err = rc.getHashList(ctx)
 	if err != nil {
 		rlog.Fatal("could not get hashlist for clusterid", err)
 	}
 	rlog.Info("got hashList from ror-api", rlog.Int("length", len(rc.HashList.Items)))
 
+	healthservice.RegisterCheck("resourceDeadLetters", rc.deadLetterHealthCheck)
+	healthservice.RegisterReadinessCheck("resourceWorkqueue", rc.workqueueHealthCheck)
+	rc.registerWorkqueueMetrics()
+
+	rc.restoreWorkqueue()
+	rc.restoreShardKeys()
+
 	rc.scheduler = gocron.NewScheduler(time.Local)
 	rc.scheduler.StartAsync()
 	rc.addWorkqueScheduler(10)
-	rc.startCleanup()
+	if _, ok := rc.persistence.(noopWorkqueuePersistence); !ok {
+		go rc.runWorkqueuePersister(ctx)
+	}
+	if _, ok := rc.persistence.(shardKeysPersistence); ok && rc.keys != nil {
+		go rc.runShardKeysPersister(ctx)
+	}
+	rc.beginCleanup()
+	return rc
+}
+
+// restoreWorkqueue loads the workqueue persisted by a previous run and replays it against ror-api.
+// Deletes are only known through the workqueue, so this is the only way to recover them after a restart.
+func (rc *ResourceCache) restoreWorkqueue() {
+	restored, err := rc.persistence.Load()
+	if err != nil {
+		rlog.Error("could not load persisted workqueue, starting with an empty workqueue", err)
+		return
+	}
+	if len(restored) == 0 {
+		return
+	}
+
+	deletes := 0
+	rc.mu.Lock()
+	for _, item := range restored {
+		if item.ResourceUpdate == nil || item.ResourceUpdate.Uid == "" {
+			continue
+		}
+		if item.ResourceUpdate.Action == apiresourcecontracts.K8sActionDelete {
+			deletes++
+		}
+		rc.Workqueue.AddObject(item)
+	}
+	rc.persistedItems = rc.Workqueue.ItemCount()
+	rlog.Info("restored persisted workqueue", rlog.Int("items", rc.persistedItems), rlog.Int("deletes", deletes))
+	rc.mu.Unlock()
+
+	rc.RunWorkQue()
+	rc.persistWorkqueue()
+}
+
+// workqueueChanged wakes the workqueue persister, it never blocks and may be called with mu held.
+func (rc *ResourceCache) workqueueChanged() {
+	select {
+	case rc.persistSignal <- struct{}{}:
+	default:
+	}
 }
 
-func (rc resourcecache) CleanupRunning() bool {
+// runWorkqueuePersister saves the workqueue every time it changes, at most once per workqueuePersistInterval,
+// until ctx is canceled. Changes made while a save is running are written by the next save, so a crash loses
+// at most the updates queued within workqueuePersistInterval and the duration of one save.
+func (rc *ResourceCache) runWorkqueuePersister(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rc.persistSignal:
+		}
+		rc.persistWorkqueue()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(workqueuePersistInterval):
+		}
+	}
+}
+
+// persistWorkqueue saves the current workqueue using the configured persistence backend.
+// An empty workqueue is only written once, to clear the previously persisted snapshot.
+func (rc *ResourceCache) persistWorkqueue() {
+	if rc.persistence == nil {
+		return
+	}
+	rc.mu.Lock()
+	if rc.Workqueue.ItemCount() == 0 && rc.persistedItems == 0 {
+		rc.mu.Unlock()
+		return
+	}
+	snapshot := rc.Workqueue.Items()
+	rc.mu.Unlock()
+
+	err := rc.persistence.Save(snapshot)
+	if err != nil {
+		rlog.Error("could not persist workqueue", err, rlog.Int("items", len(snapshot)))
+		return
+	}
+	rc.mu.Lock()
+	rc.persistedItems = len(snapshot)
+	rc.mu.Unlock()
+}
+
+func (rc *ResourceCache) CleanupRunning() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	return rc.cleanupRunning
 }
-func (rc *resourcecache) MarkActive(uid string) {
+func (rc *ResourceCache) MarkActive(uid string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	rc.HashList.MarkActive(uid)
 }
 
-func (rc resourcecache) addWorkqueScheduler(seconds int) {
+func (rc *ResourceCache) addWorkqueScheduler(seconds int) {
 	_, _ = rc.scheduler.Every(seconds).Second().Tag("workquerunner").Do(rc.runWorkqueScheduler)
 }
-func (rc resourcecache) runWorkqueScheduler() {
-	if rc.Workqueue.NeedToRun() {
-		rlog.Warn("resourceQue has non zero length", rlog.Int("resource que length", rc.Workqueue.ItemCount()))
+func (rc *ResourceCache) runWorkqueScheduler() {
+	rc.mu.Lock()
+	needToRun := rc.Workqueue.NeedToRun()
+	itemCount := rc.Workqueue.ItemCount()
+	if !needToRun {
+		rc.workqueueProgress = time.Now()
+	}
+	rc.mu.Unlock()
+	if needToRun {
+		rlog.Warn("resourceQue has non zero length", rlog.Int("resource que length", itemCount))
 		rc.RunWorkQue()
 	}
 }
 
-func (rc *resourcecache) startCleanup() {
+// beginCleanup starts tracking which resources known by ror-api are still present in the cluster.
+func (rc *ResourceCache) beginCleanup() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	rc.cleanupRunning = true
-	runAt := time.Now().Add(1 * time.Minute)
-	_, err := rc.scheduler.Every(1).Day().At(runAt.Format("15:04:05")).LimitRunsTo(1).Tag("resourcescleanup").Do(rc.finnishCleanup)
+	rc.cleanupStarted = time.Now()
+}
+
+// StartCleanup schedules the removal of resources no longer present in the cluster once every watcher has
+// completed its initial list, and the periodic reconciliation against ror-api if enabled.
+// When sharded only the resources among the keys of the shard are removed, the hashlist also holds the resources of the other shards.
+func (rc *ResourceCache) StartCleanup(watchers ResourceWatchers) {
+	rc.watchers = watchers
+	rc.scheduleCleanup()
+	if rc.reconcileInterval <= 0 {
+		return
+	}
+	interval := time.Duration(rc.reconcileInterval) * time.Minute
+	_, err := rc.scheduler.Every(interval).StartAt(time.Now().Add(interval)).Tag("resourcesreconcile").Do(rc.reconcile)
+	if err != nil {
+		rlog.Error("failed scheduling resource reconciliation", err, rlog.Any("tag", "resourcesreconcile"))
+		return
+	}
+	rlog.Info("scheduled resource reconciliation", rlog.Any("tag", "resourcesreconcile"), rlog.Any("interval", interval.String()))
+}
+
+func (rc *ResourceCache) scheduleCleanup() {
+	_ = rc.scheduler.RemoveByTag("resourcescleanup")
+	_, err := rc.scheduler.Every(10).Seconds().Tag("resourcescleanup").Do(rc.maybeFinishCleanup)
+	if err != nil {
+		rlog.Error("failed scheduling resource cleanup", err, rlog.Any("tag", "resourcescleanup"))
+		return
+	}
+	rlog.Info("scheduled resource cleanup", rlog.Any("tag", "resourcescleanup"), rlog.Any("delay", rc.cleanupDelay.String()))
+}
+
+// maybeFinishCleanup runs the cleanup once the cleanup delay has passed and every watcher has synced.
+// Resources not yet seen by a watcher still listing would otherwise be removed from ror.
+func (rc *ResourceCache) maybeFinishCleanup() {
+	rc.mu.Lock()
+	running := rc.cleanupRunning
+	started := rc.cleanupStarted
+	rc.mu.Unlock()
+	if !running {
+		return
+	}
+	if time.Since(started) < rc.cleanupDelay {
+		return
+	}
+	if rc.watchers != nil && !rc.watchers.HasSynced() {
+		rlog.Debug("waiting for dynamic watchers to sync before resource cleanup", rlog.Any("waited", time.Since(started).String()))
+		return
+	}
+	rc.finnishCleanup()
+}
+
+// reconcile fetches the hashlist from ror-api and makes every watcher resend the resources in the cluster,
+// resources changed or missing in ror are sent again and resources no longer in the cluster are removed.
+func (rc *ResourceCache) reconcile() {
+	if rc.CleanupRunning() {
+		rlog.Info("resource cleanup is running, skipping resource reconciliation")
+		return
+	}
+	hashList, err := rc.getHashList(rc.ctx)
 	if err != nil {
-		rlog.Error("failed scheduling resource cleanup", err, rlog.Any("tag", "resourcescleanup"), rlog.Any("run_at", runAt))
+		rlog.Error("could not get hashlist for resource reconciliation", err)
 		return
 	}
-	rlog.Info("scheduled resource cleanup", rlog.Any("tag", "resourcescleanup"), rlog.Any("run_at", runAt))
+	rc.mu.Lock()
+	rc.HashList = hashList
+	rc.mu.Unlock()
+	rc.beginCleanup()
+	rlog.Info("resource reconciliation started", rlog.Int("length", len(hashList.Items)))
+
+	if rc.watchers != nil {
+		rc.watchers.Resync()
+	}
+	rc.scheduleCleanup()
+}
+
+func (rc *ResourceCache) getHashList(ctx context.Context) (resourcecachehashlist.HashList, error) {
+	ctx, cancel := timeouts.RorApi(ctx)
+	defer cancel()
+	start := time.Now()
+	hashList, err := rc.client.GetRorClient().V1().Resources().GetHashList(ctx, rc.client.GetRorClient().GetOwnerref())
+	metricsservice.ObserveRorApiRequest("resources_hashlist", start, err)
+	return hashList, err
 }
 
-func (rc *resourcecache) finnishCleanup() {
+func (rc *ResourceCache) finnishCleanup() {
+	rc.mu.Lock()
 	if !rc.cleanupRunning {
+		rc.mu.Unlock()
 		return
 	}
 	rc.cleanupRunning = false
-	_ = rc.scheduler.RemoveByTag("resourcescleanup")
-	inactive := rc.HashList.GetInactiveUid()
+	inactive := rc.scopeToShard(rc.HashList.GetInactiveUid())
+	rc.mu.Unlock()
+
+	if rc.scheduler != nil {
+		_ = rc.scheduler.RemoveByTag("resourcescleanup")
+	}
 	rlog.Info("resource cleanup running", rlog.Int("inactive_count", len(inactive)))
 	if len(inactive) == 0 {
 		runtime.GC()
@@ -99,49 +356,208 @@ func (rc *resourcecache) finnishCleanup() {
 			Uid:    uid,
 			Action: apiresourcecontracts.K8sActionDelete,
 		}
-		_ = rc.sendResourceUpdateToRor(&resource)
+		rc.cleanupDone(uid, rc.sender.Send(rc.ctx, &resource))
 	}
 	rlog.Info(fmt.Sprintf("resource cleanup done, %d resources removed", len(inactive)))
 	runtime.GC()
 }
 
-func (rc resourcecache) PrettyPrintHashes() {
+// cleanupDone records the result of removing an inactive resource, it stays among the keys of the shard if the removal failed.
+func (rc *ResourceCache) cleanupDone(uid string, err error) {
+	observeResourceUpdate(apiresourcecontracts.K8sActionDelete, err)
+	if err != nil {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.removeKey(uid)
+}
+
+func (rc *ResourceCache) PrettyPrintHashes() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
 	stringhelper.PrettyprintStruct(rc.HashList)
 }
 
 // RunWorkQue Will run from the scheduler if the resource-que is non zero length.
-// Resources in the que wil be requed using the sendResourceUpdateToRor function.
-func (rc *resourcecache) RunWorkQue() {
-	for _, resourceReturn := range rc.Workqueue {
-		err := rc.sendResourceUpdateToRor(resourceReturn.ResourceUpdate)
-		if err != nil {
-			rlog.Error("error re-sending resource update to ror, added to retryque", err)
-			rc.Workqueue.Add(resourceReturn.ResourceUpdate)
+// Resources in the que wil be requed using the sender once their backoff has expired.
+// Updates rejected by ror-api are skipped so they don't block the rest of the que, and are dead-lettered
+// after the configured number of retries. Any other error stops the run, as ror-api is most likely unavailable.
+// Only one run is active at a time, and the lock is not held while sending so watchers are never blocked by ror-api.
+func (rc *ResourceCache) RunWorkQue() {
+	if !rc.runMu.TryLock() {
+		return
+	}
+	defer rc.runMu.Unlock()
+	rc.sendWorkqueueItems(rc.ctx, rc.dueWorkqueueItems(time.Now()))
+}
+
+// Shutdown stops the schedulers and tries to send every queued update once,
+// ignoring the retry backoff, until ctx expires. Updates still queued are persisted for the next run.
+func (rc *ResourceCache) Shutdown(ctx context.Context) error {
+	if rc.scheduler != nil {
+		rc.scheduler.Stop()
+	}
+	rc.runMu.Lock()
+	rc.mu.Lock()
+	items := rc.Workqueue.Items()
+	rc.mu.Unlock()
+	rc.sendWorkqueueItems(ctx, items)
+	rc.runMu.Unlock()
+
+	rc.persistWorkqueue()
+	rc.persistShardKeys()
+
+	rc.mu.Lock()
+	remaining := rc.Workqueue.ItemCount()
+	rc.mu.Unlock()
+	if remaining == 0 {
+		return nil
+	}
+	if _, ok := rc.persistence.(noopWorkqueuePersistence); ok {
+		return fmt.Errorf("%d resource updates not sent to ror and lost at shutdown", remaining)
+	}
+	rlog.Warn("resource updates not sent to ror at shutdown, persisted for the next run", rlog.Int("items", remaining))
+	return nil
+}
+
+// sendWorkqueueItems sends the items until ctx expires or ror-api fails. Must be called with runMu held.
+func (rc *ResourceCache) sendWorkqueueItems(ctx context.Context, items []ResourceCacheWorkqueueObject) {
+	for _, resourceReturn := range items {
+		if ctx.Err() != nil {
 			return
 		}
-		rc.Workqueue.DeleteByUid(resourceReturn.ResourceUpdate.Uid)
-		rc.HashList.UpdateHash(resourceReturn.ResourceUpdate.Uid, resourceReturn.ResourceUpdate.Hash)
+		uid := resourceReturn.ResourceUpdate.Uid
+		rc.mu.Lock()
+		if !rc.isQueued(resourceReturn) || !rc.beginSend(uid) {
+			rc.mu.Unlock()
+			continue
+		}
+		rc.mu.Unlock()
+
+		err := rc.sender.Send(ctx, resourceReturn.ResourceUpdate)
+		observeResourceUpdate(resourceReturn.ResourceUpdate.Action, err)
+
+		rc.mu.Lock()
+		rc.endSend(uid)
+		queued := rc.isQueued(resourceReturn)
+		if err == nil {
+			if queued {
+				rc.Workqueue.DeleteByUid(uid)
+				rc.workqueueChanged()
+				rc.HashList.UpdateHash(uid, resourceReturn.ResourceUpdate.Hash)
+				rc.workqueueProgress = time.Now()
+			}
+			rc.mu.Unlock()
+			continue
+		}
+		if !queued {
+			// superseded by a newer update while sending, the newer update is retried instead
+			rc.mu.Unlock()
+			continue
+		}
+		if rc.retryPolicy.ShouldDeadLetter(resourceReturn, err) {
+			rc.Workqueue.DeleteByUid(uid)
+			rc.workqueueChanged()
+			rc.DeadLetters.Add(resourceReturn, err)
+			rc.workqueueProgress = time.Now()
+			rc.mu.Unlock()
+			logDeadLetter(resourceReturn, err)
+			continue
+		}
+		rc.Workqueue.Retry(uid)
+		rc.workqueueChanged()
+		rc.mu.Unlock()
+
+		if isClientError(err) {
+			rlog.Warn("resource update rejected by ror, will retry", rlog.String("uid", uid), rlog.Int("retry_count", resourceReturn.RetryCount+1), rlog.Any("error", err))
+			continue
+		}
+		rlog.Error("error re-sending resource update to ror, added to retryque", err)
+		return
 	}
 }
 
-// the function sends the resource to the ror api. If receiving a non 2xx statuscode it will retun an error.
-func (rc *resourcecache) sendResourceUpdateToRor(resourceUpdate *apiresourcecontracts.ResourceUpdateModel) error {
-	rorClient := rc.client.GetRorClient()
-	var err error
+// dueWorkqueueItems returns a copy of the workqueue items whose backoff has expired.
+func (rc *ResourceCache) dueWorkqueueItems(now time.Time) []ResourceCacheWorkqueueObject {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var due []ResourceCacheWorkqueueObject
+	for _, item := range rc.Workqueue.Items() {
+		if rc.retryPolicy.IsDue(item, now) {
+			due = append(due, item)
+		}
+	}
+	return due
+}
 
-	switch resourceUpdate.Action {
-	case apiresourcecontracts.K8sActionUpdate:
-		err = rorClient.V1().Resources().Update(context.TODO(), resourceUpdate)
-	case apiresourcecontracts.K8sActionAdd:
-		err = rorClient.V1().Resources().Create(context.TODO(), resourceUpdate)
-	case apiresourcecontracts.K8sActionDelete:
-		err = rorClient.V1().Resources().Delete(context.TODO(), resourceUpdate.Uid)
-	default:
-		rlog.Error("Not implemented", nil)
+// isQueued reports whether the item is still the queued update for its uid.
+// A watcher may have replaced it with a newer update while it was being sent, the newer update must be kept.
+// Must be called with mu held.
+func (rc *ResourceCache) isQueued(item ResourceCacheWorkqueueObject) bool {
+	current, found := rc.Workqueue.GetByUid(item.ResourceUpdate.Uid)
+	return found && current.ResourceUpdate == item.ResourceUpdate
+}
 
+// beginSend marks the uid as being sent to ror-api, so updates of a single resource are never sent concurrently
+// and ror-api always receives them in order. Returns false if the uid is already being sent. Must be called with mu held.
+func (rc *ResourceCache) beginSend(uid string) bool {
+	if rc.inFlight == nil {
+		rc.inFlight = make(map[string]struct{})
 	}
-	if err != nil {
-		return err
+	if _, ok := rc.inFlight[uid]; ok {
+		return false
 	}
-	return nil
+	rc.inFlight[uid] = struct{}{}
+	return true
+}
+
+// endSend clears the mark set by beginSend. Must be called with mu held.
+func (rc *ResourceCache) endSend(uid string) {
+	delete(rc.inFlight, uid)
+}
+
+func logDeadLetter(item ResourceCacheWorkqueueObject, err error) {
+	rlog.Warn("resource update dead-lettered after repeated rejections from ror",
+		rlog.String("uid", item.ResourceUpdate.Uid),
+		rlog.String("kind", item.ResourceUpdate.Kind),
+		rlog.String("action", string(item.ResourceUpdate.Action)),
+		rlog.Int("status_code", statuscode.FromError(err)),
+		rlog.Int("retry_count", item.RetryCount),
+		rlog.Any("error", err))
+}
+
+func (rc *ResourceCache) deadLetterHealthCheck() healthservice.CheckResult {
+	rc.mu.Lock()
+	count := rc.DeadLetters.ItemCount()
+	rc.mu.Unlock()
+	if count == 0 {
+		return healthservice.CheckResult{Status: healthservice.StatusPass}
+	}
+	return healthservice.CheckResult{
+		Status: healthservice.StatusWarn,
+		Output: fmt.Sprintf("%d resource updates dead-lettered after being rejected by ror", count),
+	}
+}
+
+// workqueueHealthCheck fails when the workqueue holds more updates than allowed,
+// or has held updates without sending any of them for too long, most likely because ror-api is unavailable.
+func (rc *ResourceCache) workqueueHealthCheck() healthservice.CheckResult {
+	rc.mu.Lock()
+	count := rc.Workqueue.ItemCount()
+	stuck := time.Since(rc.workqueueProgress)
+	rc.mu.Unlock()
+	if rc.workqueueMaxItems > 0 && count > rc.workqueueMaxItems {
+		return healthservice.CheckResult{
+			Status: healthservice.StatusFail,
+			Output: fmt.Sprintf("%d resource updates queued, more than %d", count, rc.workqueueMaxItems),
+		}
+	}
+	if rc.workqueueMaxStuck > 0 && count > 0 && stuck > rc.workqueueMaxStuck {
+		return healthservice.CheckResult{
+			Status: healthservice.StatusFail,
+			Output: fmt.Sprintf("%d resource updates queued, none sent for %s", count, stuck.Round(time.Second)),
+		}
+	}
+	return healthservice.CheckResult{Status: healthservice.StatusPass}
 }
@@ -1,8 +1,19 @@
 package resourceupdate
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
 	"github.com/NorskHelsenett/ror/pkg/helpers/resourcecache/resourcecachehashlist"
 	"github.com/go-co-op/gocron"
 	"github.com/stretchr/testify/assert"
@@ -30,14 +41,14 @@ func Test_resourcecache_CleanupRunning(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rc := resourcecache{
+			rc := ResourceCache{
 				HashList:       tt.fields.HashList,
 				Workqueue:      tt.fields.Workqueue,
 				cleanupRunning: tt.fields.cleanupRunning,
 				scheduler:      tt.fields.scheduler,
 			}
 			if got := rc.CleanupRunning(); got != tt.want {
-				t.Errorf("resourcecache.CleanupRunning() = %v, want %v", got, tt.want)
+				t.Errorf("ResourceCache.CleanupRunning() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -113,7 +124,7 @@ func Test_resourcecache_MarkActive(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rc := resourcecache{
+			rc := ResourceCache{
 				HashList:       tt.fields.HashList,
 				Workqueue:      tt.fields.Workqueue,
 				cleanupRunning: tt.fields.cleanupRunning,
@@ -166,7 +177,7 @@ func Test_resourcecache_runWorkqueScheduler(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			rc := resourcecache{
+			rc := ResourceCache{
 				HashList:       tt.fields.HashList,
 				Workqueue:      tt.fields.Workqueue,
 				cleanupRunning: tt.fields.cleanupRunning,
@@ -177,3 +188,325 @@ func Test_resourcecache_runWorkqueScheduler(t *testing.T) {
 		})
 	}
 }
+
+// fakeSender records the hashes sent per uid and fails while failing is set.
+type fakeSender struct {
+	failing atomic.Bool
+	mu      sync.Mutex
+	sent    map[string][]string
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{sent: make(map[string][]string)}
+}
+
+func (s *fakeSender) Send(_ context.Context, resourceUpdate *apiresourcecontracts.ResourceUpdateModel) error {
+	if s.failing.Load() {
+		return statuscode.New(503, "request failed")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[resourceUpdate.Uid] = append(s.sent[resourceUpdate.Uid], resourceUpdate.Hash)
+	return nil
+}
+
+// Test_resourcecache_concurrentWatchers simulates many watchers sending updates while ror-api flaps
+// and the scheduler drains and persists the workqueue, run with -race.
+func Test_resourcecache_concurrentWatchers(t *testing.T) {
+	const (
+		watchers          = 20
+		resourcesPerWatch = 10
+		versions          = 20
+	)
+	sender := newFakeSender()
+	rc := NewResourceCache(sender, nil, RetryPolicy{})
+	rc.cleanupRunning = true
+
+	stop := make(chan struct{})
+	var background sync.WaitGroup
+	background.Add(2)
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				sender.failing.Store(!sender.failing.Load())
+				rc.RunWorkQue()
+				rc.persistWorkqueue()
+			}
+		}
+	}()
+	go func() {
+		defer background.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = rc.CleanupRunning()
+				_ = rc.deadLetterHealthCheck()
+				rc.runWorkqueScheduler()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < watchers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for v := 0; v < versions; v++ {
+				for r := 0; r < resourcesPerWatch; r++ {
+					rc.sendResourceUpdate(context.Background(), &apiresourcecontracts.ResourceUpdateModel{
+						Uid:    fmt.Sprintf("%d-%d", w, r),
+						Hash:   strconv.Itoa(v),
+						Action: apiresourcecontracts.K8sActionUpdate,
+					})
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	background.Wait()
+
+	sender.failing.Store(false)
+	rc.RunWorkQue()
+	assert.Equal(t, 0, rc.Workqueue.ItemCount())
+
+	for w := 0; w < watchers; w++ {
+		for r := 0; r < resourcesPerWatch; r++ {
+			uid := fmt.Sprintf("%d-%d", w, r)
+			sent := sender.sent[uid]
+			if !assert.NotEmpty(t, sent, uid) {
+				continue
+			}
+			last := -1
+			for _, hash := range sent {
+				version, _ := strconv.Atoi(hash)
+				assert.GreaterOrEqual(t, version, last, "updates for %s sent out of order: %v", uid, sent)
+				last = version
+			}
+			assert.Equal(t, strconv.Itoa(versions-1), sent[len(sent)-1], uid)
+		}
+	}
+}
+
+// Test_resourcecache_updateWhileAddFails queues an update while the add of the resource is sent, the add fails
+// and the queued update has to be sent as an add.
+func Test_resourcecache_updateWhileAddFails(t *testing.T) {
+	rc := NewResourceCache(newFakeSender(), nil, RetryPolicy{})
+	uid := "3c99c410-3cdd-11ee-be56-0242ac120002"
+	add := &apiresourcecontracts.ResourceUpdateModel{Uid: uid, Action: apiresourcecontracts.K8sActionAdd, Hash: "1"}
+	update := &apiresourcecontracts.ResourceUpdateModel{Uid: uid, Action: apiresourcecontracts.K8sActionUpdate, Hash: "2"}
+
+	rc.mu.Lock()
+	rc.beginSend(uid)
+	rc.Workqueue.Add(update)
+	rc.mu.Unlock()
+	rc.sendDone(add, statuscode.New(503, "request failed"))
+
+	queued, found := rc.Workqueue.GetByUid(uid)
+	assert.True(t, found)
+	assert.Equal(t, apiresourcecontracts.K8sActionAdd, queued.ResourceUpdate.Action)
+	assert.Equal(t, "2", queued.ResourceUpdate.Hash)
+	assert.Equal(t, apiresourcecontracts.K8sActionUpdate, update.Action)
+}
+
+// fakeWatchers reports synced once synced is set.
+type fakeWatchers struct {
+	synced  atomic.Bool
+	resyncs atomic.Int32
+}
+
+func (w *fakeWatchers) HasSynced() bool { return w.synced.Load() }
+func (w *fakeWatchers) Resync()         { w.resyncs.Add(1) }
+
+func Test_resourcecache_maybeFinishCleanup(t *testing.T) {
+	tests := []struct {
+		name         string
+		synced       bool
+		cleanupDelay time.Duration
+		wantDeletes  int
+		wantRunning  bool
+	}{
+		{
+			name:        "Test cleanup waits for watchers to sync",
+			synced:      false,
+			wantDeletes: 0,
+			wantRunning: true,
+		}, {
+			name:         "Test cleanup waits for cleanup delay",
+			synced:       true,
+			cleanupDelay: time.Hour,
+			wantDeletes:  0,
+			wantRunning:  true,
+		}, {
+			name:        "Test cleanup removes inactive resources once synced",
+			synced:      true,
+			wantDeletes: 1,
+			wantRunning: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := newFakeSender()
+			watchers := &fakeWatchers{}
+			watchers.synced.Store(tt.synced)
+
+			rc := NewResourceCache(sender, nil, RetryPolicy{})
+			rc.HashList = resourcecachehashlist.HashList{
+				Items: []resourcecachehashlist.HashItem{
+					{Uid: "3c99c410-3cdd-11ee-be56-0242ac120002", Hash: "1234"},
+					{Uid: "3c99c410-3cdd-11ee-be56-0242ac120022", Hash: "12345"},
+				},
+			}
+			rc.cleanupDelay = tt.cleanupDelay
+			rc.watchers = watchers
+			rc.beginCleanup()
+			rc.MarkActive("3c99c410-3cdd-11ee-be56-0242ac120002")
+
+			rc.maybeFinishCleanup()
+
+			assert.Len(t, sender.sent, tt.wantDeletes)
+			assert.Equal(t, tt.wantRunning, rc.CleanupRunning())
+			if tt.wantDeletes > 0 {
+				assert.Contains(t, sender.sent, "3c99c410-3cdd-11ee-be56-0242ac120022")
+			}
+		})
+	}
+}
+
+func Test_resourcecache_shardCleanup(t *testing.T) {
+	sender := newFakeSender()
+	rc := NewResourceCache(sender, nil, RetryPolicy{})
+	rc.setShard(sharding.Shard{Index: 0, Count: 2, Mode: sharding.ModeNamespaces})
+	rc.HashList = resourcecachehashlist.HashList{
+		Items: []resourcecachehashlist.HashItem{
+			{Uid: "3c99c410-3cdd-11ee-be56-0242ac120002", Hash: "1"},
+			{Uid: "3c99c410-3cdd-11ee-be56-0242ac120022", Hash: "2"},
+			{Uid: "3c99c410-3cdd-11ee-be56-0242ac120042", Hash: "3"},
+		},
+	}
+	rc.beginCleanup()
+	// a resource of the shard found unchanged, and a resource of the shard deleted while the agent was down
+	rc.sendResourceUpdate(context.Background(), &apiresourcecontracts.ResourceUpdateModel{Uid: "3c99c410-3cdd-11ee-be56-0242ac120002", Hash: "1", Action: apiresourcecontracts.K8sActionUpdate})
+	rc.mu.Lock()
+	rc.addKey("3c99c410-3cdd-11ee-be56-0242ac120022")
+	rc.mu.Unlock()
+
+	rc.finnishCleanup()
+
+	// the inactive resource not among the keys belongs to another shard
+	assert.Len(t, sender.sent, 1)
+	assert.Contains(t, sender.sent, "3c99c410-3cdd-11ee-be56-0242ac120022")
+	assert.NotContains(t, rc.keys, "3c99c410-3cdd-11ee-be56-0242ac120022")
+	assert.Contains(t, rc.keys, "3c99c410-3cdd-11ee-be56-0242ac120002")
+}
+
+func Test_resourcecache_Shutdown(t *testing.T) {
+	tests := []struct {
+		name          string
+		failing       bool
+		persistToFile bool
+		wantSent      int
+		wantQueued    int
+		wantErr       bool
+	}{
+		{
+			name:     "Test shutdown sends queued updates ignoring backoff",
+			wantSent: 2,
+		}, {
+			name:       "Test shutdown fails when updates are lost",
+			failing:    true,
+			wantQueued: 2,
+			wantErr:    true,
+		}, {
+			name:          "Test shutdown persists updates not sent",
+			failing:       true,
+			persistToFile: true,
+			wantQueued:    2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := newFakeSender()
+			sender.failing.Store(tt.failing)
+			var persistence WorkqueuePersistence
+			if tt.persistToFile {
+				persistence = NewFileWorkqueuePersistence(t.TempDir() + "/workqueue.json")
+			}
+
+			rc := NewResourceCache(sender, persistence, RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour})
+			for i, uid := range []string{"3c99c410-3cdd-11ee-be56-0242ac120002", "3c99c410-3cdd-11ee-be56-0242ac120022"} {
+				rc.Workqueue.Add(&apiresourcecontracts.ResourceUpdateModel{Uid: uid, Hash: strconv.Itoa(i), Action: apiresourcecontracts.K8sActionUpdate})
+				rc.Workqueue.Retry(uid)
+			}
+
+			err := rc.Shutdown(context.Background())
+
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Len(t, sender.sent, tt.wantSent)
+			assert.Equal(t, tt.wantQueued, rc.Workqueue.ItemCount())
+			if tt.persistToFile {
+				persisted, err := persistence.Load()
+				assert.NoError(t, err)
+				assert.Len(t, persisted, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func Test_resourcecache_workqueuePersister(t *testing.T) {
+	sender := newFakeSender()
+	sender.failing.Store(true)
+	persistence := NewFileWorkqueuePersistence(t.TempDir() + "/workqueue.json")
+	rc := NewResourceCache(sender, persistence, RetryPolicy{BaseDelay: time.Hour, MaxDelay: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rc.runWorkqueuePersister(ctx)
+
+	// a failed update is persisted as soon as it is queued, not only at shutdown
+	rc.sendResourceUpdate(ctx, &apiresourcecontracts.ResourceUpdateModel{Uid: "3c99c410-3cdd-11ee-be56-0242ac120002", Hash: "1", Action: apiresourcecontracts.K8sActionUpdate})
+	assert.Eventually(t, func() bool {
+		persisted, err := persistence.Load()
+		return err == nil && len(persisted) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// and removed once it is sent
+	sender.failing.Store(false)
+	rc.RunWorkQue()
+	assert.Eventually(t, func() bool {
+		persisted, err := persistence.Load()
+		return err == nil && len(persisted) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func Test_resourcecache_workqueueHealthCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		queued   int
+		progress time.Duration
+		want     healthservice.Status
+	}{
+		{name: "Test empty workqueue passes", progress: -2 * time.Hour, want: healthservice.StatusPass},
+		{name: "Test workqueue sending updates passes", queued: 2, progress: -time.Minute, want: healthservice.StatusPass},
+		{name: "Test workqueue over max items fails", queued: 4, progress: -time.Minute, want: healthservice.StatusFail},
+		{name: "Test workqueue not sending updates fails", queued: 1, progress: -2 * time.Hour, want: healthservice.StatusFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := NewResourceCache(newFakeSender(), nil, RetryPolicy{})
+			rc.workqueueMaxItems = 3
+			rc.workqueueMaxStuck = time.Hour
+			rc.workqueueProgress = time.Now().Add(tt.progress)
+			for i := range tt.queued {
+				rc.Workqueue.Add(&apiresourcecontracts.ResourceUpdateModel{Uid: strconv.Itoa(i), Action: apiresourcecontracts.K8sActionUpdate})
+			}
+
+			assert.Equal(t, tt.want, rc.workqueueHealthCheck().Status)
+		})
+	}
+}
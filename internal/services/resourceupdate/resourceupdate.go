@@ -1,6 +1,8 @@
 package resourceupdate
 
 import (
+	"context"
+
 	"github.com/NorskHelsenett/ror-agent/internal/models/rorResources"
 	"github.com/NorskHelsenett/ror-agent/internal/services/authservice"
 
@@ -11,34 +13,76 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-func SendResource(action apiresourcecontracts.ResourceAction, input *unstructured.Unstructured) {
+// ResourceCacheInterface is the part of the resource cache used by the dynamic watchers.
+type ResourceCacheInterface interface {
+	SendResource(ctx context.Context, action apiresourcecontracts.ResourceAction, input *unstructured.Unstructured)
+}
+
+// SendResource sends a resource event from a watcher to ror-api, it is safe for concurrent use.
+func (rc *ResourceCache) SendResource(ctx context.Context, action apiresourcecontracts.ResourceAction, input *unstructured.Unstructured) {
 	resource, err := rorResources.NewFromUnstructured(input)
-	resourceReturn := resource.NewResourceUpdateModel(authservice.CreateOwnerref(), action)
 	if err != nil {
 		return
 	}
+	rc.sendResourceUpdate(ctx, resource.NewResourceUpdateModel(authservice.CreateOwnerref(), action))
+}
 
-	if action != apiresourcecontracts.K8sActionDelete {
-		if ResourceCache.CleanupRunning() {
-			ResourceCache.MarkActive(resourceReturn.Uid)
+func (rc *ResourceCache) sendResourceUpdate(ctx context.Context, resourceReturn *apiresourcecontracts.ResourceUpdateModel) {
+	uid := resourceReturn.Uid
+	rc.mu.Lock()
+	if resourceReturn.Action == apiresourcecontracts.K8sActionDelete {
+		rc.removeKey(uid)
+	} else {
+		rc.addKey(uid)
+		if rc.cleanupRunning {
+			rc.HashList.MarkActive(uid)
 		}
-		needUpdate := ResourceCache.HashList.CheckUpdateNeeded(resourceReturn.Uid, resourceReturn.Hash)
-		if needUpdate {
-			err = ResourceCache.sendResourceUpdateToRor(resourceReturn)
-			if err != nil {
-				rlog.Error("error sending resource update to ror, added to retryque", err)
-				ResourceCache.Workqueue.Add(resourceReturn)
-				return
-			}
-			ResourceCache.HashList.UpdateHash(resourceReturn.Uid, resourceReturn.Hash)
-		}
-	} else if action == apiresourcecontracts.K8sActionDelete {
-		err := ResourceCache.sendResourceUpdateToRor(resourceReturn)
-		if err != nil {
-			rlog.Error("error sending resource update to ror, added to retryque", err)
-			ResourceCache.Workqueue.Add(resourceReturn)
+		if !rc.HashList.CheckUpdateNeeded(uid, resourceReturn.Hash) {
+			rc.mu.Unlock()
+			resourceUpdates.WithLabelValues(string(resourceReturn.Action), resultUnchanged).Inc()
 			return
 		}
 	}
+	if !rc.beginSend(uid) {
+		// an older update is being sent, queue this one so it replaces it once the send is done
+		rc.Workqueue.Add(resourceReturn)
+		rc.workqueueChanged()
+		rc.mu.Unlock()
+		return
+	}
+	// a queued update for the resource is older than this one and superseded by it
+	if rc.Workqueue.DeleteByUid(uid) {
+		rc.workqueueChanged()
+	}
+	rc.mu.Unlock()
 
+	rc.sendDone(resourceReturn, rc.sender.Send(ctx, resourceReturn))
+}
+
+// sendDone records the result of sending a resource update from a watcher.
+func (rc *ResourceCache) sendDone(resourceReturn *apiresourcecontracts.ResourceUpdateModel, err error) {
+	uid := resourceReturn.Uid
+	observeResourceUpdate(resourceReturn.Action, err)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.endSend(uid)
+	if err != nil {
+		rlog.Error("error sending resource update to ror, added to retryque", err)
+		// an update queued while sending is newer and replaces this one
+		queued, found := rc.Workqueue.GetByUid(uid)
+		if !found {
+			rc.Workqueue.Add(resourceReturn)
+			rc.workqueueChanged()
+		} else if resourceReturn.Action == apiresourcecontracts.K8sActionAdd && queued.ResourceUpdate.Action == apiresourcecontracts.K8sActionUpdate {
+			// ror-api has not seen the resource, the queued update is sent as an add
+			added := *queued.ResourceUpdate
+			added.Action = apiresourcecontracts.K8sActionAdd
+			queued.ResourceUpdate = &added
+			rc.Workqueue.AddObject(queued)
+		}
+		return
+	}
+	if resourceReturn.Action != apiresourcecontracts.K8sActionDelete {
+		rc.HashList.UpdateHash(uid, resourceReturn.Hash)
+	}
 }
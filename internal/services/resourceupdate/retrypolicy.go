@@ -0,0 +1,70 @@
+package resourceupdate
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+	"github.com/NorskHelsenett/ror-agent/internal/config"
+
+	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
+)
+
+// RetryPolicy decides when a queued resource update is retried and when it is given up on.
+type RetryPolicy struct {
+	// MaxRetries is the number of times an update rejected by ror-api (4xx) is retried before it is dead-lettered.
+	// Zero or less retries forever.
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func NewRetryPolicyFromConfig() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: rorconfig.GetInt(config.WorkqueueMaxRetriesEnv),
+		BaseDelay:  time.Duration(rorconfig.GetInt(config.WorkqueueBackoffBaseSecondsEnv)) * time.Second,
+		MaxDelay:   time.Duration(rorconfig.GetInt(config.WorkqueueBackoffMaxSecondsEnv)) * time.Second,
+	}
+}
+
+// Backoff returns the delay before the next attempt after retryCount failed retries.
+func (p RetryPolicy) Backoff(retryCount int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 0; i < retryCount; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return delay
+}
+
+// IsDue reports whether the item should be attempted at the given time.
+// Items that have never been retried are always due.
+func (p RetryPolicy) IsDue(item ResourceCacheWorkqueueObject, now time.Time) bool {
+	if item.RetryCount == 0 {
+		return true
+	}
+	return !now.Before(item.SubmittedTime.Add(p.Backoff(item.RetryCount)))
+}
+
+// ShouldDeadLetter reports whether the item should be removed from the workqueue after failing with err.
+// Only updates rejected by ror-api are dead-lettered, server errors and unreachable api are retried forever.
+func (p RetryPolicy) ShouldDeadLetter(item ResourceCacheWorkqueueObject, err error) bool {
+	if p.MaxRetries <= 0 || !isClientError(err) {
+		return false
+	}
+	return item.RetryCount+1 >= p.MaxRetries
+}
+
+// isClientError reports whether ror-api rejected the request, excluding status codes that are worth retrying.
+func isClientError(err error) bool {
+	code := statuscode.FromError(err)
+	if code == http.StatusRequestTimeout || code == http.StatusTooManyRequests {
+		return false
+	}
+	return code >= 400 && code < 500
+}
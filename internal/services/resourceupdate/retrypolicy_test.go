@@ -0,0 +1,148 @@
+package resourceupdate
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/statuscode"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxRetries: 5,
+		BaseDelay:  10 * time.Second,
+		MaxDelay:   60 * time.Second,
+	}
+	tests := []struct {
+		name       string
+		retryCount int
+		want       time.Duration
+	}{
+		{name: "Test Backoff first retry", retryCount: 0, want: 10 * time.Second},
+		{name: "Test Backoff second retry", retryCount: 1, want: 20 * time.Second},
+		{name: "Test Backoff third retry", retryCount: 2, want: 40 * time.Second},
+		{name: "Test Backoff capped", retryCount: 3, want: 60 * time.Second},
+		{name: "Test Backoff capped many retries", retryCount: 100, want: 60 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Backoff(tt.retryCount); got != tt.want {
+				t.Errorf("RetryPolicy.Backoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_IsDue(t *testing.T) {
+	policy := RetryPolicy{
+		BaseDelay: 10 * time.Second,
+		MaxDelay:  60 * time.Second,
+	}
+	now := time.Now()
+	tests := []struct {
+		name string
+		item ResourceCacheWorkqueueObject
+		want bool
+	}{
+		{
+			name: "Test IsDue never retried",
+			item: ResourceCacheWorkqueueObject{SubmittedTime: now, RetryCount: 0},
+			want: true,
+		}, {
+			name: "Test IsDue backoff not expired",
+			item: ResourceCacheWorkqueueObject{SubmittedTime: now.Add(-15 * time.Second), RetryCount: 1},
+			want: false,
+		}, {
+			name: "Test IsDue backoff expired",
+			item: ResourceCacheWorkqueueObject{SubmittedTime: now.Add(-25 * time.Second), RetryCount: 1},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.IsDue(tt.item, now); got != tt.want {
+				t.Errorf("RetryPolicy.IsDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_ShouldDeadLetter(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3}
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		item   ResourceCacheWorkqueueObject
+		err    error
+		want   bool
+	}{
+		{
+			name:   "Test ShouldDeadLetter client error below max retries",
+			policy: policy,
+			item:   ResourceCacheWorkqueueObject{RetryCount: 1},
+			err:    statuscode.New(400, "request failed"),
+			want:   false,
+		}, {
+			name:   "Test ShouldDeadLetter client error at max retries",
+			policy: policy,
+			item:   ResourceCacheWorkqueueObject{RetryCount: 2},
+			err:    statuscode.New(400, "request failed"),
+			want:   true,
+		}, {
+			name:   "Test ShouldDeadLetter server error is retried forever",
+			policy: policy,
+			item:   ResourceCacheWorkqueueObject{RetryCount: 50},
+			err:    statuscode.New(503, "request failed"),
+			want:   false,
+		}, {
+			name:   "Test ShouldDeadLetter too many requests is retried forever",
+			policy: policy,
+			item:   ResourceCacheWorkqueueObject{RetryCount: 50},
+			err:    statuscode.New(429, "request failed"),
+			want:   false,
+		}, {
+			name:   "Test ShouldDeadLetter unreachable api is retried forever",
+			policy: policy,
+			item:   ResourceCacheWorkqueueObject{RetryCount: 50},
+			err:    errors.New("dial tcp: connection refused"),
+			want:   false,
+		}, {
+			name:   "Test ShouldDeadLetter disabled",
+			policy: RetryPolicy{MaxRetries: 0},
+			item:   ResourceCacheWorkqueueObject{RetryCount: 50},
+			err:    statuscode.New(400, "request failed"),
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.ShouldDeadLetter(tt.item, tt.err); got != tt.want {
+				t.Errorf("RetryPolicy.ShouldDeadLetter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceCacheDeadLetters_Add(t *testing.T) {
+	var deadLetters ResourceCacheDeadLetters
+	for i := 0; i < deadLetterMaxItems+10; i++ {
+		deadLetters.Add(ResourceCacheWorkqueueObject{
+			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+				Uid: fmt.Sprintf("uid-%d", i),
+			},
+		}, statuscode.New(400, "request failed"))
+	}
+	if deadLetters.ItemCount() != deadLetterMaxItems {
+		t.Errorf("ResourceCacheDeadLetters.ItemCount() = %d, want %d", deadLetters.ItemCount(), deadLetterMaxItems)
+	}
+	if got := deadLetters[0].ResourceUpdate.Uid; got != "uid-10" {
+		t.Errorf("oldest dead letter = %s, want uid-10", got)
+	}
+	if got := deadLetters[0].StatusCode; got != 400 {
+		t.Errorf("dead letter status code = %d, want 400", got)
+	}
+}
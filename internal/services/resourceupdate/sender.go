@@ -0,0 +1,54 @@
+package resourceupdate
+
+import (
+	"context"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
+
+	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+)
+
+// ResourceUpdateSender delivers a single resource update to ror-api.
+type ResourceUpdateSender interface {
+	Send(ctx context.Context, resourceUpdate *apiresourcecontracts.ResourceUpdateModel) error
+}
+
+type rorResourceUpdateSender struct {
+	client clusteragentclient.RorAgentClientInterface
+}
+
+func NewRorResourceUpdateSender(client clusteragentclient.RorAgentClientInterface) ResourceUpdateSender {
+	return &rorResourceUpdateSender{client: client}
+}
+
+// the function sends the resource to the ror api. If receiving a non 2xx statuscode it will retun an error.
+func (s *rorResourceUpdateSender) Send(ctx context.Context, resourceUpdate *apiresourcecontracts.ResourceUpdateModel) error {
+	rorClient := s.client.GetRorClient()
+	ctx, cancel := timeouts.RorApi(ctx)
+	defer cancel()
+	var err error
+	start := time.Now()
+
+	switch resourceUpdate.Action {
+	case apiresourcecontracts.K8sActionUpdate:
+		err = rorClient.V1().Resources().Update(ctx, resourceUpdate)
+		metricsservice.ObserveRorApiRequest("resources_update", start, err)
+	case apiresourcecontracts.K8sActionAdd:
+		err = rorClient.V1().Resources().Create(ctx, resourceUpdate)
+		metricsservice.ObserveRorApiRequest("resources_create", start, err)
+	case apiresourcecontracts.K8sActionDelete:
+		err = rorClient.V1().Resources().Delete(ctx, resourceUpdate.Uid)
+		metricsservice.ObserveRorApiRequest("resources_delete", start, err)
+	default:
+		rlog.Error("Not implemented", nil)
+
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
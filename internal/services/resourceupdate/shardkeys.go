@@ -0,0 +1,142 @@
+package resourceupdate
+
+import (
+	"context"
+	"time"
+
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
+
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+)
+
+// shardKeysPersistInterval is how often the keys of a shard are saved when they have changed
+const shardKeysPersistInterval = 30 * time.Second
+
+// The hashlist from ror-api holds every resource of the cluster, while a shard only sees the resources it watches.
+// When sharded the resource cache keeps the keys of its shard, the uids of the resources it has sent or found
+// unchanged, and the cleanup only removes inactive resources among them. The keys are persisted with the workqueue
+// when a backend is configured, so resources deleted while the agent was down are also removed after a restart.
+
+// persistedShardKeys are the keys of a shard as persisted, keys persisted by another shard or with another shard
+// count are ignored as the resources may now be watched by another shard.
+type persistedShardKeys struct {
+	Shard string   `json:"shard"`
+	Uids  []string `json:"uids"`
+}
+
+// shardKeysPersistence is implemented by the workqueue persistence backends able to store the keys of a shard.
+type shardKeysPersistence interface {
+	LoadShardKeys() (persistedShardKeys, error)
+	SaveShardKeys(keys persistedShardKeys) error
+}
+
+// setShard sets the shard watched by this replica, tracking its keys when sharded.
+func (rc *ResourceCache) setShard(shard sharding.Shard) {
+	rc.shard = shard
+	if shard.Enabled() {
+		rc.keys = make(map[string]struct{})
+	}
+}
+
+// addKey adds uid to the keys of the shard, must be called with mu held.
+func (rc *ResourceCache) addKey(uid string) {
+	if rc.keys == nil {
+		return
+	}
+	if _, ok := rc.keys[uid]; ok {
+		return
+	}
+	rc.keys[uid] = struct{}{}
+	rc.keysChanged = true
+}
+
+// removeKey removes uid from the keys of the shard, must be called with mu held.
+func (rc *ResourceCache) removeKey(uid string) {
+	if rc.keys == nil {
+		return
+	}
+	if _, ok := rc.keys[uid]; !ok {
+		return
+	}
+	delete(rc.keys, uid)
+	rc.keysChanged = true
+}
+
+// scopeToShard returns the uids among the keys of the shard, or every uid when not sharded. Must be called with mu held.
+func (rc *ResourceCache) scopeToShard(uids []string) []string {
+	if rc.keys == nil {
+		return uids
+	}
+	scoped := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		if _, ok := rc.keys[uid]; ok {
+			scoped = append(scoped, uid)
+		}
+	}
+	return scoped
+}
+
+// restoreShardKeys loads the keys persisted by a previous run of the same shard.
+func (rc *ResourceCache) restoreShardKeys() {
+	persistence, ok := rc.persistence.(shardKeysPersistence)
+	if rc.keys == nil || !ok {
+		return
+	}
+	persisted, err := persistence.LoadShardKeys()
+	if err != nil {
+		rlog.Error("could not load the persisted keys of the shard, resources removed while the agent was down stay in ror", err)
+		return
+	}
+	if persisted.Shard != rc.shard.String() {
+		if len(persisted.Uids) > 0 {
+			rlog.Warn("ignoring keys persisted by another shard, resources removed while the agent was down stay in ror", rlog.String("persisted", persisted.Shard), rlog.String("shard", rc.shard.String()))
+		}
+		return
+	}
+	rc.mu.Lock()
+	for _, uid := range persisted.Uids {
+		rc.keys[uid] = struct{}{}
+	}
+	rc.mu.Unlock()
+	rlog.Info("restored persisted keys of the shard", rlog.Int("keys", len(persisted.Uids)), rlog.String("shard", rc.shard.String()))
+}
+
+// runShardKeysPersister saves the keys of the shard every shardKeysPersistInterval if they have changed, until ctx is canceled.
+func (rc *ResourceCache) runShardKeysPersister(ctx context.Context) {
+	ticker := time.NewTicker(shardKeysPersistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rc.persistShardKeys()
+		}
+	}
+}
+
+// persistShardKeys saves the keys of the shard if they have changed since the last save.
+func (rc *ResourceCache) persistShardKeys() {
+	persistence, ok := rc.persistence.(shardKeysPersistence)
+	if !ok {
+		return
+	}
+	rc.mu.Lock()
+	if !rc.keysChanged {
+		rc.mu.Unlock()
+		return
+	}
+	keys := persistedShardKeys{Shard: rc.shard.String(), Uids: make([]string, 0, len(rc.keys))}
+	for uid := range rc.keys {
+		keys.Uids = append(keys.Uids, uid)
+	}
+	rc.keysChanged = false
+	rc.mu.Unlock()
+
+	if err := persistence.SaveShardKeys(keys); err != nil {
+		rlog.Error("could not persist the keys of the shard", err, rlog.Int("keys", len(keys.Uids)))
+		rc.mu.Lock()
+		rc.keysChanged = true
+		rc.mu.Unlock()
+	}
+}
@@ -1,6 +1,7 @@
 package resourceupdate
 
 import (
+	"container/list"
 	"time"
 
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
@@ -12,52 +13,128 @@ type ResourceCacheWorkqueueObject struct {
 	ResourceUpdate *apiresourcecontracts.ResourceUpdateModel
 }
 
-type ResourceCacheWorkqueue []ResourceCacheWorkqueueObject
+// ResourceCacheWorkqueue holds at most one pending update per uid in FIFO order.
+// Lookups, adds and deletes are O(1), the zero value is an empty workqueue ready to use.
+type ResourceCacheWorkqueue struct {
+	index map[string]*list.Element
+	order *list.List
+}
 
-func (wq ResourceCacheWorkqueue) NeedToRun() bool {
-	return len(wq) > 0
+// NewResourceCacheWorkqueue returns a workqueue containing the given items in order.
+func NewResourceCacheWorkqueue(items ...ResourceCacheWorkqueueObject) ResourceCacheWorkqueue {
+	var wq ResourceCacheWorkqueue
+	for _, item := range items {
+		wq.AddObject(item)
+	}
+	return wq
 }
-func (wq ResourceCacheWorkqueue) ItemCount() int {
-	return len(wq)
+
+func (wq *ResourceCacheWorkqueue) init() {
+	if wq.index == nil {
+		wq.index = make(map[string]*list.Element)
+		wq.order = list.New()
+	}
 }
 
-func (m ResourceCacheWorkqueue) GetByUid(uid string) (ResourceCacheWorkqueueObject, int) {
-	for i, resourceUpdate := range m {
-		if resourceUpdate.ResourceUpdate.Uid == uid {
-			return resourceUpdate, i
-		}
+func (wq *ResourceCacheWorkqueue) NeedToRun() bool {
+	return wq.ItemCount() > 0
+}
+func (wq *ResourceCacheWorkqueue) ItemCount() int {
+	return len(wq.index)
+}
+
+// GetByUid returns the queued item for the uid and whether it was found.
+func (wq *ResourceCacheWorkqueue) GetByUid(uid string) (ResourceCacheWorkqueueObject, bool) {
+	element, ok := wq.index[uid]
+	if !ok {
+		return ResourceCacheWorkqueueObject{}, false
 	}
-	var emptyResponse ResourceCacheWorkqueueObject
-	return emptyResponse, 0
+	return *element.Value.(*ResourceCacheWorkqueueObject), true
 }
-func (m *ResourceCacheWorkqueue) Add(resourceUpdate *apiresourcecontracts.ResourceUpdateModel) {
 
-	resourceUpdateObject := ResourceCacheWorkqueueObject{
+// Add queues the resource update. If the uid is already queued the update replaces the queued one
+// in its current position, keeping the retry count and backoff of the queued item.
+// An update replacing a queued add is queued as an add, ror-api has not seen the resource yet.
+func (wq *ResourceCacheWorkqueue) Add(resourceUpdate *apiresourcecontracts.ResourceUpdateModel) {
+	if resourceUpdate == nil {
+		return
+	}
+	if element, ok := wq.index[resourceUpdate.Uid]; ok {
+		item := element.Value.(*ResourceCacheWorkqueueObject)
+		if item.ResourceUpdate.Action == apiresourcecontracts.K8sActionAdd && resourceUpdate.Action == apiresourcecontracts.K8sActionUpdate {
+			added := *resourceUpdate
+			added.Action = apiresourcecontracts.K8sActionAdd
+			resourceUpdate = &added
+		}
+		item.ResourceUpdate = resourceUpdate
+		return
+	}
+	wq.AddObject(ResourceCacheWorkqueueObject{
 		SubmittedTime:  time.Now(),
 		RetryCount:     0,
 		ResourceUpdate: resourceUpdate,
+	})
+}
+
+// AddObject queues the item as is, replacing any queued item for the same uid in its current position.
+func (wq *ResourceCacheWorkqueue) AddObject(item ResourceCacheWorkqueueObject) {
+	if item.ResourceUpdate == nil {
+		return
 	}
+	wq.init()
+	if element, ok := wq.index[item.ResourceUpdate.Uid]; ok {
+		*element.Value.(*ResourceCacheWorkqueueObject) = item
+		return
+	}
+	wq.index[item.ResourceUpdate.Uid] = wq.order.PushBack(&item)
+}
 
-	cacheResource, currentId := m.GetByUid(resourceUpdate.Uid)
-	if currentId > 0 {
-		resourceUpdateObject.RetryCount = cacheResource.RetryCount + 1
-		(*m)[currentId] = resourceUpdateObject
-	} else {
-		*m = append(*m, resourceUpdateObject)
+// Retry increases the retry count of the queued item and restarts its backoff. Returns false if the uid is not queued.
+func (wq *ResourceCacheWorkqueue) Retry(uid string) bool {
+	element, ok := wq.index[uid]
+	if !ok {
+		return false
 	}
+	item := element.Value.(*ResourceCacheWorkqueueObject)
+	item.RetryCount++
+	item.SubmittedTime = time.Now()
+	return true
 }
 
-func (m *ResourceCacheWorkqueue) DeleteByUid(uid string) {
-	if uid == "" {
-		return
+// DeleteByUid removes the queued item for the uid. Returns false if the uid is not queued.
+func (wq *ResourceCacheWorkqueue) DeleteByUid(uid string) bool {
+	element, ok := wq.index[uid]
+	if !ok {
+		return false
 	}
-	var newCache []ResourceCacheWorkqueueObject
+	wq.order.Remove(element)
+	delete(wq.index, uid)
+	return true
+}
 
-	_, id := m.GetByUid(uid)
-	for i, resourceUpdateCacheObject := range *m {
-		if i != id {
-			newCache = append(newCache, resourceUpdateCacheObject)
+// OldestSubmitted returns the earliest submitted time of the queued items, the zero time when the queue is empty.
+func (wq *ResourceCacheWorkqueue) OldestSubmitted() time.Time {
+	var oldest time.Time
+	if wq.order == nil {
+		return oldest
+	}
+	for element := wq.order.Front(); element != nil; element = element.Next() {
+		submitted := element.Value.(*ResourceCacheWorkqueueObject).SubmittedTime
+		if oldest.IsZero() || submitted.Before(oldest) {
+			oldest = submitted
 		}
 	}
-	*m = newCache
+	return oldest
+}
+
+// Items returns a copy of the queued items in FIFO order.
+func (wq *ResourceCacheWorkqueue) Items() []ResourceCacheWorkqueueObject {
+	if wq.order == nil {
+		return nil
+	}
+	items := make([]ResourceCacheWorkqueueObject, 0, wq.order.Len())
+	for element := wq.order.Front(); element != nil; element = element.Next() {
+		items = append(items, *element.Value.(*ResourceCacheWorkqueueObject))
+	}
+	return items
 }
@@ -36,12 +36,16 @@ func TestResourceCacheWorkqueue_ItemCount(t *testing.T) {
 	}{
 		{
 			name: "Test ItemCount",
-			wq:   workquevalues,
+			wq:   NewResourceCacheWorkqueue(workquevalues...),
 			want: 2,
 		}, {
 			name: "Test ItemCount empty que",
-			wq:   []ResourceCacheWorkqueueObject{},
+			wq:   ResourceCacheWorkqueue{},
 			want: 0,
+		}, {
+			name: "Test ItemCount duplicate uid",
+			wq:   NewResourceCacheWorkqueue(workquevalues[0], workquevalues[0]),
+			want: 1,
 		},
 	}
 	for _, tt := range tests {
@@ -82,19 +86,33 @@ func TestResourceCacheWorkqueue_GetByUid(t *testing.T) {
 		m     ResourceCacheWorkqueue
 		args  args
 		want  ResourceCacheWorkqueueObject
-		want1 int
+		want1 bool
 	}{
 		{
 			name: "Test GetByUid empty request",
-			m:    workquevalues,
+			m:    NewResourceCacheWorkqueue(workquevalues...),
 			args: args{
 				uid: "",
 			},
 			want:  ResourceCacheWorkqueueObject{},
-			want1: 0,
+			want1: false,
+		}, {
+			name: "Test GetByUid first item",
+			m:    NewResourceCacheWorkqueue(workquevalues...),
+			args: args{
+				uid: "3c99c410-3cdd-11ee-be56-0242ac120002",
+			},
+			want: ResourceCacheWorkqueueObject{
+				SubmittedTime: time1,
+				RetryCount:    0,
+				ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+					Uid: "3c99c410-3cdd-11ee-be56-0242ac120002",
+				},
+			},
+			want1: true,
 		}, {
 			name: "Test GetByUid",
-			m:    workquevalues,
+			m:    NewResourceCacheWorkqueue(workquevalues...),
 			args: args{
 				uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
 			},
@@ -105,15 +123,23 @@ func TestResourceCacheWorkqueue_GetByUid(t *testing.T) {
 					Uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
 				},
 			},
-			want1: 1,
+			want1: true,
 		}, {
 			name: "Test GetByUid Nonexistent uid",
-			m:    workquevalues,
+			m:    NewResourceCacheWorkqueue(workquevalues...),
 			args: args{
 				uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
 			},
 			want:  ResourceCacheWorkqueueObject{},
-			want1: 0,
+			want1: false,
+		}, {
+			name: "Test GetByUid empty que",
+			m:    ResourceCacheWorkqueue{},
+			args: args{
+				uid: "3c99c410-3cdd-11ee-be56-0242ac120002",
+			},
+			want:  ResourceCacheWorkqueueObject{},
+			want1: false,
 		},
 	}
 	for _, tt := range tests {
@@ -134,13 +160,10 @@ func TestResourceCacheWorkqueue_Add(t *testing.T) {
 		resourceUpdate *apiresourcecontracts.ResourceUpdateModel
 	}
 
-	testresourceUpdate := &apiresourcecontracts.ResourceUpdateModel{
-		Uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
-	}
 	time1 := time.Now().Add(time.Hour)
 	time2 := time.Now().Add(time.Hour * 2)
 
-	var testworkque ResourceCacheWorkqueue = []ResourceCacheWorkqueueObject{
+	testworkque := []ResourceCacheWorkqueueObject{
 		{
 			SubmittedTime: time1,
 			RetryCount:    0,
@@ -150,159 +173,251 @@ func TestResourceCacheWorkqueue_Add(t *testing.T) {
 		},
 		{
 			SubmittedTime: time2,
-			RetryCount:    0,
+			RetryCount:    2,
 			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
 				Uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
 			},
 		},
 	}
 
-	var testworkqueadded ResourceCacheWorkqueue = []ResourceCacheWorkqueueObject{
-		{
-			SubmittedTime: time1,
-			RetryCount:    0,
-			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
-				Uid: "3c99c410-3cdd-11ee-be56-0242ac120002",
-			},
-		},
-		{
-			SubmittedTime: time2,
-			RetryCount:    1,
-			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
-				Uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
-			},
-		},
-	}
-	var testworkqueadded2 ResourceCacheWorkqueue = []ResourceCacheWorkqueueObject{
-		{
-			SubmittedTime: time1,
-			RetryCount:    0,
-			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
-				Uid: "3c99c410-3cdd-11ee-be56-0242ac120002",
-			},
-		},
-		{
-			SubmittedTime: time2,
-			RetryCount:    1,
-			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
-				Uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
-			},
-		}, {
-			SubmittedTime: time2,
-			RetryCount:    0,
-			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
-				Uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
-			},
-		},
-	}
 	tests := []struct {
 		name string
-		m    *ResourceCacheWorkqueue
+		m    ResourceCacheWorkqueue
 		args args
-		want *ResourceCacheWorkqueue
+		want []ResourceCacheWorkqueueObject
 	}{
 		{
 			name: "Test Add existing uid",
-			m:    &testworkque,
+			m:    NewResourceCacheWorkqueue(testworkque...),
+			args: args{
+				resourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+					Uid:  "3c99c410-3cdd-11ee-be56-0242ac120012",
+					Hash: "updated",
+				},
+			},
+			want: []ResourceCacheWorkqueueObject{
+				testworkque[0],
+				{
+					SubmittedTime: time2,
+					RetryCount:    2,
+					ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+						Uid:  "3c99c410-3cdd-11ee-be56-0242ac120012",
+						Hash: "updated",
+					},
+				},
+			},
+		}, {
+			name: "Test Add existing uid first item",
+			m:    NewResourceCacheWorkqueue(testworkque...),
+			args: args{
+				resourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+					Uid:  "3c99c410-3cdd-11ee-be56-0242ac120002",
+					Hash: "updated",
+				},
+			},
+			want: []ResourceCacheWorkqueueObject{
+				{
+					SubmittedTime: time1,
+					RetryCount:    0,
+					ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+						Uid:  "3c99c410-3cdd-11ee-be56-0242ac120002",
+						Hash: "updated",
+					},
+				},
+				testworkque[1],
+			},
+		}, {
+			name: "Test Add update of a queued add",
+			m: NewResourceCacheWorkqueue(ResourceCacheWorkqueueObject{
+				SubmittedTime: time1,
+				ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+					Uid:    "3c99c410-3cdd-11ee-be56-0242ac120002",
+					Action: apiresourcecontracts.K8sActionAdd,
+				},
+			}),
 			args: args{
-				resourceUpdate: testresourceUpdate,
+				resourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+					Uid:    "3c99c410-3cdd-11ee-be56-0242ac120002",
+					Action: apiresourcecontracts.K8sActionUpdate,
+					Hash:   "updated",
+				},
+			},
+			want: []ResourceCacheWorkqueueObject{
+				{
+					SubmittedTime: time1,
+					ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+						Uid:    "3c99c410-3cdd-11ee-be56-0242ac120002",
+						Action: apiresourcecontracts.K8sActionAdd,
+						Hash:   "updated",
+					},
+				},
 			},
-			want: &testworkqueadded,
 		}, {
 			name: "Test Add new uid",
-			m:    &testworkque,
+			m:    NewResourceCacheWorkqueue(testworkque...),
 			args: args{
 				resourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
 					Uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
 				},
 			},
-			want: &testworkqueadded2,
+			want: []ResourceCacheWorkqueueObject{
+				testworkque[0],
+				testworkque[1],
+				{
+					RetryCount: 0,
+					ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+						Uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
+					},
+				},
+			},
+		}, {
+			name: "Test Add to empty que",
+			m:    ResourceCacheWorkqueue{},
+			args: args{
+				resourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+					Uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
+				},
+			},
+			want: []ResourceCacheWorkqueueObject{
+				{
+					RetryCount: 0,
+					ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+						Uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
+					},
+				},
+			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.m.Add(tt.args.resourceUpdate)
 			opts := cmpopts.IgnoreTypes(time.Now())
-			if !cmp.Equal(tt.m, tt.want, opts) {
-				t.Errorf("%s failed", tt.name)
+			if !cmp.Equal(tt.m.Items(), tt.want, opts) {
+				t.Errorf("%s failed: %s", tt.name, cmp.Diff(tt.want, tt.m.Items(), opts))
 			}
 		})
 	}
 }
 
+func TestResourceCacheWorkqueue_Retry(t *testing.T) {
+	wq := NewResourceCacheWorkqueue(ResourceCacheWorkqueueObject{
+		SubmittedTime: time.Now().Add(-time.Hour),
+		RetryCount:    1,
+		ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+			Uid: "3c99c410-3cdd-11ee-be56-0242ac120002",
+		},
+	})
+
+	if !wq.Retry("3c99c410-3cdd-11ee-be56-0242ac120002") {
+		t.Fatalf("ResourceCacheWorkqueue.Retry() = false, want true")
+	}
+	got, _ := wq.GetByUid("3c99c410-3cdd-11ee-be56-0242ac120002")
+	if got.RetryCount != 2 {
+		t.Errorf("ResourceCacheWorkqueue.Retry() retry count = %d, want 2", got.RetryCount)
+	}
+	if time.Since(got.SubmittedTime) > time.Minute {
+		t.Errorf("ResourceCacheWorkqueue.Retry() did not reset submitted time")
+	}
+	if wq.Retry("3c99c410-3cdd-11ee-be56-0242ac120022") {
+		t.Errorf("ResourceCacheWorkqueue.Retry() = true for nonexistent uid, want false")
+	}
+}
+
 func TestResourceCacheWorkqueue_DeleteByUid(t *testing.T) {
 	type args struct {
 		uid string
 	}
-	var testworkqueadded ResourceCacheWorkqueue = []ResourceCacheWorkqueueObject{
-		{
-			SubmittedTime: time.Now(),
-			RetryCount:    1,
-			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
-				Uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
-			},
+	item1 := ResourceCacheWorkqueueObject{
+		SubmittedTime: time.Now(),
+		RetryCount:    1,
+		ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+			Uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
 		},
 	}
-	var testworkqueadded2 ResourceCacheWorkqueue = []ResourceCacheWorkqueueObject{
-		{
-			SubmittedTime: time.Now(),
-			RetryCount:    1,
-			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
-				Uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
-			},
-		}, {
-			SubmittedTime: time.Now(),
-			RetryCount:    0,
-			ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
-				Uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
-			},
+	item2 := ResourceCacheWorkqueueObject{
+		SubmittedTime: time.Now(),
+		RetryCount:    0,
+		ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+			Uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
+		},
+	}
+	item3 := ResourceCacheWorkqueueObject{
+		SubmittedTime: time.Now(),
+		RetryCount:    0,
+		ResourceUpdate: &apiresourcecontracts.ResourceUpdateModel{
+			Uid: "3c99c410-3cdd-11ee-be56-0242ac120032",
 		},
 	}
-
-	var testworkqueempty ResourceCacheWorkqueue
 
 	tests := []struct {
-		name string
-		m    *ResourceCacheWorkqueue
-		args args
-		want *ResourceCacheWorkqueue
+		name      string
+		m         ResourceCacheWorkqueue
+		args      args
+		want      []ResourceCacheWorkqueueObject
+		wantFound bool
 	}{
 		{
 			name: "Test Remove uid",
-			m:    &testworkqueadded2,
+			m:    NewResourceCacheWorkqueue(item1, item2),
+			args: args{
+				uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
+			},
+			want:      []ResourceCacheWorkqueueObject{item1},
+			wantFound: true,
+		}, {
+			name: "Test Remove uid - keeps order",
+			m:    NewResourceCacheWorkqueue(item1, item2, item3),
 			args: args{
 				uid: "3c99c410-3cdd-11ee-be56-0242ac120022",
 			},
-			want: &testworkqueadded,
+			want:      []ResourceCacheWorkqueueObject{item1, item3},
+			wantFound: true,
 		}, {
 			name: "Test Remove uid - empty uid",
-			m:    &testworkqueadded,
+			m:    NewResourceCacheWorkqueue(item1),
 			args: args{
 				uid: "",
 			},
-			want: &testworkqueadded,
+			want:      []ResourceCacheWorkqueueObject{item1},
+			wantFound: false,
+		}, {
+			name: "Test Remove uid - nonexistent uid keeps first item",
+			m:    NewResourceCacheWorkqueue(item1, item2),
+			args: args{
+				uid: "3c99c410-3cdd-11ee-be56-0242ac120042",
+			},
+			want:      []ResourceCacheWorkqueueObject{item1, item2},
+			wantFound: false,
 		}, {
 			name: "Test Remove uid - remove last que item",
-			m:    &testworkqueadded,
+			m:    NewResourceCacheWorkqueue(item1),
 			args: args{
 				uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
 			},
-			want: &testworkqueempty,
+			want:      []ResourceCacheWorkqueueObject{},
+			wantFound: true,
 		}, {
 			name: "Test Remove uid - remove from empty que",
-			m:    &testworkqueempty,
+			m:    ResourceCacheWorkqueue{},
 			args: args{
 				uid: "3c99c410-3cdd-11ee-be56-0242ac120012",
 			},
-			want: &testworkqueempty,
+			want:      []ResourceCacheWorkqueueObject{},
+			wantFound: false,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.m.DeleteByUid(tt.args.uid)
-			if !cmp.Equal(tt.m, tt.want, cmpopts.IgnoreTypes(time.Now()), cmpopts.EquateEmpty()) {
+			found := tt.m.DeleteByUid(tt.args.uid)
+			if found != tt.wantFound {
+				t.Errorf("ResourceCacheWorkqueue.DeleteByUid() = %v, want %v", found, tt.wantFound)
+			}
+			if !cmp.Equal(tt.m.Items(), tt.want, cmpopts.IgnoreTypes(time.Now()), cmpopts.EquateEmpty()) {
 				t.Errorf("%s failed", tt.name)
 			}
+			if tt.m.ItemCount() != len(tt.want) {
+				t.Errorf("ResourceCacheWorkqueue.ItemCount() = %d, want %d", tt.m.ItemCount(), len(tt.want))
+			}
 		})
 	}
 }
@@ -1,13 +1,22 @@
 package main
 
 import (
+	"context"
 	_ "net/http/pprof"
+	"os"
+	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/dynamicclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/redaction"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/sharding"
 	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/leaderelectionservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/lifecycleservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
 	"github.com/NorskHelsenett/ror-agent/common/pkg/services/pprofservice"
 	"github.com/NorskHelsenett/ror-agent/v2/internal/agentconfig"
+	"github.com/NorskHelsenett/ror-agent/v2/internal/flushingcache"
 	"github.com/NorskHelsenett/ror-agent/v2/internal/handlers/clusterhandler"
 	"github.com/NorskHelsenett/ror-agent/v2/internal/handlers/dynamicclienthandler"
 	"github.com/NorskHelsenett/ror-agent/v2/internal/scheduler"
@@ -18,25 +27,58 @@ import (
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 )
 
+// resourceCacheInterval is the work queue interval of the resource cache in seconds
+const resourceCacheInterval = 10
+
 func main() {
 	agentconfig.Init()
+	lifecycle := lifecycleservice.NewLifecycleFromConfig()
 
 	pprofservice.MayStartPprof()
+	metricsservice.MayStartMetricsServer()
 
 	rlog.Info("Agent is starting", rlog.String("version", rorversion.GetRorVersion().GetVersion()), rlog.String("commit", rorversion.GetRorVersion().GetCommit()))
 
 	rorClientInterface := clusteragentclient.MustInitNewRorAgentClient(clusteragentclient.GetDefaultRorAgentClientConfig())
+	rorClientInterface.WatchApiKeySecret(lifecycle.Context())
+
+	// started before the leader election so standby replicas answer the probes
+	healthservice.MustStart()
 
-	resourceCache := resourcecache.MustInitNewResourceCache(resourcecache.ResourceCacheConfig{WorkQueueInterval: 10, RorClient: rorClientInterface.GetRorClient()})
+	leaderelectionservice.MustRun(lifecycle, rorClientInterface, func(ctx context.Context, shard sharding.Shard) {
+		rorClient := rorClientInterface.GetRorClient()
+		resourceCache := flushingcache.New(
+			resourcecache.MustInitNewResourceCache(resourcecache.ResourceCacheConfig{WorkQueueInterval: resourceCacheInterval, RorClient: rorClient}),
+			rorClient,
+			2*resourceCacheInterval*time.Second,
+		)
 
-	clusterhandler.MustStart(rorClientInterface, resourceCache)
+		// the cluster resource and the scheduled reports cover the whole cluster, they are only sent by the first shard
+		if shard.Primary() {
+			clusterhandler.MustStart(ctx, rorClientInterface, resourceCache)
+		}
 
-	dynamicclient.MustStart(rorClientInterface, dynamicclienthandler.NewDynamicClientHandler(resourceCache))
+		watchers := dynamicclient.MustStartShard(ctx, rorClientInterface, dynamicclienthandler.NewDynamicClientHandler(resourceCache, redaction.MustNewRedactorFromConfig()), shard)
 
-	scheduler.SetUpScheduler(rorClientInterface)
+		lifecycle.OnShutdown("watchers", func(context.Context) error {
+			watchers.Stop()
+			return nil
+		})
+		// the resources added within the last work queue intervals may still be queued in the resource cache, deletes
+		// still queued are caught up by its cleanup after the restart
+		lifecycle.OnShutdown("resourcecache", resourceCache.Flush)
 
-	healthservice.MustStart()
+		if !shard.Primary() {
+			return
+		}
+		// registering the agent again writes the api key secret, so the api key is only checked by the first shard
+		rorClientInterface.StartApiKeyCheck(ctx)
+		agentScheduler := scheduler.SetUpScheduler(ctx, rorClientInterface)
+		lifecycle.OnShutdown("scheduler", func(context.Context) error {
+			agentScheduler.Stop()
+			return nil
+		})
+	})
 
-	<-rorClientInterface.GetStopChan()
-	rlog.Info("Shutting down...")
+	os.Exit(lifecycle.Wait(rorClientInterface.GetSigs()))
 }
@@ -134,3 +134,6 @@ require (
 	sigs.k8s.io/structured-merge-diff/v6 v6.4.0 // indirect
 	sigs.k8s.io/yaml v1.6.0 // indirect
 )
+
+// common is developed in this repository, use it from the tree until a new version is tagged
+replace github.com/NorskHelsenett/ror-agent/common => ../common
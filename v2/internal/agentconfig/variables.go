@@ -39,7 +39,37 @@ func Init() {
 
 	rorconfig.SetDefault(configconsts.ENABLE_PPROF, false)
 	rorconfig.SetDefault(agentconsts.DynamicWatchNoCacheEnv, true)
+	rorconfig.SetDefault(agentconsts.DynamicWatchListEnv, true)
+	rorconfig.SetDefault(agentconsts.DynamicWatchListTimeoutSecondsEnv, 60)
+	rorconfig.SetDefault(agentconsts.DynamicWatchWorkersEnv, 4)
+	rorconfig.SetDefault(agentconsts.DynamicWatchQPSEnv, 50)
+	rorconfig.SetDefault(agentconsts.DynamicWatchBurstEnv, 200)
 	rorconfig.SetDefault(agentconsts.ForceGCAfterInitialListEnv, true)
+	rorconfig.SetDefault(agentconsts.AgentHealthEndpointEnv, ":9999")
+	rorconfig.SetDefault(agentconsts.MetricsEndpointEnv, ":9997")
+	rorconfig.SetDefault(agentconsts.DryRunEnv, false)
+	rorconfig.SetDefault(agentconsts.DryRunOutputEnv, "stdout")
+	rorconfig.SetDefault(agentconsts.RedactDropFieldsEnv, "")
+	rorconfig.SetDefault(agentconsts.RedactMaskFieldsEnv, "")
+	rorconfig.SetDefault(agentconsts.RedactAnnotationsEnv, "")
+	rorconfig.SetDefault(agentconsts.WatchConfigFileEnv, "")
+	rorconfig.SetDefault(agentconsts.WatchConfigMapEnv, "")
+	rorconfig.SetDefault(agentconsts.DiscoveryPollIntervalSecondsEnv, 60)
+	rorconfig.SetDefault(agentconsts.ShutdownTimeoutSecondsEnv, 25)
+	rorconfig.SetDefault(agentconsts.RorApiTimeoutSecondsEnv, 30)
+	rorconfig.SetDefault(agentconsts.KubernetesTimeoutSecondsEnv, 30)
+	rorconfig.SetDefault(agentconsts.HealthWatchMaxIdleSecondsEnv, 900)
+	rorconfig.SetDefault(agentconsts.HealthMaxReportAgeSecondsEnv, 600)
+	rorconfig.SetDefault(agentconsts.LeaderElectionEnv, false)
+	rorconfig.SetDefault(agentconsts.LeaderElectionLeaseNameEnv, "ror-agent-v2")
+	rorconfig.SetDefault(agentconsts.LeaderElectionLeaseDurationSecondsEnv, 15)
+	rorconfig.SetDefault(agentconsts.LeaderElectionRenewDeadlineSecondsEnv, 10)
+	rorconfig.SetDefault(agentconsts.LeaderElectionRetryPeriodSecondsEnv, 2)
+	rorconfig.SetDefault(agentconsts.ShardCountEnv, 1)
+	rorconfig.SetDefault(agentconsts.ShardModeEnv, "resources")
+	rorconfig.SetDefault(agentconsts.ShardIndexEnv, -1)
+	rorconfig.SetDefault(agentconsts.ApiKeyCheckIntervalSecondsEnv, 60)
+	rorconfig.SetDefault(agentconsts.ApiKeyReregisterAfterEnv, 5)
 
 	rorconfig.AutomaticEnv()
 
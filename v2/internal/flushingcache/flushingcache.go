@@ -0,0 +1,93 @@
+// Package flushingcache wraps the resource cache of ror so it can be flushed at shutdown. The resource cache sends
+// the resources added to it every work queue interval and can not be flushed, the resources added within the last
+// intervals are sent again at shutdown. Sending a resource twice is harmless as ror-api stores its latest state.
+package flushingcache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/rorclient"
+	"github.com/NorskHelsenett/ror/pkg/helpers/resourcecache"
+	"github.com/NorskHelsenett/ror/pkg/rlog"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+)
+
+// Cache is a resource cache remembering the resources added to it within the retention, they may still be
+// waiting in the resource cache.
+type Cache struct {
+	resourcecache.ResourceCacheInterface
+	rorClient rorclient.RorClientInterface
+	retention time.Duration
+	now       func() time.Time
+
+	mu sync.Mutex
+	// recent holds the resources in the order they were last added, indexed by uid
+	recent *list.List
+	index  map[string]*list.Element
+}
+
+type recentResource struct {
+	resource *rorresources.Resource
+	added    time.Time
+}
+
+// New returns cache remembering the resources added within retention, which should cover the work queue
+// interval of cache and the time it takes to send them.
+func New(cache resourcecache.ResourceCacheInterface, rorClient rorclient.RorClientInterface, retention time.Duration) *Cache {
+	return &Cache{
+		ResourceCacheInterface: cache,
+		rorClient:              rorClient,
+		retention:              retention,
+		now:                    time.Now,
+		recent:                 list.New(),
+		index:                  make(map[string]*list.Element),
+	}
+}
+
+// AddResource adds the resource to the resource cache and remembers it for Flush.
+func (c *Cache) AddResource(resource *rorresources.Resource) {
+	c.ResourceCacheInterface.AddResource(resource)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	uid := resource.GetUID()
+	if element, ok := c.index[uid]; ok {
+		c.recent.Remove(element)
+	}
+	c.index[uid] = c.recent.PushBack(&recentResource{resource: resource, added: now})
+	c.expire(now)
+}
+
+// expire forgets the resources added before the retention. Must be called with mu held.
+func (c *Cache) expire(now time.Time) {
+	for element := c.recent.Front(); element != nil; element = c.recent.Front() {
+		recent := element.Value.(*recentResource)
+		if now.Sub(recent.added) <= c.retention {
+			return
+		}
+		c.recent.Remove(element)
+		delete(c.index, recent.resource.GetUID())
+	}
+}
+
+// Flush sends the resources added within the retention to ror-api in a single resource set using ctx.
+func (c *Cache) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	c.expire(c.now())
+	resourceSet := rorresources.NewResourceSet()
+	for element := c.recent.Front(); element != nil; element = element.Next() {
+		resourceSet.Add(element.Value.(*recentResource).resource)
+	}
+	c.mu.Unlock()
+	if len(resourceSet.Resources) == 0 {
+		return nil
+	}
+
+	rlog.Info("flushing the resource cache", rlog.Int("resources", len(resourceSet.Resources)))
+	_, err := c.rorClient.V2().Resources().Update(ctx, resourceSet)
+	return err
+}
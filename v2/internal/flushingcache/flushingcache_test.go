@@ -0,0 +1,83 @@
+package flushingcache
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/NorskHelsenett/ror/pkg/clients/rorclient"
+	"github.com/NorskHelsenett/ror/pkg/helpers/resourcecache"
+	"github.com/NorskHelsenett/ror/pkg/rorresources"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// fakeResourceCache records the uids of the resources added.
+type fakeResourceCache struct {
+	resourcecache.ResourceCacheInterface
+	added []string
+}
+
+func (c *fakeResourceCache) AddResource(resource *rorresources.Resource) {
+	c.added = append(c.added, resource.GetUID())
+}
+
+// fakeRorClient records the uids of the resource sets sent.
+type fakeRorClient struct {
+	rorclient.RorClientInterface
+	rorclient.V2Client
+	rorclient.V2ResourcesInterface
+	sent [][]string
+}
+
+func (c *fakeRorClient) V2() rorclient.V2Client                    { return c }
+func (c *fakeRorClient) Resources() rorclient.V2ResourcesInterface { return c }
+
+func (c *fakeRorClient) Update(_ context.Context, resourceSet *rorresources.ResourceSet) (*rorresources.ResourceUpdateResults, error) {
+	var uids []string
+	for _, resource := range resourceSet.Resources {
+		uids = append(uids, resource.GetUID())
+	}
+	c.sent = append(c.sent, uids)
+	return &rorresources.ResourceUpdateResults{}, nil
+}
+
+func newResource(uid string) *rorresources.Resource {
+	resource := &rorresources.Resource{}
+	resource.Metadata.UID = types.UID(uid)
+	return resource
+}
+
+func TestCache_Flush(t *testing.T) {
+	resourceCache := &fakeResourceCache{}
+	rorClient := &fakeRorClient{}
+	cache := New(resourceCache, rorClient, 20*time.Second)
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	cache.AddResource(newResource("a"))
+	cache.AddResource(newResource("b"))
+	now = now.Add(15 * time.Second)
+	cache.AddResource(newResource("c"))
+	// added again, it is sent once with its latest state
+	cache.AddResource(newResource("a"))
+	now = now.Add(10 * time.Second)
+
+	if err := cache.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c", "a"}; !slices.Equal(resourceCache.added, want) {
+		t.Errorf("added %v to the resource cache, want %v", resourceCache.added, want)
+	}
+	if want := [][]string{{"c", "a"}}; len(rorClient.sent) != 1 || !slices.Equal(rorClient.sent[0], want[0]) {
+		t.Errorf("flushed %v, want %v", rorClient.sent, want)
+	}
+
+	now = now.Add(time.Minute)
+	if err := cache.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rorClient.sent) != 1 {
+		t.Errorf("flushed %v, want nothing sent once the retention has passed", rorClient.sent)
+	}
+}
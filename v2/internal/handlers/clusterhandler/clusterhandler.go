@@ -6,6 +6,10 @@ import (
 	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/healthservice"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/services/metricsservice"
 	"github.com/NorskHelsenett/ror/pkg/config/configconsts"
 	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
 	"github.com/NorskHelsenett/ror/pkg/config/rorversion"
@@ -23,26 +27,36 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 )
 
-func MustStart(agentclient clusteragentclient.RorAgentClientInterface, resourceCacheInterface resourcecache.ResourceCacheInterface) {
-	err := Start(agentclient, resourceCacheInterface)
+func MustStart(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface, resourceCacheInterface resourcecache.ResourceCacheInterface) {
+	err := Start(ctx, agentclient, resourceCacheInterface)
 	if err != nil {
 		rlog.Fatal("could not start cluster handler", err)
 	}
 }
 
-func Start(agentclient clusteragentclient.RorAgentClientInterface, resourceCacheInterface resourcecache.ResourceCacheInterface) error {
+// Start registers the cluster resource and updates it every minute until ctx is canceled.
+func Start(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface, resourceCacheInterface resourcecache.ResourceCacheInterface) error {
 	rlog.Info("Starting cluster handler", rlog.String("clusterid", agentclient.GetClusterId()))
 
-	if err := updateClusterResource(agentclient, resourceCacheInterface); err != nil {
+	healthservice.RegisterLastSuccessCheck(clusterHandlerTask, time.Duration(rorconfig.GetInt(agentconsts.HealthMaxReportAgeSecondsEnv))*time.Second)
+	if err := updateClusterResource(ctx, agentclient, resourceCacheInterface); err != nil {
 		return err
 	}
+	recordSuccess()
 
 	go func() {
 		ticker := time.NewTicker(1 * time.Minute)
 		defer ticker.Stop()
-		for range ticker.C {
-			if err := updateClusterResource(agentclient, resourceCacheInterface); err != nil {
-				rlog.Error("error updating cluster resource", err)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := updateClusterResource(ctx, agentclient, resourceCacheInterface); err != nil {
+					rlog.Error("error updating cluster resource", err)
+					continue
+				}
+				recordSuccess()
 			}
 		}
 	}()
@@ -50,12 +64,24 @@ func Start(agentclient clusteragentclient.RorAgentClientInterface, resourceCache
 	return nil
 }
 
-func updateClusterResource(agentclient clusteragentclient.RorAgentClientInterface, resourceCacheInterface resourcecache.ResourceCacheInterface) error {
+// clusterHandlerTask names the cluster resource updates in the health checks and metrics.
+const clusterHandlerTask = "clusterhandler"
+
+func recordSuccess() {
+	metricsservice.SetLastSuccess(clusterHandlerTask)
+	healthservice.RecordSuccess(clusterHandlerTask)
+}
+
+func updateClusterResource(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface, resourceCacheInterface resourcecache.ResourceCacheInterface) error {
 	// Get myself
-	existing, err := agentclient.GetRorClient().V2().Resources().Get(context.TODO(), rorresources.ResourceQuery{
+	getCtx, cancel := timeouts.RorApi(ctx)
+	start := time.Now()
+	existing, err := agentclient.GetRorClient().V2().Resources().Get(getCtx, rorresources.ResourceQuery{
 		VersionKind: rortypes.ResourceKubernetesClusterGVK,
 	},
 	)
+	metricsservice.ObserveRorApiRequest("resources_v2_get", start, err)
+	cancel()
 	if err != nil {
 		return fmt.Errorf("error fetching existing resources for cluster handler: %w", err)
 	}
@@ -110,7 +136,7 @@ func updateClusterResource(agentclient clusteragentclient.RorAgentClientInterfac
 	clusterresource.RorMeta.LastReported = time.Now().String()
 	clusterresource.Metadata.Name = agentclient.GetClusterId()
 
-	hintsData := getHintsConfigMap(agentclient)
+	hintsData := getHintsConfigMap(ctx, agentclient)
 
 	if needsFullUpdate {
 		clusterresource.KubernetesClusterResource.Status.AgentStatus = rortypes.KubernetesClusterAgentStatus{
@@ -124,17 +150,17 @@ func updateClusterResource(agentclient clusteragentclient.RorAgentClientInterfac
 			Datacenter:         agentclient.GetDatacenter(),
 			Environment:        getEnvironment(agentclient, hintsData),
 			Versions:           getVersions(hintsData),
-			Nodes:              getNodes(agentclient),
+			Nodes:              getNodes(ctx, agentclient),
 			Endpoint:           getEndpoints(agentclient),
 			LastSeen:           time.Now(),
-			CreatedAt:          getCreatedTime(agentclient),
-			Urls:               getUrls(agentclient),
+			CreatedAt:          getCreatedTime(ctx, agentclient),
+			Urls:               getUrls(ctx, agentclient),
 		}
 	} else {
 		clusterresource.KubernetesClusterResource.Status.AgentStatus.LastSeen = time.Now()
 		clusterresource.KubernetesClusterResource.Status.AgentStatus.Versions = getVersions(hintsData)
-		clusterresource.KubernetesClusterResource.Status.AgentStatus.Urls = getUrls(agentclient)
-		clusterresource.KubernetesClusterResource.Status.AgentStatus.Nodes = getNodes(agentclient)
+		clusterresource.KubernetesClusterResource.Status.AgentStatus.Urls = getUrls(ctx, agentclient)
+		clusterresource.KubernetesClusterResource.Status.AgentStatus.Nodes = getNodes(ctx, agentclient)
 	}
 
 	//stringhelper.PrettyprintStruct(clusterresource)
@@ -148,7 +174,11 @@ func updateClusterResource(agentclient clusteragentclient.RorAgentClientInterfac
 	if len(existing.Resources) == 0 {
 		rs := rorresources.NewResourceSet()
 		rs.Add(clusterresource)
-		_, err := agentclient.GetRorClient().V2().Resources().Update(context.TODO(), rs)
+		updateCtx, cancel := timeouts.RorApi(ctx)
+		start := time.Now()
+		_, err := agentclient.GetRorClient().V2().Resources().Update(updateCtx, rs)
+		metricsservice.ObserveRorApiRequest("resources_v2_update", start, err)
+		cancel()
 		if err != nil {
 			return fmt.Errorf("failed to synchronously register KubernetesCluster resource: %w", err)
 		}
@@ -169,11 +199,11 @@ func getEndpoints(agentclient clusteragentclient.RorAgentClientInterface) rortyp
 	}
 }
 
-func getUrls(agentclient clusteragentclient.RorAgentClientInterface) map[string]string {
+func getUrls(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface) map[string]string {
 	hasIngress, hasHTTPRoute := discoverRouteAPIs(agentclient)
 	return map[string]string{
-		"Argocd":  getUrl(agentclient, "argocd", "argocd-server", hasIngress, hasHTTPRoute),
-		"Grafana": getUrl(agentclient, "prometheus-operator", "grafana-helsenett", hasIngress, hasHTTPRoute),
+		"Argocd":  getUrl(ctx, agentclient, "argocd", "argocd-server", hasIngress, hasHTTPRoute),
+		"Grafana": getUrl(ctx, agentclient, "prometheus-operator", "grafana-helsenett", hasIngress, hasHTTPRoute),
 	}
 }
 
@@ -206,26 +236,28 @@ func discoverRouteAPIs(agentclient clusteragentclient.RorAgentClientInterface) (
 	return hasIngress, hasHTTPRoute
 }
 
-func getUrl(agentclient clusteragentclient.RorAgentClientInterface, namespace string, name string, hasIngress bool, hasHTTPRoute bool) string {
+func getUrl(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface, namespace string, name string, hasIngress bool, hasHTTPRoute bool) string {
 	if hasIngress {
-		if url := getUrlFromIngress(agentclient, namespace, name); url != "" {
+		if url := getUrlFromIngress(ctx, agentclient, namespace, name); url != "" {
 			return url
 		}
 	}
 	if hasHTTPRoute {
-		if url := getUrlFromHTTPRoute(agentclient, namespace, name); url != "" {
+		if url := getUrlFromHTTPRoute(ctx, agentclient, namespace, name); url != "" {
 			return url
 		}
 	}
 	return ""
 }
 
-func getUrlFromIngress(agentclient clusteragentclient.RorAgentClientInterface, namespace string, name string) string {
+func getUrlFromIngress(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface, namespace string, name string) string {
 	client, err := agentclient.GetKubernetesClientset().GetKubernetesClientset()
 	if err != nil {
 		return ""
 	}
-	ingress, err := client.NetworkingV1().Ingresses(namespace).Get(context.TODO(), name, v1.GetOptions{})
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
+	ingress, err := client.NetworkingV1().Ingresses(namespace).Get(ctx, name, v1.GetOptions{})
 	if err != nil {
 		return ""
 	}
@@ -244,7 +276,7 @@ func getUrlFromIngress(agentclient clusteragentclient.RorAgentClientInterface, n
 	return ""
 }
 
-func getUrlFromHTTPRoute(agentclient clusteragentclient.RorAgentClientInterface, namespace string, name string) string {
+func getUrlFromHTTPRoute(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface, namespace string, name string) string {
 	dynClient, err := agentclient.GetKubernetesClientset().GetDynamicClient()
 	if err != nil {
 		return ""
@@ -254,7 +286,9 @@ func getUrlFromHTTPRoute(agentclient clusteragentclient.RorAgentClientInterface,
 		Version:  "v1",
 		Resource: "httproutes",
 	}
-	route, err := dynClient.Resource(gvr).Namespace(namespace).Get(context.TODO(), name, v1.GetOptions{})
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
+	route, err := dynClient.Resource(gvr).Namespace(namespace).Get(ctx, name, v1.GetOptions{})
 	if err != nil {
 		return ""
 	}
@@ -265,14 +299,16 @@ func getUrlFromHTTPRoute(agentclient clusteragentclient.RorAgentClientInterface,
 	return "https://" + hostnames[0]
 }
 
-func getCreatedTime(agentclient clusteragentclient.RorAgentClientInterface) time.Time {
+func getCreatedTime(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface) time.Time {
 	// get the kube-system namespace creation time, as a proxy for cluster creation time, as the agent will be deployed shortly after cluster creation
 	client, err := agentclient.GetKubernetesClientset().GetKubernetesClientset()
 	if err != nil {
 		rlog.Warn("could not get kubernetes clientset to get cluster creation time")
 		return time.Time{}
 	}
-	namespace, err := client.CoreV1().Namespaces().Get(context.TODO(), "kube-system", v1.GetOptions{})
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
+	namespace, err := client.CoreV1().Namespaces().Get(ctx, "kube-system", v1.GetOptions{})
 	if err != nil {
 		rlog.Warn("could not get kube-system namespace to get cluster creation time")
 		return time.Time{}
@@ -287,11 +323,11 @@ func getVersions(hintsData map[string]string) map[string]string {
 	}
 }
 
-func getNodes(agentclient clusteragentclient.RorAgentClientInterface) rortypes.KubernetesClusterAgentStatusNodes {
+func getNodes(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface) rortypes.KubernetesClusterAgentStatusNodes {
 	interregator := agentclient.GetClusterInterregator()
 	nodes := interregator.Nodes().Get()
 
-	nodeMetricsMap := getNodeMetricsMap(agentclient)
+	nodeMetricsMap := getNodeMetricsMap(ctx, agentclient)
 
 	nodepoolMap := make(map[string][]rortypes.KubernetesClusterAgentStatusNodesNodepoolsNodes)
 	var controlPlane []rortypes.KubernetesClusterAgentStatusNodesNodepoolsNodes
@@ -349,13 +385,15 @@ type nodeMetricsUsage struct {
 	memory rortypes.Quantity
 }
 
-func getNodeMetricsMap(agentclient clusteragentclient.RorAgentClientInterface) map[string]nodeMetricsUsage {
+func getNodeMetricsMap(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface) map[string]nodeMetricsUsage {
 	metricsClient, err := agentclient.GetKubernetesClientset().GetMetricsV1Beta1Client()
 	if err != nil {
 		rlog.Warn("could not get metrics client, node usage will not be reported")
 		return nil
 	}
-	nodeMetrics, err := metricsClient.NodeMetricses().List(context.TODO(), v1.ListOptions{})
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
+	nodeMetrics, err := metricsClient.NodeMetricses().List(ctx, v1.ListOptions{})
 	if err != nil {
 		rlog.Warn("could not list node metrics, node usage will not be reported")
 		return nil
@@ -392,13 +430,15 @@ func getEnvironment(agentclient clusteragentclient.RorAgentClientInterface, hint
 }
 
 // getHintsConfigMap fetches the nhn-tooling configmap, returning nil if unavailable.
-func getHintsConfigMap(agentclient clusteragentclient.RorAgentClientInterface) map[string]string {
+func getHintsConfigMap(ctx context.Context, agentclient clusteragentclient.RorAgentClientInterface) map[string]string {
 	client, err := agentclient.GetKubernetesClientset().GetKubernetesClientset()
 	if err != nil {
 		rlog.Warn("could not get kubernetes clientset to get configmap", rlog.String("configmap", hintsConfigmap))
 		return nil
 	}
-	cm, err := client.CoreV1().ConfigMaps(rorconfig.GetString(rorconfig.POD_NAMESPACE)).Get(context.TODO(), hintsConfigmap, v1.GetOptions{})
+	ctx, cancel := timeouts.Kubernetes(ctx)
+	defer cancel()
+	cm, err := client.CoreV1().ConfigMaps(rorconfig.GetString(rorconfig.POD_NAMESPACE)).Get(ctx, hintsConfigmap, v1.GetOptions{})
 	if err != nil {
 		rlog.Warn("could not get configmap", rlog.String("configmap", hintsConfigmap), rlog.String("namespace", rorconfig.GetString(rorconfig.POD_NAMESPACE)))
 		return nil
@@ -2,6 +2,7 @@ package dynamicclienthandler
 
 import (
 	"github.com/NorskHelsenett/ror-agent/common/pkg/controllers/dynamiccontroller"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/redaction"
 	"github.com/NorskHelsenett/ror/pkg/helpers/resourcecache"
 	"github.com/NorskHelsenett/ror/pkg/rlog"
 	"github.com/NorskHelsenett/ror/pkg/rorresources/rorkubernetes"
@@ -11,11 +12,13 @@ import (
 
 type dynamicClientHandler struct {
 	resourceCache resourcecache.ResourceCacheInterface
+	redactor      *redaction.Redactor
 }
 
-func NewDynamicClientHandler(resourceCache resourcecache.ResourceCacheInterface) *dynamicClientHandler {
+func NewDynamicClientHandler(resourceCache resourcecache.ResourceCacheInterface, redactor *redaction.Redactor) *dynamicClientHandler {
 	ret := dynamicClientHandler{
 		resourceCache: resourceCache,
+		redactor:      redactor,
 	}
 	return &ret
 }
@@ -29,7 +32,7 @@ func (h *dynamicClientHandler) GetHandlersForSchema(schema schema.GroupVersionRe
 }
 
 func (h *dynamicClientHandler) sendResource(action rortypes.ResourceAction, input map[string]interface{}) {
-	rorres := rorkubernetes.NewResourceFromMapInterface(input)
+	rorres := rorkubernetes.NewResourceFromMapInterface(h.redactor.Redact(input))
 	err := rorres.SetRorMeta(rortypes.ResourceRorMeta{
 		Version:  "v2",
 		Ownerref: h.resourceCache.GetOwnerref(),
@@ -35,10 +35,12 @@ func (h *schemaHandler) addResource(obj any) {
 }
 
 func (h *schemaHandler) deleteResource(obj any) {
-	if obj == nil {
-		return // Avoid memory leaks if obj is nil
+	// deletes not observed by the watcher only hold the type and uid of the object
+	deleted, ok := dynamiccontroller.DeletedObject(obj)
+	if !ok {
+		return
 	}
-	h.clientHandler.sendResource(rortypes.K8sActionDelete, obj.(*unstructured.Unstructured).Object)
+	h.clientHandler.sendResource(rortypes.K8sActionDelete, deleted.Object)
 	obj = nil // Clear the obj reference to avoid memory leaks
 
 }
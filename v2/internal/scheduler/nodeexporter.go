@@ -12,6 +12,7 @@ import (
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
 	"github.com/NorskHelsenett/ror-agent/common/pkg/config/agentconsts"
+	"github.com/NorskHelsenett/ror-agent/common/pkg/helpers/timeouts"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts"
 	"github.com/NorskHelsenett/ror/pkg/apicontracts/apiresourcecontracts"
 	"github.com/NorskHelsenett/ror/pkg/config/rorconfig"
@@ -31,7 +32,7 @@ type prometheusQueryResult struct {
 }
 
 // NodeExporterReporting queries Prometheus for node_exporter metrics and posts a report.
-func NodeExporterReporting(rorAgentClientInterface clusteragentclient.RorAgentClientInterface) error {
+func NodeExporterReporting(ctx context.Context, rorAgentClientInterface clusteragentclient.RorAgentClientInterface) error {
 	prometheusURL := rorconfig.GetString(agentconsts.PrometheusURLEnv)
 	if prometheusURL == "" {
 		return nil // Prometheus not configured, skip silently
@@ -40,7 +41,7 @@ func NodeExporterReporting(rorAgentClientInterface clusteragentclient.RorAgentCl
 	rorClientInterface := rorAgentClientInterface.GetRorClient()
 	owner := rorClientInterface.GetOwnerref()
 
-	nodes, err := collectNodeExporterMetrics(prometheusURL)
+	nodes, err := collectNodeExporterMetrics(ctx, prometheusURL)
 	if err != nil {
 		rlog.Error("error collecting node_exporter metrics", err)
 		return err
@@ -58,7 +59,9 @@ func NodeExporterReporting(rorAgentClientInterface clusteragentclient.RorAgentCl
 		Nodes: nodes,
 	}
 
-	err = rorClientInterface.Metrics().PostReport(context.TODO(), report)
+	postCtx, cancel := timeouts.RorApi(ctx)
+	defer cancel()
+	err = rorClientInterface.Metrics().PostReport(postCtx, report)
 	if err != nil {
 		rlog.Error("error posting node_exporter metrics", err)
 		return err
@@ -68,7 +71,7 @@ func NodeExporterReporting(rorAgentClientInterface clusteragentclient.RorAgentCl
 	return nil
 }
 
-func collectNodeExporterMetrics(prometheusURL string) ([]apicontracts.NodeMetric, error) {
+func collectNodeExporterMetrics(ctx context.Context, prometheusURL string) ([]apicontracts.NodeMetric, error) {
 	now := time.Now()
 	queries := map[string]string{
 		"cpu":        `100 - (avg by (instance) (rate(node_cpu_seconds_total{mode="idle"}[5m])) * 100)`,
@@ -87,7 +90,7 @@ func collectNodeExporterMetrics(prometheusURL string) ([]apicontracts.NodeMetric
 
 	results := make(map[string]map[string]float64)
 	for name, query := range queries {
-		values, err := queryPrometheus(prometheusURL, query)
+		values, err := queryPrometheus(ctx, prometheusURL, query)
 		if err != nil {
 			rlog.Warn("prometheus query failed", rlog.String("query", name), rlog.String("error", err.Error()))
 			continue
@@ -156,7 +159,7 @@ func getVal(results map[string]map[string]float64, metric, instance string) floa
 	return 0
 }
 
-func queryPrometheus(baseURL, query string) (map[string]float64, error) {
+func queryPrometheus(ctx context.Context, baseURL, query string) (map[string]float64, error) {
 	u, err := url.Parse(baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid prometheus url: %w", err)
@@ -164,7 +167,7 @@ func queryPrometheus(baseURL, query string) (map[string]float64, error) {
 	u.Path = "/api/v1/query"
 	u.RawQuery = url.Values{"query": {query}}.Encode()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
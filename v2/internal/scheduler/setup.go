@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"context"
 	"time"
 
 	"github.com/NorskHelsenett/ror-agent/common/pkg/clients/clusteragentclient"
@@ -9,13 +10,15 @@ import (
 	"github.com/go-co-op/gocron"
 )
 
-func SetUpScheduler(rorAgentClientInterface clusteragentclient.RorAgentClientInterface) {
+// SetUpScheduler starts the scheduled jobs of the agent, the jobs are canceled with ctx.
+func SetUpScheduler(ctx context.Context, rorAgentClientInterface clusteragentclient.RorAgentClientInterface) *gocron.Scheduler {
 	rlog.Info("Starting schedulers")
 	scheduler := gocron.NewScheduler(time.UTC)
-	_, err := scheduler.Every(5).Minutes().StartImmediately().Tag("node-exporter").Do(NodeExporterReporting, rorAgentClientInterface)
+	_, err := scheduler.Every(5).Minutes().StartImmediately().Tag("node-exporter").Do(NodeExporterReporting, ctx, rorAgentClientInterface)
 
 	if err != nil {
 		rlog.Error("Could not setup scheduler for node-exporter metrics", err)
 	}
 	scheduler.StartAsync()
+	return scheduler
 }